@@ -1,10 +1,16 @@
 package ast
 
-import "bytes"
+import (
+	"bytes"
+
+	"github.com/cupsadarius/monkey_interpreter/token"
+)
 
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // of the first character of the node
+	End() token.Position // just past the last character of the node
 }
 
 type Statement interface {
@@ -19,6 +25,7 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+	Resolved   bool // whether the resolver has annotated the program
 }
 
 func (p *Program) TokenLiteral() string {
@@ -30,6 +37,22 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 && p.Statements[0] != nil {
+		return p.Statements[0].Pos()
+	}
+
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 && p.Statements[len(p.Statements)-1] != nil {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -39,3 +62,32 @@ func (p *Program) String() string {
 
 	return out.String()
 }
+
+// Parens records the outermost pair of parentheses around an expression,
+// which belong to the source span of the expression.
+type Parens struct {
+	Open  token.Token `json:"open"`  // the '(' Token, missing unless parenthesized
+	Close token.Token `json:"close"` // the ')' Token
+}
+
+// Enclose records open and close as the parentheses around the expression.
+// Parsing nested parentheses from the inside out leaves the outermost pair.
+func (p *Parens) Enclose(open, close token.Token) {
+	p.Open, p.Close = open, close
+}
+
+func (p Parens) pos(inner token.Position) token.Position {
+	if p.Open.Line > 0 {
+		return p.Open.Pos()
+	}
+
+	return inner
+}
+
+func (p Parens) end(inner token.Position) token.Position {
+	if p.Close.Line > 0 {
+		return p.Close.End()
+	}
+
+	return inner
+}
@@ -27,3 +27,30 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() is wrong. got=%q", program.String())
 	}
 }
+
+func TestPositionsOfIncompleteNodes(t *testing.T) {
+	nodes := []Node{
+		&Program{Statements: []Statement{nil}},
+		&LetStatement{},
+		&ReturnStatement{},
+		&ExpressionStatement{},
+		&BlockStatement{Statements: []Statement{nil}},
+		&PrefixExpression{},
+		&InfixExpression{},
+		&IfExpression{},
+		&CallExpression{Arguments: []Expression{nil}},
+		&MemberExpression{},
+		&FunctionLiteral{},
+		&Identifier{},
+		&IntegerLiteral{},
+		&FloatLiteral{},
+		&BooleanLiteral{},
+		&StringLiteral{},
+	}
+
+	for _, node := range nodes {
+		if pos, end := node.Pos(), node.End(); pos != (token.Position{}) || end != (token.Position{}) {
+			t.Errorf("%T: wrong span of a node without tokens. got=%s-%s", node, pos, end)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 )
 
 type PrefixExpression struct {
+	Parens
 	Token    token.Token
 	Operator string
 	Right    Expression
@@ -18,6 +19,18 @@ func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
 
+func (pe *PrefixExpression) Pos() token.Position {
+	return pe.pos(pe.Token.Pos())
+}
+
+func (pe *PrefixExpression) End() token.Position {
+	if pe.Right == nil {
+		return pe.end(pe.Token.End())
+	}
+
+	return pe.end(pe.Right.End())
+}
+
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -30,6 +43,7 @@ func (pe *PrefixExpression) String() string {
 }
 
 type InfixExpression struct {
+	Parens
 	Token    token.Token
 	Left     Expression
 	Operator string
@@ -41,6 +55,22 @@ func (ie *InfixExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *InfixExpression) Pos() token.Position {
+	if ie.Left == nil {
+		return ie.pos(ie.Token.Pos())
+	}
+
+	return ie.pos(ie.Left.Pos())
+}
+
+func (ie *InfixExpression) End() token.Position {
+	if ie.Right == nil {
+		return ie.end(ie.Token.End())
+	}
+
+	return ie.end(ie.Right.End())
+}
+
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -54,6 +84,7 @@ func (ie *InfixExpression) String() string {
 }
 
 type IfExpression struct {
+	Parens
 	Token       token.Token // The 'if' Token
 	Condition   Expression
 	Consequence *BlockStatement
@@ -65,6 +96,23 @@ func (ie *IfExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *IfExpression) Pos() token.Position {
+	return ie.pos(ie.Token.Pos())
+}
+
+func (ie *IfExpression) End() token.Position {
+	switch {
+	case ie.Alternative != nil:
+		return ie.end(ie.Alternative.End())
+	case ie.Consequence != nil:
+		return ie.end(ie.Consequence.End())
+	case ie.Condition != nil:
+		return ie.end(ie.Condition.End())
+	}
+
+	return ie.end(ie.Token.End())
+}
+
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -82,9 +130,11 @@ func (ie *IfExpression) String() string {
 }
 
 type CallExpression struct {
+	Parens
 	Token     token.Token // the '(' Token
 	Function  Expression  //Identifier or FunctionLiteral
 	Arguments []Expression
+	Rparen    token.Token // the ')' Token, missing in calls left open
 }
 
 func (ce *CallExpression) expressionNode() {}
@@ -92,6 +142,25 @@ func (ce *CallExpression) TokenLiteral() string {
 	return ce.Token.Literal
 }
 
+func (ce *CallExpression) Pos() token.Position {
+	if ce.Function == nil {
+		return ce.pos(ce.Token.Pos())
+	}
+
+	return ce.pos(ce.Function.Pos())
+}
+
+func (ce *CallExpression) End() token.Position {
+	switch {
+	case ce.Rparen.Line > 0:
+		return ce.end(ce.Rparen.End())
+	case len(ce.Arguments) > 0 && ce.Arguments[len(ce.Arguments)-1] != nil:
+		return ce.end(ce.Arguments[len(ce.Arguments)-1].End())
+	}
+
+	return ce.end(ce.Token.End())
+}
+
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -108,3 +177,35 @@ func (ce *CallExpression) String() string {
 
 	return out.String()
 }
+
+type MemberExpression struct {
+	Parens
+	Token    token.Token // the '.' Token
+	Object   Expression
+	Property *Identifier
+}
+
+func (me *MemberExpression) expressionNode() {}
+func (me *MemberExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+
+func (me *MemberExpression) Pos() token.Position {
+	if me.Object == nil {
+		return me.pos(me.Token.Pos())
+	}
+
+	return me.pos(me.Object.Pos())
+}
+
+func (me *MemberExpression) End() token.Position {
+	if me.Property == nil {
+		return me.end(me.Token.End())
+	}
+
+	return me.end(me.Property.End())
+}
+
+func (me *MemberExpression) String() string {
+	return me.Object.String() + "." + me.Property.String()
+}
@@ -8,8 +8,19 @@ import (
 )
 
 type Identifier struct {
+	Parens
 	Token token.Token
 	Value string
+
+	// Set by the resolver. Index is the slot of a local or cell, or the
+	// position in the free variables of the function; Depth is the number
+	// of functions between a free identifier and its binding. Shadowed is
+	// the variable read instead while a let has not bound the one of the
+	// identifier yet, or nil if it is always bound when it is read.
+	Scope    Scope
+	Depth    int
+	Index    int
+	Shadowed *Identifier
 }
 
 func (i *Identifier) expressionNode() {}
@@ -18,11 +29,20 @@ func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i *Identifier) Pos() token.Position {
+	return i.pos(i.Token.Pos())
+}
+
+func (i *Identifier) End() token.Position {
+	return i.end(i.Token.End())
+}
+
 func (i *Identifier) String() string {
 	return i.Value
 }
 
 type IntegerLiteral struct {
+	Parens
 	Token token.Token
 	Value int64
 }
@@ -33,11 +53,20 @@ func (il *IntegerLiteral) TokenLiteral() string {
 	return il.Token.Literal
 }
 
+func (il *IntegerLiteral) Pos() token.Position {
+	return il.pos(il.Token.Pos())
+}
+
+func (il *IntegerLiteral) End() token.Position {
+	return il.end(il.Token.End())
+}
+
 func (il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
 
 type FloatLiteral struct {
+	Parens
 	Token token.Token
 	Value float64
 }
@@ -48,11 +77,20 @@ func (fl *FloatLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
 
+func (fl *FloatLiteral) Pos() token.Position {
+	return fl.pos(fl.Token.Pos())
+}
+
+func (fl *FloatLiteral) End() token.Position {
+	return fl.end(fl.Token.End())
+}
+
 func (fl *FloatLiteral) String() string {
 	return fl.Token.Literal
 }
 
 type BooleanLiteral struct {
+	Parens
 	Token token.Token
 	Value bool
 }
@@ -63,14 +101,25 @@ func (b *BooleanLiteral) TokenLiteral() string {
 	return b.Token.Literal
 }
 
+func (b *BooleanLiteral) Pos() token.Position {
+	return b.pos(b.Token.Pos())
+}
+
+func (b *BooleanLiteral) End() token.Position {
+	return b.end(b.Token.End())
+}
+
 func (b *BooleanLiteral) String() string {
 	return b.Token.Literal
 }
 
 type FunctionLiteral struct {
+	Parens
 	Token      token.Token // the 'fn' Token
+	Name       string      // the name it is bound to by a let statement, if any
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Layout     *FrameLayout // set by the resolver
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
@@ -79,6 +128,18 @@ func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
 
+func (fl *FunctionLiteral) Pos() token.Position {
+	return fl.pos(fl.Token.Pos())
+}
+
+func (fl *FunctionLiteral) End() token.Position {
+	if fl.Body == nil {
+		return fl.end(fl.Token.End())
+	}
+
+	return fl.end(fl.Body.End())
+}
+
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -98,6 +159,7 @@ func (fl *FunctionLiteral) String() string {
 }
 
 type StringLiteral struct {
+	Parens
 	Token token.Token
 	Value string
 }
@@ -108,6 +170,14 @@ func (s *StringLiteral) TokenLiteral() string {
 	return s.Token.Literal
 }
 
+func (s *StringLiteral) Pos() token.Position {
+	return s.pos(s.Token.Pos())
+}
+
+func (s *StringLiteral) End() token.Position {
+	return s.end(s.Token.End())
+}
+
 func (s *StringLiteral) String() string {
 	return s.Token.Literal
 }
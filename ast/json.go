@@ -0,0 +1,477 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/cupsadarius/monkey_interpreter/token"
+)
+
+// Nodes are encoded as JSON objects whose "type" names the node type,
+// followed by the source span of the node, its tokens and its children.
+// Children missing from programs that failed to parse are encoded as null.
+// The annotations of the resolver are not encoded. Nodes do not implement
+// json.Unmarshaler, since their children are interfaces; DecodeJSON decodes
+// them instead.
+
+// header holds the members every encoded node starts with.
+type header struct {
+	Type string         `json:"type"`
+	Pos  token.Position `json:"pos"`
+	End  token.Position `json:"end"`
+}
+
+func headerOf(typ string, n Node) header {
+	return header{Type: typ, Pos: n.Pos(), End: n.End()}
+}
+
+// encoded returns nil unless the expression is parenthesized, so that
+// missing parentheses are left out.
+func (p Parens) encoded() *Parens {
+	if p.Open.Type == "" {
+		return nil
+	}
+
+	return &p
+}
+
+// optional returns nil for tokens that are missing, so that they are left
+// out.
+func optional(t token.Token) *token.Token {
+	if t.Type == "" {
+		return nil
+	}
+
+	return &t
+}
+
+func (p *Program) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		header
+		Statements []Statement `json:"statements"`
+	}{headerOf("Program", p), p.Statements})
+}
+
+func (ls *LetStatement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		header
+		Token token.Token `json:"token"`
+		Name  *Identifier `json:"name"`
+		Value Expression  `json:"value"`
+	}{headerOf("LetStatement", ls), ls.Token, ls.Name, ls.Value})
+}
+
+func (rs *ReturnStatement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		header
+		Token       token.Token `json:"token"`
+		ReturnValue Expression  `json:"returnValue"`
+	}{headerOf("ReturnStatement", rs), rs.Token, rs.ReturnValue})
+}
+
+func (es *ExpressionStatement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		header
+		Token      token.Token `json:"token"`
+		Expression Expression  `json:"expression"`
+	}{headerOf("ExpressionStatement", es), es.Token, es.Expression})
+}
+
+func (bs *BlockStatement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		header
+		Token      token.Token  `json:"token"`
+		Statements []Statement  `json:"statements"`
+		Rbrace     *token.Token `json:"rbrace,omitempty"`
+	}{headerOf("BlockStatement", bs), bs.Token, bs.Statements, optional(bs.Rbrace)})
+}
+
+func (i *Identifier) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		header
+		Token  token.Token `json:"token"`
+		Parens *Parens     `json:"parens,omitempty"`
+		Value  string      `json:"value"`
+	}{headerOf("Identifier", i), i.Token, i.Parens.encoded(), i.Value})
+}
+
+func (il *IntegerLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		header
+		Token  token.Token `json:"token"`
+		Parens *Parens     `json:"parens,omitempty"`
+		Value  int64       `json:"value"`
+	}{headerOf("IntegerLiteral", il), il.Token, il.Parens.encoded(), il.Value})
+}
+
+func (fl *FloatLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		header
+		Token  token.Token `json:"token"`
+		Parens *Parens     `json:"parens,omitempty"`
+		Value  float64     `json:"value"`
+	}{headerOf("FloatLiteral", fl), fl.Token, fl.Parens.encoded(), fl.Value})
+}
+
+func (b *BooleanLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		header
+		Token  token.Token `json:"token"`
+		Parens *Parens     `json:"parens,omitempty"`
+		Value  bool        `json:"value"`
+	}{headerOf("BooleanLiteral", b), b.Token, b.Parens.encoded(), b.Value})
+}
+
+func (s *StringLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		header
+		Token  token.Token `json:"token"`
+		Parens *Parens     `json:"parens,omitempty"`
+		Value  string      `json:"value"`
+	}{headerOf("StringLiteral", s), s.Token, s.Parens.encoded(), s.Value})
+}
+
+func (fl *FunctionLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		header
+		Token      token.Token     `json:"token"`
+		Parens     *Parens         `json:"parens,omitempty"`
+		Name       string          `json:"name,omitempty"`
+		Parameters []*Identifier   `json:"parameters"`
+		Body       *BlockStatement `json:"body"`
+	}{headerOf("FunctionLiteral", fl), fl.Token, fl.Parens.encoded(), fl.Name, fl.Parameters, fl.Body})
+}
+
+func (pe *PrefixExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		header
+		Token    token.Token `json:"token"`
+		Parens   *Parens     `json:"parens,omitempty"`
+		Operator string      `json:"operator"`
+		Right    Expression  `json:"right"`
+	}{headerOf("PrefixExpression", pe), pe.Token, pe.Parens.encoded(), pe.Operator, pe.Right})
+}
+
+func (ie *InfixExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		header
+		Token    token.Token `json:"token"`
+		Parens   *Parens     `json:"parens,omitempty"`
+		Left     Expression  `json:"left"`
+		Operator string      `json:"operator"`
+		Right    Expression  `json:"right"`
+	}{headerOf("InfixExpression", ie), ie.Token, ie.Parens.encoded(), ie.Left, ie.Operator, ie.Right})
+}
+
+func (ie *IfExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		header
+		Token       token.Token     `json:"token"`
+		Parens      *Parens         `json:"parens,omitempty"`
+		Condition   Expression      `json:"condition"`
+		Consequence *BlockStatement `json:"consequence"`
+		Alternative *BlockStatement `json:"alternative"`
+	}{headerOf("IfExpression", ie), ie.Token, ie.Parens.encoded(), ie.Condition, ie.Consequence, ie.Alternative})
+}
+
+func (ce *CallExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		header
+		Token     token.Token  `json:"token"`
+		Parens    *Parens      `json:"parens,omitempty"`
+		Function  Expression   `json:"function"`
+		Arguments []Expression `json:"arguments"`
+		Rparen    *token.Token `json:"rparen,omitempty"`
+	}{headerOf("CallExpression", ce), ce.Token, ce.Parens.encoded(), ce.Function, ce.Arguments, optional(ce.Rparen)})
+}
+
+func (me *MemberExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		header
+		Token    token.Token `json:"token"`
+		Parens   *Parens     `json:"parens,omitempty"`
+		Object   Expression  `json:"object"`
+		Property *Identifier `json:"property"`
+	}{headerOf("MemberExpression", me), me.Token, me.Parens.encoded(), me.Object, me.Property})
+}
+
+// DecodeJSON decodes a node, and the tree below it, from the JSON it was
+// marshaled to. The positions of the decoded nodes are those of their
+// tokens, the encoded spans are not read. Nodes missing a child, as those
+// of programs that failed to parse do, are rejected.
+func DecodeJSON(data []byte) (Node, error) {
+	d := &decoder{}
+	node := d.node(data)
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return node, nil
+}
+
+// encoded holds the members of any encoded node. Members whose type
+// differs between nodes are decoded once the type of the node is known.
+type encoded struct {
+	Type        string            `json:"type"`
+	Token       token.Token       `json:"token"`
+	Parens      *Parens           `json:"parens"`
+	Rbrace      *token.Token      `json:"rbrace"`
+	Rparen      *token.Token      `json:"rparen"`
+	Operator    string            `json:"operator"`
+	Name        json.RawMessage   `json:"name"`
+	Value       json.RawMessage   `json:"value"`
+	ReturnValue json.RawMessage   `json:"returnValue"`
+	Expression  json.RawMessage   `json:"expression"`
+	Statements  []json.RawMessage `json:"statements"`
+	Right       json.RawMessage   `json:"right"`
+	Left        json.RawMessage   `json:"left"`
+	Condition   json.RawMessage   `json:"condition"`
+	Consequence json.RawMessage   `json:"consequence"`
+	Alternative json.RawMessage   `json:"alternative"`
+	Parameters  []json.RawMessage `json:"parameters"`
+	Body        json.RawMessage   `json:"body"`
+	Function    json.RawMessage   `json:"function"`
+	Arguments   []json.RawMessage `json:"arguments"`
+	Object      json.RawMessage   `json:"object"`
+	Property    json.RawMessage   `json:"property"`
+}
+
+// decoder keeps the first error met while decoding a tree.
+type decoder struct {
+	err error
+}
+
+func (d *decoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("ast: "+format, args...)
+	}
+}
+
+// require fails unless the child member of a node of type typ is present.
+func (d *decoder) require(typ, member string, present bool) {
+	if !present {
+		d.fail("%s without %s", typ, member)
+	}
+}
+
+// unmarshal decodes data into v, leaving v alone for missing members.
+func (d *decoder) unmarshal(data []byte, v interface{}) {
+	if len(data) == 0 {
+		return
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		d.fail("%s", err)
+	}
+}
+
+func isNull(data []byte) bool {
+	return len(data) == 0 || string(data) == "null"
+}
+
+// node decodes a node, or nil for null.
+func (d *decoder) node(data []byte) Node {
+	if isNull(data) || d.err != nil {
+		return nil
+	}
+
+	var e encoded
+	if d.unmarshal(data, &e); d.err != nil {
+		return nil
+	}
+
+	parens := Parens{}
+	if e.Parens != nil {
+		parens = *e.Parens
+	}
+
+	switch e.Type {
+	case "Program":
+		return &Program{Statements: d.statements(e.Statements)}
+
+	case "LetStatement":
+		ls := &LetStatement{Token: e.Token, Name: d.identifier(e.Name), Value: d.expression(e.Value)}
+		d.require(e.Type, "name", ls.Name != nil)
+		d.require(e.Type, "value", ls.Value != nil)
+		return ls
+
+	case "ReturnStatement":
+		rs := &ReturnStatement{Token: e.Token, ReturnValue: d.expression(e.ReturnValue)}
+		d.require(e.Type, "returnValue", rs.ReturnValue != nil)
+		return rs
+
+	case "ExpressionStatement":
+		es := &ExpressionStatement{Token: e.Token, Expression: d.expression(e.Expression)}
+		d.require(e.Type, "expression", es.Expression != nil)
+		return es
+
+	case "BlockStatement":
+		b := &BlockStatement{Token: e.Token, Statements: d.statements(e.Statements)}
+		if e.Rbrace != nil {
+			b.Rbrace = *e.Rbrace
+		}
+		return b
+
+	case "Identifier":
+		i := &Identifier{Parens: parens, Token: e.Token}
+		d.unmarshal(e.Value, &i.Value)
+		return i
+
+	case "IntegerLiteral":
+		il := &IntegerLiteral{Parens: parens, Token: e.Token}
+		d.unmarshal(e.Value, &il.Value)
+		return il
+
+	case "FloatLiteral":
+		fl := &FloatLiteral{Parens: parens, Token: e.Token}
+		d.unmarshal(e.Value, &fl.Value)
+		return fl
+
+	case "BooleanLiteral":
+		b := &BooleanLiteral{Parens: parens, Token: e.Token}
+		d.unmarshal(e.Value, &b.Value)
+		return b
+
+	case "StringLiteral":
+		s := &StringLiteral{Parens: parens, Token: e.Token}
+		d.unmarshal(e.Value, &s.Value)
+		return s
+
+	case "FunctionLiteral":
+		fl := &FunctionLiteral{Parens: parens, Token: e.Token, Body: d.block(e.Body)}
+		d.unmarshal(e.Name, &fl.Name)
+		d.require(e.Type, "parameters", e.Parameters != nil)
+		d.require(e.Type, "body", fl.Body != nil)
+		fl.Parameters = []*Identifier{}
+		for _, p := range e.Parameters {
+			param := d.identifier(p)
+			d.require(e.Type, "parameter", param != nil)
+			fl.Parameters = append(fl.Parameters, param)
+		}
+		return fl
+
+	case "PrefixExpression":
+		pe := &PrefixExpression{Parens: parens, Token: e.Token, Operator: e.Operator, Right: d.expression(e.Right)}
+		d.require(e.Type, "right", pe.Right != nil)
+		return pe
+
+	case "InfixExpression":
+		ie := &InfixExpression{
+			Parens:   parens,
+			Token:    e.Token,
+			Left:     d.expression(e.Left),
+			Operator: e.Operator,
+			Right:    d.expression(e.Right),
+		}
+		d.require(e.Type, "left", ie.Left != nil)
+		d.require(e.Type, "right", ie.Right != nil)
+		return ie
+
+	case "IfExpression":
+		ie := &IfExpression{
+			Parens:      parens,
+			Token:       e.Token,
+			Condition:   d.expression(e.Condition),
+			Consequence: d.block(e.Consequence),
+			Alternative: d.block(e.Alternative),
+		}
+		d.require(e.Type, "condition", ie.Condition != nil)
+		d.require(e.Type, "consequence", ie.Consequence != nil)
+		return ie
+
+	case "CallExpression":
+		ce := &CallExpression{Parens: parens, Token: e.Token, Function: d.expression(e.Function)}
+		d.require(e.Type, "function", ce.Function != nil)
+		d.require(e.Type, "arguments", e.Arguments != nil)
+		ce.Arguments = []Expression{}
+		for _, a := range e.Arguments {
+			arg := d.expression(a)
+			d.require(e.Type, "argument", arg != nil)
+			ce.Arguments = append(ce.Arguments, arg)
+		}
+		if e.Rparen != nil {
+			ce.Rparen = *e.Rparen
+		}
+		return ce
+
+	case "MemberExpression":
+		me := &MemberExpression{Parens: parens, Token: e.Token, Object: d.expression(e.Object), Property: d.identifier(e.Property)}
+		d.require(e.Type, "object", me.Object != nil)
+		d.require(e.Type, "property", me.Property != nil)
+		return me
+	}
+
+	d.fail("unknown node type %q", e.Type)
+	return nil
+}
+
+func (d *decoder) statements(list []json.RawMessage) []Statement {
+	if list == nil {
+		return nil
+	}
+
+	statements := []Statement{}
+
+	for _, data := range list {
+		node := d.node(data)
+		if node == nil {
+			d.fail("missing statement")
+			continue
+		}
+
+		s, ok := node.(Statement)
+		if !ok {
+			d.fail("%T is not a statement", node)
+			continue
+		}
+		statements = append(statements, s)
+	}
+
+	return statements
+}
+
+func (d *decoder) expression(data []byte) Expression {
+	node := d.node(data)
+	if node == nil {
+		return nil
+	}
+
+	e, ok := node.(Expression)
+	if !ok {
+		d.fail("%T is not an expression", node)
+		return nil
+	}
+
+	return e
+}
+
+func (d *decoder) identifier(data []byte) *Identifier {
+	node := d.node(data)
+	if node == nil {
+		return nil
+	}
+
+	i, ok := node.(*Identifier)
+	if !ok {
+		d.fail("%T is not an identifier", node)
+		return nil
+	}
+
+	return i
+}
+
+func (d *decoder) block(data []byte) *BlockStatement {
+	node := d.node(data)
+	if node == nil {
+		return nil
+	}
+
+	b, ok := node.(*BlockStatement)
+	if !ok {
+		d.fail("%T is not a block", node)
+		return nil
+	}
+
+	return b
+}
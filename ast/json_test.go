@@ -0,0 +1,139 @@
+package ast
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/token"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	program := testProgram()
+	program.Statements = append(program.Statements,
+		// parenthesized, with the closing tokens set
+		expression(&CallExpression{
+			Token:     token.Token{Type: token.LPAREN, Literal: "("},
+			Function:  ident("g"),
+			Arguments: []Expression{},
+			Rparen:    token.Token{Type: token.RPAREN, Literal: ")"},
+		}),
+		&ReturnStatement{Token: token.Token{Type: token.RETURN, Literal: "return"}, ReturnValue: &FunctionLiteral{
+			Parens:     Parens{Open: token.Token{Type: token.LPAREN, Literal: "("}, Close: token.Token{Type: token.RPAREN, Literal: ")"}},
+			Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+			Name:       "h",
+			Parameters: []*Identifier{},
+			Body:       &BlockStatement{Token: token.Token{Type: token.LBRACE, Literal: "{"}, Rbrace: token.Token{Type: token.RBRACE, Literal: "}"}},
+		}},
+	)
+
+	data, err := json.Marshal(program)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	decoded, err := DecodeJSON(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if decoded.String() != program.String() {
+		t.Errorf("wrong program.\nexpected=%s\ngot=%s", program.String(), decoded.String())
+	}
+
+	// encoding the decoded tree gives the same JSON
+	again, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("wrong JSON after decoding.\nexpected=%s\ngot=%s", data, again)
+	}
+}
+
+func TestJSONEncoding(t *testing.T) {
+	node := &InfixExpression{
+		Token:    token.Token{Type: token.PLUS, Literal: "+", Line: 1, Column: 3, Offset: 2},
+		Left:     &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1", Line: 1, Column: 1}, Value: 1},
+		Operator: "+",
+		Right:    &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x", Line: 1, Column: 5, Offset: 4}, Value: "x"},
+	}
+
+	data, err := json.Marshal(node)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := `{"type":"InfixExpression",` +
+		`"pos":{"offset":0,"line":1,"column":1},"end":{"offset":5,"line":1,"column":6},` +
+		`"token":{"type":"+","literal":"+","line":1,"column":3,"offset":2},` +
+		`"left":{"type":"IntegerLiteral",` +
+		`"pos":{"offset":0,"line":1,"column":1},"end":{"offset":1,"line":1,"column":2},` +
+		`"token":{"type":"INT","literal":"1","line":1,"column":1,"offset":0},"value":1},` +
+		`"operator":"+",` +
+		`"right":{"type":"Identifier",` +
+		`"pos":{"offset":4,"line":1,"column":5},"end":{"offset":5,"line":1,"column":6},` +
+		`"token":{"type":"IDENT","literal":"x","line":1,"column":5,"offset":4},"value":"x"}}`
+
+	if string(data) != expected {
+		t.Errorf("wrong JSON.\nexpected=%s\ngot=%s", expected, data)
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"type":"Loop"}`, `ast: unknown node type "Loop"`},
+		{`{"type":"Program","statements":[{"type":"Identifier","value":"x"}]}`, "ast: *ast.Identifier is not a statement"},
+		{`{"type":"LetStatement","name":{"type":"IntegerLiteral","value":1}}`, "ast: *ast.IntegerLiteral is not an identifier"},
+		{`{"type":"IntegerLiteral","value":"one"}`, "ast: json: cannot unmarshal string into Go value of type int64"},
+		{`[]`, "ast: json: cannot unmarshal array into Go value of type ast.encoded"},
+		{`{"type":"LetStatement"}`, "ast: LetStatement without name"},
+		{`{"type":"CallExpression","function":{"type":"Identifier","value":"f"},"arguments":[null]}`, "ast: CallExpression without argument"},
+	}
+
+	for _, tt := range tests {
+		_, err := DecodeJSON([]byte(tt.input))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %s. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestJSONEncodingOfMissingChildren(t *testing.T) {
+	plus := token.Token{Type: token.PLUS, Literal: "+", Line: 1, Column: 1}
+	tests := []struct {
+		node     Node
+		expected []string
+		err      string
+	}{
+		{&LetStatement{Token: token.Token{Type: token.LET, Literal: "let", Line: 1, Column: 1}}, []string{`"name":null`, `"value":null`}, "LetStatement without name"},
+		{&ReturnStatement{}, []string{`"returnValue":null`}, "ReturnStatement without returnValue"},
+		{&ExpressionStatement{}, []string{`"expression":null`}, "ExpressionStatement without expression"},
+		{&PrefixExpression{Token: plus, Operator: "-"}, []string{`"right":null`}, "PrefixExpression without right"},
+		{&InfixExpression{Token: plus, Operator: "+"}, []string{`"left":null`, `"right":null`}, "InfixExpression without left"},
+		{&IfExpression{}, []string{`"condition":null`, `"consequence":null`, `"alternative":null`}, "IfExpression without condition"},
+		{&CallExpression{Arguments: []Expression{nil}}, []string{`"function":null`, `"arguments":[null]`}, "CallExpression without function"},
+		{&MemberExpression{}, []string{`"object":null`, `"property":null`}, "MemberExpression without object"},
+		{&FunctionLiteral{}, []string{`"parameters":null`, `"body":null`}, "FunctionLiteral without parameters"},
+		{&Program{Statements: []Statement{nil}}, []string{`"statements":[null]`}, "missing statement"},
+	}
+
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.node)
+		if err != nil {
+			t.Fatalf("%T: unexpected error: %s", tt.node, err)
+		}
+		for _, member := range tt.expected {
+			if !strings.Contains(string(data), member) {
+				t.Errorf("%T: %s missing from %s", tt.node, member, data)
+			}
+		}
+
+		// decoding them would leave nodes that cannot be used
+		if _, err := DecodeJSON(data); err == nil || err.Error() != "ast: "+tt.err {
+			t.Errorf("%T: wrong error. expected=%q, got=%v", tt.node, "ast: "+tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package ast
+
+import "fmt"
+
+// Rewrite rewrites the tree rooted at node bottom up and returns its new
+// root. The children of a node are rewritten first, in the order they
+// appear in the source, then the node is replaced by what f returns for it;
+// returning the node keeps it. Statements replaced by nil are removed from
+// their program or block, other children replaced by nil are left missing.
+// Rewrite changes the nodes it traverses in place and panics if f returns a
+// node that cannot take the place of the one it replaces, like an
+// expression for a statement.
+func Rewrite(node Node, f func(Node) Node) Node {
+	switch n := node.(type) {
+	case *Program:
+		n.Statements = rewriteStatements(n.Statements, f)
+
+	case *LetStatement:
+		n.Name = rewriteIdentifier(n.Name, f)
+		n.Value = rewriteExpression(n.Value, f)
+
+	case *ReturnStatement:
+		n.ReturnValue = rewriteExpression(n.ReturnValue, f)
+
+	case *ExpressionStatement:
+		n.Expression = rewriteExpression(n.Expression, f)
+
+	case *BlockStatement:
+		n.Statements = rewriteStatements(n.Statements, f)
+
+	case *PrefixExpression:
+		n.Right = rewriteExpression(n.Right, f)
+
+	case *InfixExpression:
+		n.Left = rewriteExpression(n.Left, f)
+		n.Right = rewriteExpression(n.Right, f)
+
+	case *IfExpression:
+		n.Condition = rewriteExpression(n.Condition, f)
+		n.Consequence = rewriteBlock(n.Consequence, f)
+		n.Alternative = rewriteBlock(n.Alternative, f)
+
+	case *FunctionLiteral:
+		for i, p := range n.Parameters {
+			n.Parameters[i] = rewriteIdentifier(p, f)
+		}
+		n.Body = rewriteBlock(n.Body, f)
+
+	case *CallExpression:
+		n.Function = rewriteExpression(n.Function, f)
+		for i, a := range n.Arguments {
+			n.Arguments[i] = rewriteExpression(a, f)
+		}
+
+	case *MemberExpression:
+		n.Object = rewriteExpression(n.Object, f)
+		n.Property = rewriteIdentifier(n.Property, f)
+
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *BooleanLiteral, *StringLiteral:
+		// no children
+
+	default:
+		panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", n))
+	}
+
+	return f(node)
+}
+
+func rewriteStatements(list []Statement, f func(Node) Node) []Statement {
+	result := list[:0]
+
+	for _, s := range list {
+		if s == nil {
+			continue
+		}
+
+		r := Rewrite(s, f)
+		if r == nil {
+			continue
+		}
+
+		statement, ok := r.(Statement)
+		if !ok {
+			panic(fmt.Sprintf("ast.Rewrite: %T cannot replace statement %T", r, s))
+		}
+		result = append(result, statement)
+	}
+
+	return result
+}
+
+func rewriteExpression(e Expression, f func(Node) Node) Expression {
+	if e == nil {
+		return nil
+	}
+
+	r := Rewrite(e, f)
+	if r == nil {
+		return nil
+	}
+
+	expression, ok := r.(Expression)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: %T cannot replace expression %T", r, e))
+	}
+
+	return expression
+}
+
+func rewriteBlock(b *BlockStatement, f func(Node) Node) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+
+	r := Rewrite(b, f)
+	if r == nil {
+		return nil
+	}
+
+	block, ok := r.(*BlockStatement)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: %T cannot replace block", r))
+	}
+
+	return block
+}
+
+func rewriteIdentifier(i *Identifier, f func(Node) Node) *Identifier {
+	if i == nil {
+		return nil
+	}
+
+	r := Rewrite(i, f)
+	if r == nil {
+		return nil
+	}
+
+	identifier, ok := r.(*Identifier)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: %T cannot replace identifier %s", r, i.Value))
+	}
+
+	return identifier
+}
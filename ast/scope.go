@@ -0,0 +1,36 @@
+package ast
+
+// Scope tells where the variable an identifier refers to lives. It is set
+// by the resolver; identifiers that have not been resolved are looked up by
+// name.
+type Scope int
+
+const (
+	Unresolved Scope = iota
+	Global           // bound in the global environment, looked up by name
+	Local            // a slot of the frame of the enclosing function
+	Cell             // a local that is captured by a closure
+	Free             // a captured variable of an enclosing function
+)
+
+var scopeNames = map[Scope]string{
+	Unresolved: "UNRESOLVED",
+	Global:     "GLOBAL",
+	Local:      "LOCAL",
+	Cell:       "CELL",
+	Free:       "FREE",
+}
+
+func (s Scope) String() string {
+	return scopeNames[s]
+}
+
+// FrameLayout describes the frame a function literal needs when it is
+// called: its local slots, the slots of its locals that closures capture
+// and the variables it captures itself. Free holds one identifier per
+// captured variable, resolved in the scope of the enclosing function.
+type FrameLayout struct {
+	Locals []string
+	Cells  []string
+	Free   []*Identifier
+}
@@ -18,6 +18,21 @@ func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
 
+func (ls *LetStatement) Pos() token.Position {
+	return ls.Token.Pos()
+}
+
+func (ls *LetStatement) End() token.Position {
+	switch {
+	case ls.Value != nil:
+		return ls.Value.End()
+	case ls.Name != nil:
+		return ls.Name.End()
+	}
+
+	return ls.Token.End()
+}
+
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -44,6 +59,18 @@ func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
 
+func (rs *ReturnStatement) Pos() token.Position {
+	return rs.Token.Pos()
+}
+
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue == nil {
+		return rs.Token.End()
+	}
+
+	return rs.ReturnValue.End()
+}
+
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(rs.TokenLiteral() + " ")
@@ -68,6 +95,22 @@ func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
 
+func (es *ExpressionStatement) Pos() token.Position {
+	if es.Expression == nil {
+		return es.Token.Pos()
+	}
+
+	return es.Expression.Pos()
+}
+
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression == nil {
+		return es.Token.End()
+	}
+
+	return es.Expression.End()
+}
+
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -79,6 +122,7 @@ func (es *ExpressionStatement) String() string {
 type BlockStatement struct {
   Token token.Token // the '{' Token
   Statements []Statement
+  Rbrace token.Token // the '}' Token, missing in blocks left open
 }
 
 
@@ -88,6 +132,21 @@ func (bs *BlockStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
 
+func (bs *BlockStatement) Pos() token.Position {
+	return bs.Token.Pos()
+}
+
+func (bs *BlockStatement) End() token.Position {
+	switch {
+	case bs.Rbrace.Line > 0:
+		return bs.Rbrace.End()
+	case len(bs.Statements) > 0 && bs.Statements[len(bs.Statements)-1] != nil:
+		return bs.Statements[len(bs.Statements)-1].End()
+	}
+
+	return bs.Token.End()
+}
+
 func (bs *BlockStatement) String() string {
   var out bytes.Buffer
 
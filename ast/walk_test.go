@@ -0,0 +1,250 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/token"
+)
+
+func ident(name string) *Identifier {
+	return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
+
+func integer(value int64) *IntegerLiteral {
+	return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: fmt.Sprint(value)}, Value: value}
+}
+
+func infix(left Expression, operator string, right Expression) *InfixExpression {
+	return &InfixExpression{Token: token.Token{Literal: operator}, Left: left, Operator: operator, Right: right}
+}
+
+func block(statements ...Statement) *BlockStatement {
+	return &BlockStatement{Token: token.Token{Type: token.LBRACE, Literal: "{"}, Statements: statements}
+}
+
+func expression(e Expression) *ExpressionStatement {
+	return &ExpressionStatement{Expression: e}
+}
+
+// testProgram builds
+//
+//	let x = 1 + y;
+//	if (x) { f(x, 2.5) } else { "s".len };
+//	fn(a) { return -a; };
+//	true;
+func testProgram() *Program {
+	return &Program{Statements: []Statement{
+		&LetStatement{Token: token.Token{Type: token.LET, Literal: "let"}, Name: ident("x"), Value: infix(integer(1), "+", ident("y"))},
+		expression(&IfExpression{
+			Token:     token.Token{Type: token.IF, Literal: "if"},
+			Condition: ident("x"),
+			Consequence: block(expression(&CallExpression{
+				Token:     token.Token{Type: token.LPAREN, Literal: "("},
+				Function:  ident("f"),
+				Arguments: []Expression{ident("x"), &FloatLiteral{Token: token.Token{Type: token.FLOAT, Literal: "2.5"}, Value: 2.5}},
+			})),
+			Alternative: block(expression(&MemberExpression{
+				Token:    token.Token{Type: token.DOT, Literal: "."},
+				Object:   &StringLiteral{Token: token.Token{Type: token.STRING, Literal: "s"}, Value: "s"},
+				Property: ident("len"),
+			})),
+		}),
+		expression(&FunctionLiteral{
+			Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+			Parameters: []*Identifier{ident("a")},
+			Body: block(&ReturnStatement{
+				Token:       token.Token{Type: token.RETURN, Literal: "return"},
+				ReturnValue: &PrefixExpression{Token: token.Token{Type: token.MINUS, Literal: "-"}, Operator: "-", Right: ident("a")},
+			}),
+		}),
+		expression(&BooleanLiteral{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true}),
+	}}
+}
+
+func describe(node Node) string {
+	switch node := node.(type) {
+	case nil:
+		return "end"
+	case *Identifier:
+		return node.Value
+	case *IntegerLiteral, *FloatLiteral, *BooleanLiteral, *StringLiteral:
+		return node.TokenLiteral()
+	}
+
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+}
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		skip     string // node type whose children are skipped
+		expected string
+	}{
+		{
+			"",
+			"Program LetStatement x InfixExpression 1 y " +
+				"ExpressionStatement IfExpression x BlockStatement ExpressionStatement CallExpression f x 2.5 " +
+				"BlockStatement ExpressionStatement MemberExpression s len " +
+				"ExpressionStatement FunctionLiteral a BlockStatement ReturnStatement PrefixExpression a " +
+				"ExpressionStatement true",
+		},
+		{
+			"IfExpression",
+			"Program LetStatement x InfixExpression 1 y " +
+				"ExpressionStatement IfExpression " +
+				"ExpressionStatement FunctionLiteral a BlockStatement ReturnStatement PrefixExpression a " +
+				"ExpressionStatement true",
+		},
+		{"Program", "Program"},
+	}
+
+	for _, tt := range tests {
+		var visited []string
+		Inspect(testProgram(), func(node Node) bool {
+			if node != nil {
+				visited = append(visited, describe(node))
+			}
+			return describe(node) != tt.skip
+		})
+
+		if got := strings.Join(visited, " "); got != tt.expected {
+			t.Errorf("wrong nodes visited skipping %q.\nexpected=%s\ngot=%s", tt.skip, tt.expected, got)
+		}
+	}
+}
+
+// depthVisitor records the nodes it visits indented by their depth.
+type depthVisitor struct {
+	depth int
+	out   *[]string
+}
+
+func (v depthVisitor) Visit(node Node) Visitor {
+	if node == nil {
+		*v.out = append(*v.out, strings.Repeat(".", v.depth-1)+"end")
+		return nil
+	}
+
+	*v.out = append(*v.out, strings.Repeat(".", v.depth)+describe(node))
+	return depthVisitor{depth: v.depth + 1, out: v.out}
+}
+
+func TestWalk(t *testing.T) {
+	program := &Program{Statements: []Statement{
+		// children that failed to parse are missing
+		&LetStatement{Name: ident("x")},
+		&ReturnStatement{ReturnValue: infix(ident("a"), "*", integer(2))},
+	}}
+
+	var visited []string
+	Walk(depthVisitor{out: &visited}, program)
+
+	expected := []string{
+		"Program",
+		".LetStatement",
+		"..x",
+		"..end",
+		".end",
+		".ReturnStatement",
+		"..InfixExpression",
+		"...a",
+		"...end",
+		"...2",
+		"...end",
+		"..end",
+		".end",
+		"end",
+	}
+
+	if strings.Join(visited, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong walk.\nexpected=\n%s\ngot=\n%s", strings.Join(expected, "\n"), strings.Join(visited, "\n"))
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		rewrite  func(Node) Node
+		expected string
+	}{
+		{
+			"keep everything",
+			func(node Node) Node { return node },
+			"let x = (1 + y);ifx f(x, 2.5)else s.lenfn(a)return (-a);true",
+		},
+		{
+			"rename identifiers",
+			func(node Node) Node {
+				if id, ok := node.(*Identifier); ok {
+					return ident(strings.ToUpper(id.Value))
+				}
+				return node
+			},
+			"let X = (1 + Y);ifX F(X, 2.5)else s.LENfn(A)return (-A);true",
+		},
+		{
+			"substitute and fold",
+			func(node Node) Node {
+				// children are rewritten first, so y is replaced
+				// before the addition is looked at
+				if id, ok := node.(*Identifier); ok && id.Value == "y" {
+					return integer(41)
+				}
+				if ie, ok := node.(*InfixExpression); ok {
+					left, leftOk := ie.Left.(*IntegerLiteral)
+					right, rightOk := ie.Right.(*IntegerLiteral)
+					if leftOk && rightOk {
+						return integer(left.Value + right.Value)
+					}
+				}
+				return node
+			},
+			"let x = 42;ifx f(x, 2.5)else s.lenfn(a)return (-a);true",
+		},
+		{
+			"remove expression statements",
+			func(node Node) Node {
+				if _, ok := node.(*ExpressionStatement); ok {
+					return nil
+				}
+				return node
+			},
+			"let x = (1 + y);",
+		},
+		{
+			"drop alternatives",
+			func(node Node) Node {
+				if ie, ok := node.(*IfExpression); ok {
+					ie.Alternative = nil
+				}
+				return node
+			},
+			"let x = (1 + y);ifx f(x, 2.5)fn(a)return (-a);true",
+		},
+	}
+
+	for _, tt := range tests {
+		got := Rewrite(testProgram(), tt.rewrite)
+		if got.String() != tt.expected {
+			t.Errorf("%s: wrong program.\nexpected=%s\ngot=%s", tt.name, tt.expected, got.String())
+		}
+	}
+}
+
+func TestRewritePanicsOnMisplacedNodes(t *testing.T) {
+	defer func() {
+		r := recover()
+		expected := "ast.Rewrite: *ast.IntegerLiteral cannot replace statement *ast.LetStatement"
+		if r != expected {
+			t.Errorf("wrong panic. expected=%q, got=%v", expected, r)
+		}
+	}()
+
+	Rewrite(testProgram(), func(node Node) Node {
+		if _, ok := node.(*LetStatement); ok {
+			return integer(1)
+		}
+		return node
+	})
+}
@@ -0,0 +1,519 @@
+// Package closure is an execution engine that compiles every node of a
+// resolved program once into a Go closure, so that running the program no
+// longer dispatches on the type of each node. It produces the same values
+// and errors as evaluator.Eval and enforces the same limits.
+package closure
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/resolver"
+)
+
+// Frame holds the variables of a function call in the slots the resolver
+// assigned to them. The top level of a program runs in a frame without
+// slots, laid out as Eval lays them out.
+type Frame struct {
+	Globals *object.Environment
+	evaluator.Slots
+
+	meter *evaluator.Meter
+}
+
+// code is a compiled node.
+type code func(f *Frame) object.Object
+
+// Program is a program compiled into closures. It is never modified by
+// running it, so it may be run by any number of goroutines at once.
+type Program struct {
+	run code
+}
+
+// Compile compiles program, resolving it first if that has not happened
+// yet.
+func Compile(program *ast.Program) *Program {
+	if !program.Resolved {
+		resolver.Resolve(program, nil)
+	}
+
+	return &Program{run: compileProgram(program)}
+}
+
+// Run runs the program in env without any resource limits.
+func (p *Program) Run(env *object.Environment) object.Object {
+	result, _ := p.RunContext(context.Background(), env, evaluator.Limits{})
+	return result
+}
+
+// RunContext runs the program in env like evaluator.EvalContext evaluates
+// it: script errors are returned as *object.Error values, while the error
+// result is reserved for runs aborted by ctx or by limits.
+func (p *Program) RunContext(ctx context.Context, env *object.Environment, limits evaluator.Limits) (object.Object, error) {
+	f := &Frame{Globals: env, meter: evaluator.MeterFor(ctx, limits)}
+
+	result := p.run(f)
+	if err := f.meter.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CallContext calls fn, which must be a Function or a builtin, with args.
+// Like RunContext it returns a non-nil error only when the call has been
+// aborted. Like evaluator.CallContext it charges calls made with the
+// context handed to a builtin to the evaluation that called it.
+func CallContext(ctx context.Context, fn object.Object, args []object.Object, limits evaluator.Limits) (object.Object, error) {
+	f := &Frame{meter: evaluator.MeterFor(ctx, limits)}
+
+	result := applyFunction(f, fn, args)
+	if err := f.meter.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Function is a function created by compiled code.
+type Function struct {
+	Literal *ast.FunctionLiteral
+	Env     *object.Environment
+	Free    []*object.Cell
+
+	body code
+}
+
+func (fn *Function) Inspect() string {
+	return (&object.Function{Parameters: fn.Literal.Parameters, Body: fn.Literal.Body}).Inspect()
+}
+
+func (fn *Function) Type() object.ObjectType { return object.FUNCTION_OBJ }
+
+// step wraps c so that evaluating it counts as a step, just like every node
+// Eval visits does.
+func step(c code) code {
+	return func(f *Frame) object.Object {
+		if !f.meter.Step() {
+			return f.meter.Aborted()
+		}
+
+		return c(f)
+	}
+}
+
+func compile(node ast.Node) code {
+	switch node := node.(type) {
+	case *ast.Program:
+		return compileProgram(node)
+	case *ast.ExpressionStatement:
+		return step(compile(node.Expression))
+	case *ast.BlockStatement:
+		return compileBlock(node, false)
+	case *ast.LetStatement:
+		return compileLet(node)
+	case *ast.ReturnStatement:
+		return compileReturn(node)
+	case *ast.PrefixExpression:
+		return compilePrefix(node)
+	case *ast.InfixExpression:
+		return compileInfix(node)
+	case *ast.IfExpression:
+		return compileIf(node)
+	case *ast.CallExpression:
+		return compileCall(node)
+	case *ast.MemberExpression:
+		return compileMember(node)
+	case *ast.FunctionLiteral:
+		return compileFunctionLiteral(node)
+	case *ast.Identifier:
+		return compileIdentifier(node)
+	case *ast.IntegerLiteral:
+		return compileConstant(object.NewInteger(node.Value))
+	case *ast.FloatLiteral:
+		return compileConstant(&object.Float{Value: node.Value})
+	case *ast.StringLiteral:
+		return compileConstant(&object.String{Value: node.Value})
+	case *ast.BooleanLiteral:
+		value := object.NativeBoolToBoolean(node.Value)
+		return step(func(f *Frame) object.Object { return value })
+	}
+
+	return step(func(f *Frame) object.Object { return nil })
+}
+
+func compileProgram(program *ast.Program) code {
+	statements := compileStatements(program.Statements, true)
+
+	return step(func(f *Frame) object.Object {
+		var result object.Object
+
+		for _, s := range statements {
+			result = s(f)
+
+			switch result := result.(type) {
+			case *object.ReturnValue:
+				return result.Value
+			case *object.Error:
+				return result
+			}
+		}
+
+		return result
+	})
+}
+
+// compileBlock compiles a block, which is the body of a function if body is
+// set.
+func compileBlock(block *ast.BlockStatement, body bool) code {
+	statements := compileStatements(block.Statements, body)
+
+	return step(func(f *Frame) object.Object {
+		var result object.Object
+
+		for _, s := range statements {
+			result = s(f)
+			if result != nil {
+				rt := result.Type()
+				if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+					return result
+				}
+			}
+		}
+
+		return result
+	})
+}
+
+// compileStatements compiles statements, which end a function body or the
+// program if tail is set.
+func compileStatements(statements []ast.Statement, tail bool) []code {
+	compiled := make([]code, len(statements))
+	for i, s := range statements {
+		if ret, ok := s.(*ast.ReturnStatement); ok && tail && i == len(statements)-1 {
+			compiled[i] = compileTailReturn(ret)
+			continue
+		}
+		compiled[i] = compile(s)
+	}
+
+	return compiled
+}
+
+func compileLet(node *ast.LetStatement) code {
+	value := compile(node.Value)
+	set := compileSet(node.Name)
+
+	return step(func(f *Frame) object.Object {
+		val := value(f)
+		if isError(val) {
+			return val
+		}
+
+		set(f, val)
+
+		return nil
+	})
+}
+
+func compileReturn(node *ast.ReturnStatement) code {
+	value := compile(node.ReturnValue)
+
+	return step(func(f *Frame) object.Object {
+		val := value(f)
+		if isError(val) {
+			return val
+		}
+
+		return &object.ReturnValue{Value: val}
+	})
+}
+
+// compileTailReturn compiles a return ending a function body or the program,
+// which has nothing left to skip, so its value need not be wrapped.
+func compileTailReturn(node *ast.ReturnStatement) code {
+	return step(compile(node.ReturnValue))
+}
+
+// compileConstant compiles a literal. Objects are immutable, so every run
+// can share the same object; it is still accounted for as an allocation,
+// so that limits apply the same way they do in Eval.
+func compileConstant(value object.Object) code {
+	return step(func(f *Frame) object.Object {
+		return f.meter.Allocated(value)
+	})
+}
+
+func compilePrefix(node *ast.PrefixExpression) code {
+	right := compile(node.Right)
+	operator := node.Operator
+
+	return step(func(f *Frame) object.Object {
+		r := right(f)
+		if isError(r) {
+			return r
+		}
+
+		return f.meter.Allocated(evaluator.EvalPrefix(operator, r))
+	})
+}
+
+func compileInfix(node *ast.InfixExpression) code {
+	left := compile(node.Left)
+	right := compile(node.Right)
+	operator := node.Operator
+	integer := integerOperator(operator)
+
+	return step(func(f *Frame) object.Object {
+		r := right(f)
+		if isError(r) {
+			return r
+		}
+
+		l := left(f)
+		if isError(l) {
+			return l
+		}
+
+		if integer != nil {
+			if li, ok := l.(*object.Integer); ok {
+				if ri, ok := r.(*object.Integer); ok {
+					return f.meter.Allocated(integer(li.Value, ri.Value))
+				}
+			}
+		}
+
+		return f.meter.Allocated(evaluator.EvalInfix(operator, l, r))
+	})
+}
+
+// integerOperator returns a fast path for operator applied to two
+// integers, or nil if there is none.
+func integerOperator(operator string) func(l, r int64) object.Object {
+	switch operator {
+	case "+":
+		return func(l, r int64) object.Object { return object.NewInteger(l + r) }
+	case "-":
+		return func(l, r int64) object.Object { return object.NewInteger(l - r) }
+	case "*":
+		return func(l, r int64) object.Object { return object.NewInteger(l * r) }
+	case "<":
+		return func(l, r int64) object.Object { return object.NativeBoolToBoolean(l < r) }
+	case ">":
+		return func(l, r int64) object.Object { return object.NativeBoolToBoolean(l > r) }
+	case "==":
+		return func(l, r int64) object.Object { return object.NativeBoolToBoolean(l == r) }
+	case "!=":
+		return func(l, r int64) object.Object { return object.NativeBoolToBoolean(l != r) }
+	}
+
+	return nil
+}
+
+func compileIf(node *ast.IfExpression) code {
+	condition := compile(node.Condition)
+	consequence := compile(node.Consequence)
+
+	var alternative code
+	if node.Alternative != nil {
+		alternative = compile(node.Alternative)
+	}
+
+	return step(func(f *Frame) object.Object {
+		c := condition(f)
+		if isError(c) {
+			return c
+		}
+
+		if evaluator.IsTruthy(c) {
+			return consequence(f)
+		} else if alternative != nil {
+			return alternative(f)
+		}
+
+		return object.NULL
+	})
+}
+
+func compileCall(node *ast.CallExpression) code {
+	function := compile(node.Function)
+	arguments := compileExpressions(node.Arguments)
+
+	return step(func(f *Frame) object.Object {
+		fn := function(f)
+		if isError(fn) {
+			return fn
+		}
+
+		args := make([]object.Object, 0, len(arguments))
+		for _, a := range arguments {
+			arg := a(f)
+			if isError(arg) {
+				return arg
+			}
+			args = append(args, arg)
+		}
+
+		return applyFunction(f, fn, args)
+	})
+}
+
+func compileExpressions(expressions []ast.Expression) []code {
+	compiled := make([]code, len(expressions))
+	for i, e := range expressions {
+		compiled[i] = compile(e)
+	}
+
+	return compiled
+}
+
+func compileMember(node *ast.MemberExpression) code {
+	obj := compile(node.Object)
+	name := node.Property.Value
+
+	return step(func(f *Frame) object.Object {
+		o := obj(f)
+		if isError(o) {
+			return o
+		}
+
+		return f.meter.Allocated(evaluator.EvalMember(o, name))
+	})
+}
+
+func compileFunctionLiteral(node *ast.FunctionLiteral) code {
+	body := compileBlock(node.Body, true)
+	layout := node.Layout
+
+	return step(func(f *Frame) object.Object {
+		return f.meter.Allocated(&Function{
+			Literal: node,
+			Env:     f.Globals,
+			Free:    f.Capture(layout),
+			body:    body,
+		})
+	})
+}
+
+func compileIdentifier(node *ast.Identifier) code {
+	name := node.Value
+	return step(compileGet(node, func(f *Frame) object.Object {
+		return newError("identifier not found: %s", name)
+	}))
+}
+
+// compileGet compiles reading the variable ident, which runs notFound when
+// neither the variable nor any it shadows is bound.
+func compileGet(ident *ast.Identifier, notFound code) code {
+	name := ident.Value
+	index := ident.Index
+	if ident.Shadowed != nil {
+		notFound = compileGet(ident.Shadowed, notFound)
+	}
+
+	switch ident.Scope {
+	case ast.Local:
+		return func(f *Frame) object.Object {
+			if val := f.Locals[index]; val != nil {
+				return val
+			}
+			return notFound(f)
+		}
+	case ast.Cell:
+		return func(f *Frame) object.Object {
+			if val := f.Cells[index].Value; val != nil {
+				return val
+			}
+			return notFound(f)
+		}
+	case ast.Free:
+		return func(f *Frame) object.Object {
+			if val := f.Free[index].Value; val != nil {
+				return val
+			}
+			return notFound(f)
+		}
+	}
+
+	return func(f *Frame) object.Object {
+		if val, ok := f.Globals.Get(name); ok {
+			return val
+		}
+		return notFound(f)
+	}
+}
+
+// compileSet compiles the assignment of a value to the variable ident.
+func compileSet(ident *ast.Identifier) func(f *Frame, val object.Object) {
+	name := ident.Value
+	index := ident.Index
+
+	switch ident.Scope {
+	case ast.Local:
+		return func(f *Frame, val object.Object) { f.Locals[index] = val }
+	case ast.Cell:
+		return func(f *Frame, val object.Object) { f.Cells[index].Value = val }
+	}
+
+	return func(f *Frame, val object.Object) { f.Globals.Set(name, val) }
+}
+
+func applyFunction(f *Frame, fn object.Object, args []object.Object) object.Object {
+	switch function := fn.(type) {
+	case *Function:
+		params := function.Literal.Parameters
+		if len(args) != len(params) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(params), len(args))
+		}
+
+		if !f.meter.EnterCall() {
+			return f.meter.Aborted()
+		}
+		defer f.meter.ExitCall()
+
+		if !f.meter.Alloc() {
+			return f.meter.Aborted()
+		}
+
+		evaluated := function.body(newFrame(f, function, args))
+		if returnValue, ok := evaluated.(*object.ReturnValue); ok {
+			return returnValue.Value
+		}
+		if evaluated == nil {
+			// the body is empty or ends with a let statement
+			return object.NULL
+		}
+		return evaluated
+	case *object.Builtin:
+		if !f.meter.EnterCall() {
+			return f.meter.Aborted()
+		}
+		defer f.meter.ExitCall()
+
+		result := function.Call(f.meter.Context(), args...)
+		if result == nil {
+			return object.NULL
+		}
+		return f.meter.Allocated(result)
+	default:
+		return newError("not a function: %s", fn.Type())
+	}
+}
+
+func newFrame(caller *Frame, fn *Function, args []object.Object) *Frame {
+	f := &Frame{Globals: fn.Env, meter: caller.meter}
+	f.Init(fn.Literal.Layout, fn.Free, fn.Literal.Parameters, args)
+
+	return f
+}
+
+func isError(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.ERROR_OBJ
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
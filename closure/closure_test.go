@@ -0,0 +1,118 @@
+package closure
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/internal/enginetest"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+)
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func TestMatchesEvaluator(t *testing.T) {
+	enginetest.Run(t, func(program *ast.Program) (object.Object, error) {
+		return Compile(program).Run(object.NewEnvironment()), nil
+	})
+}
+
+func TestShadowedVariables(t *testing.T) {
+	inputs := []string{
+		"let x = 10; let f = fn() { let y = x; let x = 5; y }; f();",
+		"let x = 5; let f = fn() { if (false) { let x = 1; } x }; f();",
+		"let x = 1; let f = fn(b) { if (b) { let x = 2; } x }; f(false);",
+		"let f = fn(x) { fn() { let y = x; let x = 2; y + x } }; f(1)();",
+		"let x = 1; let f = fn() { let g = fn() { x }; let r = g(); let x = 2; r + g() }; f();",
+		"let f = fn() { if (false) { let y = 1; } y }; f();",
+	}
+
+	for _, input := range inputs {
+		program := parse(input)
+		got := Compile(program).Run(object.NewEnvironment())
+		expected := evaluator.Eval(program, object.NewEnvironment())
+
+		if !enginetest.Equal(expected, got) {
+			t.Errorf("%q: results differ. Eval=%s, got=%s", input, expected.Inspect(), got.Inspect())
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		limits   evaluator.Limits
+		expected error
+	}{
+		{evaluator.Limits{MaxSteps: 1000}, evaluator.ErrStepLimitExceeded},
+		{evaluator.Limits{MaxAllocations: 1000}, evaluator.ErrAllocationLimitExceeded},
+		{evaluator.Limits{MaxCallDepth: 100}, evaluator.ErrDepthLimitExceeded},
+	}
+
+	program := Compile(parse("let loop = fn(n) { loop(n + 1) }; loop(0);"))
+
+	for _, tt := range tests {
+		_, err := program.RunContext(context.Background(), object.NewEnvironment(), tt.limits)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("wrong error. expected=%v, got=%v", tt.expected, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := program.RunContext(ctx, object.NewEnvironment(), evaluator.Limits{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("wrong error. expected=%v, got=%v", context.Canceled, err)
+	}
+}
+
+func TestCallContext(t *testing.T) {
+	env := object.NewEnvironment()
+	Compile(parse("let add = fn(a, b) { a + b };")).Run(env)
+
+	add, _ := env.Get("add")
+	result, err := CallContext(context.Background(), add, []object.Object{
+		&object.Integer{Value: 2}, &object.Integer{Value: 3},
+	}, evaluator.Limits{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if result.Inspect() != "5" {
+		t.Errorf("wrong result. expected=5, got=%s", result.Inspect())
+	}
+}
+
+const (
+	fibonacci      = "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(20);"
+	stringBuilding = `let build = fn(n, acc) { if (n == 0) { acc } else { build(n - 1, acc + "monkey") } }; build(500, "");`
+)
+
+func benchmarkEval(b *testing.B, input string) {
+	program := parse(input)
+
+	for i := 0; i < b.N; i++ {
+		evaluator.Eval(program, object.NewEnvironment())
+	}
+}
+
+func benchmarkClosures(b *testing.B, input string) {
+	program := Compile(parse(input))
+
+	for i := 0; i < b.N; i++ {
+		program.Run(object.NewEnvironment())
+	}
+}
+
+func BenchmarkFibonacciEval(b *testing.B)          { benchmarkEval(b, fibonacci) }
+func BenchmarkFibonacciClosures(b *testing.B)      { benchmarkClosures(b, fibonacci) }
+func BenchmarkStringBuildingEval(b *testing.B)     { benchmarkEval(b, stringBuilding) }
+func BenchmarkStringBuildingClosures(b *testing.B) { benchmarkClosures(b, stringBuilding) }
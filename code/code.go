@@ -0,0 +1,281 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpGreaterEqual
+	OpLessThan
+	OpLessEqual
+
+	OpMinus
+	OpBang
+
+	OpJumpNotTruthy
+	OpJump
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetFree
+	OpUndefined
+
+	OpGetMember
+
+	OpClosure
+	OpCall
+	OpReturnValue
+	OpReturn
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	// operand: absolute jump target
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+	OpGetLocal:  {"OpGetLocal", []int{1}},
+	OpSetLocal:  {"OpSetLocal", []int{1}},
+	// operands: how many functions up the variable lives, its local index
+	// and the constant index of its name
+	OpGetFree: {"OpGetFree", []int{1, 1, 2}},
+	// operand: constant index of the name that could not be resolved
+	OpUndefined: {"OpUndefined", []int{2}},
+
+	// operand: constant index of the member name
+	OpGetMember: {"OpGetMember", []int{2}},
+
+	// operand: constant index of the compiled function
+	OpClosure: {"OpClosure", []int{2}},
+	// operand: number of arguments
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make encodes op and its operands into a single instruction. Operands are
+// truncated to their widths, so those that may not fit have to go through
+// CheckOperands first.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// CheckOperands fails if an operand of op does not fit in the bytes Make
+// encodes it into.
+func CheckOperands(op Opcode, operands ...int) error {
+	def, err := Lookup(byte(op))
+	if err != nil {
+		return err
+	}
+
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		if max := 1<<(8*width) - 1; o < 0 || o > max {
+			return fmt.Errorf("operand %d of %s does not fit in %d byte(s), the maximum is %d", o, def.Name, width, max)
+		}
+	}
+
+	return nil
+}
+
+// ReadOperands decodes the operands of an instruction described by def and
+// returns them together with the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		text, width, err := ins.Format(i)
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			return out.String()
+		}
+
+		fmt.Fprintf(&out, "%04d %s\n", i, text)
+
+		i += width
+	}
+
+	return out.String()
+}
+
+// Format returns the text of the instruction at offset and its width in
+// bytes.
+func (ins Instructions) Format(offset int) (string, int, error) {
+	def, err := Lookup(ins[offset])
+	if err != nil {
+		return "", 0, err
+	}
+
+	if offset+1+operandsWidth(def) > len(ins) {
+		return "", 0, fmt.Errorf("truncated %s at %04d", def.Name, offset)
+	}
+
+	operands, read := ReadOperands(def, ins[offset+1:])
+
+	return ins.fmtInstruction(def, operands), 1 + read, nil
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	case 3:
+		return fmt.Sprintf("%s %d %d %d", def.Name, operands[0], operands[1], operands[2])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+func operandsWidth(def *Definition) int {
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+
+	return width
+}
+
+// SourcePosition tells that the instructions from Offset on were compiled
+// from the source at Line and Column.
+type SourcePosition struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// SourceMap maps instruction offsets back to the source. Its positions are
+// ordered by offset, and each one holds until the next.
+type SourceMap []SourcePosition
+
+// Lookup returns the source position of the instruction at offset.
+func (sm SourceMap) Lookup(offset int) (SourcePosition, bool) {
+	i := sort.Search(len(sm), func(i int) bool { return sm[i].Offset > offset })
+	if i == 0 {
+		return SourcePosition{}, false
+	}
+
+	return sm[i-1], true
+}
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cupsadarius/monkey_interpreter/compiler"
+	"github.com/cupsadarius/monkey_interpreter/coverage"
+	"github.com/cupsadarius/monkey_interpreter/dap"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/format"
+	"github.com/cupsadarius/monkey_interpreter/interpreter"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/lint"
+	"github.com/cupsadarius/monkey_interpreter/lsp"
+	"github.com/cupsadarius/monkey_interpreter/mkc"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+	"github.com/cupsadarius/monkey_interpreter/profiler"
+	"github.com/cupsadarius/monkey_interpreter/resolver"
+	"github.com/cupsadarius/monkey_interpreter/testrunner"
+	"github.com/cupsadarius/monkey_interpreter/vm"
+)
+
+type command struct {
+	usage string
+	run   func(args []string, stdout, stderr io.Writer) int
+}
+
+var commands = map[string]command{
+	"run":     {"run [-trace] <file.mk>\tcompile and run a script, caching the bytecode in <file.mkc>", runScript},
+	"ast":     {"ast <file.mk>\tprint the syntax tree of a script as JSON", dumpAST},
+	"cover":   {"cover [-html file.html] [-lcov file.info] <file.mk>...\trun scripts and report which of their lines ran", cover},
+	"dap":     {"dap\tstart a debug adapter speaking on the standard input and output", serveDAP},
+	"disasm":  {"disasm <file.mk>\tprint the bytecode of a script", disassemble},
+	"fmt":     {"fmt [-l] [-w] [file.mk...]\tformat scripts, or the standard input, as canonical Monkey source", formatSource},
+	"lint":    {"lint [-json] [-disable ids] [-severity id=severity,...] [-rules] <file.mk>...\treport suspicious code in scripts", lintFiles},
+	"lsp":     {"lsp\tstart a language server speaking on the standard input and output", serveLSP},
+	"profile": {"profile [-o file.pprof] [-sample interval] <file.mk>\trun a script and print the time spent in each function", profile},
+	"test":    {"test [-v] [-run regexp] [-timeout duration] [path...]\trun the tests of the *_test.mk files found in the paths", test},
+	"tokens":  {"tokens <file.mk>\tprint the tokens of a script as JSON", dumpTokens},
+}
+
+// runCommand runs the subcommand name and returns the exit code.
+func runCommand(name string, args []string) int {
+	cmd, ok := commands[name]
+	if !ok {
+		usage(os.Stderr)
+		return 2
+	}
+
+	return cmd.run(args, os.Stdout, os.Stderr)
+}
+
+func usage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "usage: monkey [command]")
+	fmt.Fprintln(w, "\nWithout a command the REPL is started. Commands:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\n", commands[name].usage)
+	}
+}
+
+func runScript(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	trace := flags.Bool("trace", false, "write every executed instruction and the stack to stderr")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprintln(stderr, "usage: monkey run [-trace] <file.mk>")
+		return 2
+	}
+
+	bytecode, err := mkc.Load(flags.Arg(0), mkc.WithWarnings(stderr))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	machine := vm.New(bytecode)
+	if *trace {
+		machine.Trace(stderr)
+	}
+	if err := machine.Run(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	result := machine.Result()
+	if errObj, ok := result.(*object.Error); ok {
+		fmt.Fprintln(stderr, errObj.Inspect())
+		return 1
+	}
+	if result != nil {
+		fmt.Fprintln(stdout, result.Inspect())
+	}
+
+	return 0
+}
+
+func disassemble(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(stderr, "usage: monkey disasm <file.mk>")
+		return 2
+	}
+
+	bytecode, err := mkc.Load(args[0], mkc.WithWarnings(stderr), mkc.ReadOnly())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	if err := compiler.Disassemble(stdout, bytecode); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+func serveDAP(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 0 {
+		fmt.Fprintln(stderr, "usage: monkey dap")
+		return 2
+	}
+
+	if err := dap.NewServer(os.Stdin, stdout).Serve(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+func serveLSP(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 0 {
+		fmt.Fprintln(stderr, "usage: monkey lsp")
+		return 2
+	}
+
+	if err := lsp.NewServer(os.Stdin, stdout).Serve(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+func dumpTokens(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(stderr, "usage: monkey tokens <file.mk>")
+		return 2
+	}
+
+	source, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	return writeJSON(stdout, stderr, lexer.New(string(source)).Tokens())
+}
+
+func dumpAST(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(stderr, "usage: monkey ast <file.mk>")
+		return 2
+	}
+
+	source, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(stderr, "%s: %s\n", args[0], msg)
+		}
+		return 1
+	}
+
+	return writeJSON(stdout, stderr, program)
+}
+
+// writeJSON writes v to stdout as indented JSON.
+func writeJSON(stdout, stderr io.Writer, v interface{}) int {
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+func profile(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("profile", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("o", "", "write a pprof profile to `file`")
+	sample := flags.Duration("sample", 0, "sample the call stack every `interval` instead of timing every call")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprintln(stderr, "usage: monkey profile [-o file.pprof] [-sample interval] <file.mk>")
+		return 2
+	}
+
+	path := flags.Arg(0)
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	opts := []profiler.Option{profiler.WithFilename(path)}
+	if *sample > 0 {
+		opts = append(opts, profiler.WithSampling(*sample))
+	}
+	p := profiler.New(opts...)
+
+	start := time.Now()
+	_, err = interpreter.New(interpreter.WithHook(p)).Run(string(source))
+	elapsed := time.Since(start)
+
+	status := 0
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		status = 1
+	}
+
+	fmt.Fprintf(stdout, "total time %s\n\n", elapsed)
+	p.WriteText(stdout)
+
+	if *output != "" {
+		if err := writeFile(*output, p.WritePprof); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	return status
+}
+
+func cover(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("cover", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	htmlOutput := flags.String("html", "", "write an HTML report to `file`")
+	lcovOutput := flags.String("lcov", "", "write an LCOV trace to `file`")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "usage: monkey cover [-html file.html] [-lcov file.info] <file.mk>...")
+		return 2
+	}
+
+	cov := coverage.New()
+	status := 0
+
+	for _, path := range flags.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+
+		p := parser.New(lexer.New(string(source)))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			for _, msg := range p.Errors() {
+				fmt.Fprintf(stderr, "%s: %s\n", path, msg)
+			}
+			return 1
+		}
+		resolver.Resolve(program, nil)
+
+		cov.Add(path, string(source), program)
+
+		result, err := evaluator.EvalContext(context.Background(), program, object.NewEnvironment(), evaluator.WithHook(cov))
+		if err == nil && result != nil && result.Type() == object.ERROR_OBJ {
+			err = fmt.Errorf("%s", result.Inspect())
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+			status = 1
+		}
+	}
+
+	cov.WriteText(stdout)
+
+	reports := []struct {
+		path  string
+		write func(io.Writer) error
+	}{
+		{*htmlOutput, cov.WriteHTML},
+		{*lcovOutput, cov.WriteLCOV},
+	}
+	for _, r := range reports {
+		if r.path == "" {
+			continue
+		}
+		if err := writeFile(r.path, r.write); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	return status
+}
+
+func formatSource(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	list := flags.Bool("l", false, "list the files whose formatting differs instead of printing them")
+	write := flags.Bool("w", false, "write the result back to the files instead of printing it")
+	if err := flags.Parse(args); err != nil {
+		fmt.Fprintln(stderr, "usage: monkey fmt [-l] [-w] [file.mk...]")
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+
+		formatted, err := format.Source(source)
+		if err != nil {
+			fmt.Fprintf(stderr, "<stdin>: %s\n", err)
+			return 1
+		}
+		stdout.Write(formatted)
+
+		return 0
+	}
+
+	status := 0
+
+	for _, path := range flags.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			status = 1
+			continue
+		}
+
+		formatted, err := format.Source(source)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+			status = 1
+			continue
+		}
+
+		changed := !bytes.Equal(source, formatted)
+		if *list && changed {
+			fmt.Fprintln(stdout, path)
+		}
+		if *write && changed {
+			if err := os.WriteFile(path, formatted, 0o644); err != nil {
+				fmt.Fprintln(stderr, err)
+				status = 1
+			}
+		}
+		if !*list && !*write {
+			stdout.Write(formatted)
+		}
+	}
+
+	return status
+}
+
+func lintFiles(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asJSON := flags.Bool("json", false, "print the diagnostics as a JSON array")
+	disable := flags.String("disable", "", "comma separated IDs of the rules to turn off")
+	severities := flags.String("severity", "", "comma separated id=severity pairs changing the severity of rules")
+	list := flags.Bool("rules", false, "list the rules instead of linting")
+	if err := flags.Parse(args); err != nil || (flags.NArg() == 0 && !*list) {
+		fmt.Fprintln(stderr, "usage: monkey lint [-json] [-disable ids] [-severity id=severity,...] [-rules] <file.mk>...")
+		return 2
+	}
+
+	if *list {
+		for _, r := range lint.Rules() {
+			fmt.Fprintf(stdout, "%-20s %-8s %s\n", r.ID, r.Severity, r.Doc)
+		}
+		return 0
+	}
+
+	var opts []lint.Option
+	for _, id := range splitList(*disable) {
+		if _, ok := lint.Lookup(id); !ok {
+			fmt.Fprintf(stderr, "unknown rule %q\n", id)
+			return 2
+		}
+		opts = append(opts, lint.WithDisabled(id))
+	}
+	for _, pair := range splitList(*severities) {
+		id, name, _ := strings.Cut(pair, "=")
+		severity, err := lint.ParseSeverity(name)
+		if _, ok := lint.Lookup(id); !ok || err != nil {
+			fmt.Fprintf(stderr, "invalid rule severity %q\n", pair)
+			return 2
+		}
+		opts = append(opts, lint.WithSeverity(id, severity))
+	}
+	linter := lint.New(opts...)
+
+	status := 0
+	diagnostics := []lint.Diagnostic{}
+
+	for _, path := range flags.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			status = 1
+			continue
+		}
+
+		found, err := linter.Lint(path, source)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+			status = 1
+			continue
+		}
+		diagnostics = append(diagnostics, found...)
+	}
+
+	if len(diagnostics) > 0 {
+		status = 1
+	}
+
+	if *asJSON {
+		if writeJSON(stdout, stderr, diagnostics) != 0 {
+			return 1
+		}
+		return status
+	}
+
+	for _, d := range diagnostics {
+		fmt.Fprintln(stdout, d)
+	}
+
+	return status
+}
+
+// splitList splits a comma separated flag value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func test(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	verbose := flags.Bool("v", false, "report tests that pass too")
+	run := flags.String("run", "", "run only the tests whose names match `regexp`")
+	timeout := flags.Duration("timeout", testrunner.DefaultTimeout, "fail tests running longer than `duration`")
+	if err := flags.Parse(args); err != nil {
+		fmt.Fprintln(stderr, "usage: monkey test [-v] [-run regexp] [-timeout duration] [path...]")
+		return 2
+	}
+
+	opts := []testrunner.Option{testrunner.WithTimeout(*timeout)}
+	if *verbose {
+		opts = append(opts, testrunner.WithVerbose())
+	}
+	if *run != "" {
+		filter, err := regexp.Compile(*run)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		opts = append(opts, testrunner.WithFilter(filter))
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := testrunner.Find(paths...)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(stderr, "no test files found")
+		return 1
+	}
+
+	if summary := testrunner.New(stdout, opts...).Run(files); summary.Failed > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// writeFile creates the file at path and writes it with write.
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/mkc"
+)
+
+func runCLI(name string, args ...string) (status int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	status = commands[name].run(args, &out, &errOut)
+
+	return status, out.String(), errOut.String()
+}
+
+func TestRunAndDisassembleCompiledFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(path, []byte("let double = fn(x) { x * 2 };\ndouble(21);\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	checkRun := func(when string) {
+		t.Helper()
+
+		status, stdout, stderr := runCLI("run", path)
+		if status != 0 || stdout != "42\n" || stderr != "" {
+			t.Errorf("%s: wrong run. status=%d, stdout=%q, stderr=%q", when, status, stdout, stderr)
+		}
+	}
+
+	checkRun("compiling")
+
+	compiled, err := os.ReadFile(mkc.CachePath(path))
+	if err != nil {
+		t.Fatalf("no compiled file written: %s", err)
+	}
+
+	checkRun("loading the compiled file")
+
+	status, disasm, stderr := runCLI("disasm", path)
+	if status != 0 || stderr != "" {
+		t.Fatalf("wrong disasm. status=%d, stderr=%q", status, stderr)
+	}
+	for _, expected := range []string{"OpClosure", "OpCall 1", "OpMul"} {
+		if !strings.Contains(disasm, expected) {
+			t.Errorf("disasm does not contain %q:\n%s", expected, disasm)
+		}
+	}
+
+	// a corrupted file is compiled again from the source
+	corrupted := append([]byte{}, compiled...)
+	for i := len(corrupted) / 2; i < len(corrupted); i++ {
+		corrupted[i] = 0xff
+	}
+	for _, data := range [][]byte{corrupted, compiled[:len(compiled)/2], []byte("MKC")} {
+		if err := os.WriteFile(mkc.CachePath(path), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		// disasm reports it without replacing it
+		status, got, stderr := runCLI("disasm", path)
+		if status != 0 || got != disasm || !strings.Contains(stderr, "compiling "+path+" instead") {
+			t.Errorf("wrong disasm of a corrupted file. status=%d, stderr=%q, got:\n%s", status, stderr, got)
+		}
+		if unchanged, _ := os.ReadFile(mkc.CachePath(path)); !bytes.Equal(unchanged, data) {
+			t.Errorf("corrupted file replaced by disasm")
+		}
+
+		status, stdout, stderr := runCLI("run", path)
+		if status != 0 || stdout != "42\n" || !strings.Contains(stderr, "compiling "+path+" instead") {
+			t.Errorf("wrong run of a corrupted file. status=%d, stdout=%q, stderr=%q", status, stdout, stderr)
+		}
+	}
+
+	repaired, err := os.ReadFile(mkc.CachePath(path))
+	if err != nil || !bytes.Equal(repaired, compiled) {
+		t.Errorf("corrupted file not replaced. err=%v", err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		source string
+		status int
+		stderr string
+	}{
+		{"let x = ;", 1, "parse error"},
+		{"1 + true;", 1, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for i, tt := range tests {
+		path := filepath.Join(dir, string(rune('a'+i))+".mk")
+		if err := os.WriteFile(path, []byte(tt.source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		status, _, stderr := runCLI("run", path)
+		if status != tt.status || !strings.Contains(stderr, tt.stderr) {
+			t.Errorf("%q: wrong result. status=%d, stderr=%q", tt.source, status, stderr)
+		}
+	}
+
+	if status, _, _ := runCLI("run", filepath.Join(dir, "missing.mk")); status != 1 {
+		t.Errorf("wrong status for a missing file. got=%d", status)
+	}
+	if status, _, _ := runCLI("disasm"); status != 2 {
+		t.Errorf("wrong status for a missing argument. got=%d", status)
+	}
+}
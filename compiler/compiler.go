@@ -0,0 +1,552 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/code"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/token"
+)
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+type CompilationScope struct {
+	instructions        code.Instructions
+	sourceMap           code.SourceMap
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+}
+
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// position of the node being compiled, recorded in the source maps
+	line, column int
+
+	// the first operand that did not fit in its instruction, returned by
+	// Compile since instructions are emitted without checking for errors
+	err error
+}
+
+// Bytecode is a compiled program: the instructions of its top level with
+// their source map, the constant pool and the names of its globals, ordered
+// by index.
+type Bytecode struct {
+	Instructions code.Instructions
+	SourceMap    code.SourceMap
+	Constants    []object.Object
+	GlobalNames  []string
+}
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	">=": code.OpGreaterEqual,
+	"<":  code.OpLessThan,
+	"<=": code.OpLessEqual,
+}
+
+func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions: code.Instructions{},
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: NewSymbolTable(),
+		scopes:      []CompilationScope{mainScope},
+	}
+}
+
+// NewWithState creates a compiler that continues where a previous one
+// stopped, which lets a REPL compile line after line against the same
+// globals.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+
+	return compiler
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	if tok, ok := nodeToken(node); ok && tok.Line > 0 {
+		line, column := c.line, c.column
+		c.line, c.column = tok.Line, tok.Column
+		defer func() { c.line, c.column = line, column }()
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		c.declare(node.Statements)
+
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		symbol := c.symbolTable.Define(node.Name.Value)
+
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+		// the evaluator evaluates the right operand first, so the
+		// compiled code does so as well
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+
+		c.emit(op)
+
+	case *ast.IfExpression:
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileBranch(node.Consequence); err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else if err := c.compileBranch(node.Alternative); err != nil {
+			return err
+		}
+
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	case *ast.IntegerLiteral:
+		integer := object.NewInteger(node.Value)
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.BooleanLiteral:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.Identifier:
+		c.loadIdentifier(node.Value)
+
+	case *ast.MemberExpression:
+		if err := c.Compile(node.Object); err != nil {
+			return err
+		}
+
+		name := &object.String{Value: node.Property.Value}
+		c.emit(code.OpGetMember, c.addConstant(name))
+
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
+
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+
+	return c.err
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
+		Constants:    c.constants,
+		GlobalNames:  c.globalTable().Names(),
+	}
+}
+
+// SymbolTable returns the symbol table of the globals.
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.globalTable()
+}
+
+func (c *Compiler) Constants() []object.Object {
+	return c.constants
+}
+
+func (c *Compiler) globalTable() *SymbolTable {
+	table := c.symbolTable
+	for table.Outer != nil {
+		table = table.Outer
+	}
+
+	return table
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.enterScope()
+
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+	c.declare(node.Body.Statements)
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	locals := c.symbolTable.Names()
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	instructions := c.leaveScope()
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     len(locals),
+		NumParameters: len(node.Parameters),
+		LocalNames:    locals,
+		SourceMap:     sourceMap,
+	}
+
+	c.emit(code.OpClosure, c.addConstant(compiledFn))
+
+	return nil
+}
+
+// compileBranch compiles the block of an if expression so that it leaves
+// exactly one value on the stack.
+func (c *Compiler) compileBranch(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+func (c *Compiler) loadIdentifier(name string) {
+	symbol, ok := c.symbolTable.Resolve(name)
+	if !ok {
+		c.emit(code.OpUndefined, c.addConstant(&object.String{Value: name}))
+		return
+	}
+
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, symbol.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, symbol.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, symbol.Depth, symbol.Index, c.addConstant(&object.String{Value: name}))
+	}
+}
+
+// declare defines every name bound by a let statement in statements before
+// any of them is compiled. Blocks don't open a new scope, so lets nested in
+// if expressions count as well, while function literals are left alone. This
+// way functions can refer to names that are bound after them, just like they
+// can when they are evaluated.
+func (c *Compiler) declare(statements []ast.Statement) {
+	for _, s := range statements {
+		c.declareNode(s)
+	}
+}
+
+func (c *Compiler) declareNode(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		c.symbolTable.Define(node.Name.Value)
+		c.declareNode(node.Value)
+	case *ast.ReturnStatement:
+		c.declareNode(node.ReturnValue)
+	case *ast.ExpressionStatement:
+		c.declareNode(node.Expression)
+	case *ast.BlockStatement:
+		c.declare(node.Statements)
+	case *ast.IfExpression:
+		c.declareNode(node.Condition)
+		c.declareNode(node.Consequence)
+		if node.Alternative != nil {
+			c.declareNode(node.Alternative)
+		}
+	case *ast.PrefixExpression:
+		c.declareNode(node.Right)
+	case *ast.InfixExpression:
+		c.declareNode(node.Left)
+		c.declareNode(node.Right)
+	case *ast.CallExpression:
+		c.declareNode(node.Function)
+		for _, a := range node.Arguments {
+			c.declareNode(a)
+		}
+	case *ast.MemberExpression:
+		c.declareNode(node.Object)
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands...)
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+	c.mapSource(pos)
+
+	return pos
+}
+
+// checkOperands records the first operand of the program that does not
+// fit in its instruction.
+func (c *Compiler) checkOperands(op code.Opcode, operands ...int) {
+	if c.err != nil {
+		return
+	}
+
+	c.err = code.CheckOperands(op, operands...)
+}
+
+// mapSource records that the instruction at pos belongs to the node being
+// compiled.
+func (c *Compiler) mapSource(pos int) {
+	if c.line == 0 {
+		return
+	}
+
+	scope := &c.scopes[c.scopeIndex]
+	if n := len(scope.sourceMap); n > 0 {
+		last := scope.sourceMap[n-1]
+		if last.Line == c.line && last.Column == c.column {
+			return
+		}
+		if last.Offset == pos {
+			scope.sourceMap = scope.sourceMap[:n-1]
+		}
+	}
+
+	scope.sourceMap = append(scope.sourceMap, code.SourcePosition{Offset: pos, Line: c.line, Column: c.column})
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	updatedInstructions := append(c.currentInstructions(), ins...)
+
+	c.scopes[c.scopeIndex].instructions = updatedInstructions
+
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	old := c.currentInstructions()
+	c.scopes[c.scopeIndex].instructions = old[:last.Position]
+	c.scopes[c.scopeIndex].lastInstruction = previous
+
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	for len(sourceMap) > 0 && sourceMap[len(sourceMap)-1].Offset >= last.Position {
+		sourceMap = sourceMap[:len(sourceMap)-1]
+	}
+	c.scopes[c.scopeIndex].sourceMap = sourceMap
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.checkOperands(op, operand)
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions: code.Instructions{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+// nodeToken returns the token a node starts at.
+func nodeToken(node ast.Node) (token.Token, bool) {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		return node.Token, true
+	case *ast.ReturnStatement:
+		return node.Token, true
+	case *ast.ExpressionStatement:
+		return node.Token, true
+	case *ast.BlockStatement:
+		return node.Token, true
+	case *ast.Identifier:
+		return node.Token, true
+	case *ast.IntegerLiteral:
+		return node.Token, true
+	case *ast.FloatLiteral:
+		return node.Token, true
+	case *ast.StringLiteral:
+		return node.Token, true
+	case *ast.BooleanLiteral:
+		return node.Token, true
+	case *ast.FunctionLiteral:
+		return node.Token, true
+	case *ast.PrefixExpression:
+		return node.Token, true
+	case *ast.InfixExpression:
+		return node.Token, true
+	case *ast.IfExpression:
+		return node.Token, true
+	case *ast.CallExpression:
+		return node.Token, true
+	case *ast.MemberExpression:
+		return node.Token, true
+	}
+
+	return token.Token{}, false
+}
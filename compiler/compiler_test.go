@@ -0,0 +1,282 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/code"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestCompile(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{2, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1; !true",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+				code.Make(code.OpTrue),
+				code.Make(code.OpBang),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 10),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 11),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let one = 1; one;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"monkey".length`,
+			expectedConstants: []interface{}{"monkey", "length"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpGetMember, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "missing",
+			expectedConstants: []interface{}{"missing"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpUndefined, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(a) { let b = a; fn() { b } }(1)",
+			expectedConstants: []interface{}{
+				"b",
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 1, 1, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpClosure, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestHoistedGlobals(t *testing.T) {
+	program := parser.New(lexer.New("let f = fn() { g() }; let g = fn() { 1 };")).ParseProgram()
+
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	names := compiler.Bytecode().GlobalNames
+	if len(names) != 2 || names[0] != "f" || names[1] != "g" {
+		t.Fatalf("wrong global names. got=%v", names)
+	}
+
+	fn := compiler.Bytecode().Constants[0].(*object.CompiledFunction)
+	expected := concatInstructions([]code.Instructions{
+		code.Make(code.OpGetGlobal, 1),
+		code.Make(code.OpCall, 0),
+		code.Make(code.OpReturnValue),
+	})
+	if fn.Instructions.String() != expected.String() {
+		t.Errorf("wrong instructions.\nwant=%q\ngot =%q", expected, fn.Instructions)
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	program := parser.New(lexer.New("let a = 1;\nlet f = fn(x) {\n  x + a;\n};\nf(2);")).ParseProgram()
+
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	tests := []struct {
+		sourceMap code.SourceMap
+		offset    int
+		line      int
+	}{
+		{bytecode.SourceMap, 0, 1},  // OpConstant 1
+		{bytecode.SourceMap, 3, 1},  // OpSetGlobal a
+		{bytecode.SourceMap, 6, 2},  // OpClosure
+		{bytecode.SourceMap, 13, 5}, // OpGetGlobal f
+		{bytecode.Constants[1].(*object.CompiledFunction).SourceMap, 0, 3},
+	}
+
+	for _, tt := range tests {
+		pos, ok := tt.sourceMap.Lookup(tt.offset)
+		if !ok {
+			t.Errorf("no position for offset %d", tt.offset)
+			continue
+		}
+		if pos.Line != tt.line {
+			t.Errorf("wrong line for offset %d. expected=%d, got=%d", tt.offset, tt.line, pos.Line)
+		}
+	}
+}
+
+func TestOperandLimits(t *testing.T) {
+	// lets need distinct names, which can't contain digits
+	name := func(n int) string {
+		return "v" + string(rune('a'+n/26/26)) + string(rune('a'+n/26%26)) + string(rune('a'+n%26))
+	}
+	call := func(args int) string {
+		return "let f = fn() { 1 }; f(" + strings.Repeat("1, ", args-1) + "1);"
+	}
+	locals := func(n int) string {
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&b, "let %s = 1; ", name(i))
+		}
+		return "fn() { " + b.String() + "};"
+	}
+	jump := func(statements int) string {
+		// the jump over the alternative goes to 4*statements + 7
+		return "if (true) { " + strings.Repeat("1; ", statements) + "};"
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{call(255), ""},
+		{call(256), "operand 256 of OpCall does not fit in 1 byte(s), the maximum is 255"},
+		{strings.Repeat("1;", 65536), ""},
+		{strings.Repeat("1;", 65537), "operand 65536 of OpConstant does not fit in 2 byte(s), the maximum is 65535"},
+		{locals(256), ""},
+		{locals(257), "operand 256 of OpSetLocal does not fit in 1 byte(s), the maximum is 255"},
+		{jump(16382), ""},
+		{jump(16383), "operand 65538 of OpJumpNotTruthy does not fit in 2 byte(s), the maximum is 65535"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		err := New().Compile(program)
+
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.expected {
+			t.Errorf("wrong error for an input of %d bytes. expected=%q, got=%q", len(tt.input), tt.expected, got)
+		}
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		compiler := New()
+		if err := compiler.Compile(program); err != nil {
+			t.Fatalf("%q: compiler error: %s", tt.input, err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		expected := concatInstructions(tt.expectedInstructions)
+		if bytecode.Instructions.String() != expected.String() {
+			t.Errorf("%q: wrong instructions.\nwant=%q\ngot =%q", tt.input, expected, bytecode.Instructions)
+		}
+
+		testConstants(t, tt.input, tt.expectedConstants, bytecode.Constants)
+	}
+}
+
+func testConstants(t *testing.T, input string, expected []interface{}, actual []object.Object) {
+	t.Helper()
+
+	if len(expected) != len(actual) {
+		t.Errorf("%q: wrong number of constants. want=%d, got=%d", input, len(expected), len(actual))
+		return
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				t.Errorf("%q: constant %d wrong. want=%d, got=%s", input, i, constant, actual[i].Inspect())
+			}
+		case string:
+			str, ok := actual[i].(*object.String)
+			if !ok || str.Value != constant {
+				t.Errorf("%q: constant %d wrong. want=%q, got=%s", input, i, constant, actual[i].Inspect())
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				t.Errorf("%q: constant %d not a function. got=%T", input, i, actual[i])
+				continue
+			}
+			want := concatInstructions(constant)
+			if fn.Instructions.String() != want.String() {
+				t.Errorf("%q: constant %d has wrong instructions.\nwant=%q\ngot =%q", input, i, want, fn.Instructions)
+			}
+		}
+	}
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+
+	return out
+}
@@ -0,0 +1,132 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cupsadarius/monkey_interpreter/code"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+// Disassemble writes a listing of bytecode: the top-level instructions
+// followed by those of every function in the constant pool. Each line
+// shows the offset of an instruction, the source line it was compiled
+// from, the instruction and what its operands refer to.
+func Disassemble(w io.Writer, bytecode *Bytecode) error {
+	main := &object.CompiledFunction{Instructions: bytecode.Instructions, SourceMap: bytecode.SourceMap}
+	if err := disassembleFunction(w, "main", main, bytecode); err != nil {
+		return err
+	}
+
+	for i, constant := range bytecode.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		params := fn.LocalNames
+		if len(params) > fn.NumParameters {
+			params = params[:fn.NumParameters]
+		}
+
+		title := fmt.Sprintf("function %d (%s)", i, strings.Join(params, ", "))
+		if err := disassembleFunction(w, title, fn, bytecode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func disassembleFunction(w io.Writer, title string, fn *object.CompiledFunction, bytecode *Bytecode) error {
+	if _, err := fmt.Fprintf(w, "== %s ==\n", title); err != nil {
+		return err
+	}
+
+	line := 0
+	for offset := 0; offset < len(fn.Instructions); {
+		text, width, err := FormatInstruction(fn, offset, bytecode.Constants, bytecode.GlobalNames)
+		if err != nil {
+			_, err := fmt.Fprintf(w, "%04d ERROR: %s\n", offset, err)
+			return err
+		}
+
+		column := "   |"
+		if pos, ok := fn.SourceMap.Lookup(offset); ok && pos.Line != line {
+			line = pos.Line
+			column = fmt.Sprintf("%4d", line)
+		}
+
+		if _, err := fmt.Fprintf(w, "%04d %s %s\n", offset, column, text); err != nil {
+			return err
+		}
+
+		offset += width
+	}
+
+	return nil
+}
+
+// FormatInstruction returns the text of the instruction at offset of fn,
+// followed by a comment naming the constant, variable or jump target its
+// operands refer to, and the width of the instruction.
+func FormatInstruction(fn *object.CompiledFunction, offset int, constants []object.Object, globalNames []string) (string, int, error) {
+	ins := fn.Instructions
+
+	text, width, err := ins.Format(offset)
+	if err != nil {
+		return "", 0, err
+	}
+
+	def, _ := code.Lookup(ins[offset])
+	operands, _ := code.ReadOperands(def, ins[offset+1:])
+
+	constant := func(index int) string {
+		if index >= len(constants) {
+			return "?"
+		}
+		switch c := constants[index].(type) {
+		case *object.CompiledFunction:
+			return fmt.Sprintf("<function %d/%d>", index, c.NumParameters)
+		case *object.String:
+			return fmt.Sprintf("%q", c.Value)
+		}
+		return constants[index].Inspect()
+	}
+	// names of identifiers and members are stored as string constants
+	constantName := func(index int) string {
+		if index >= len(constants) {
+			return "?"
+		}
+		return constants[index].Inspect()
+	}
+	name := func(names []string, index int) string {
+		if index < len(names) {
+			return names[index]
+		}
+		return "?"
+	}
+
+	var comment string
+	switch code.Opcode(ins[offset]) {
+	case code.OpConstant, code.OpClosure:
+		comment = constant(operands[0])
+	case code.OpGetGlobal, code.OpSetGlobal:
+		comment = name(globalNames, operands[0])
+	case code.OpGetLocal, code.OpSetLocal:
+		comment = name(fn.LocalNames, operands[0])
+	case code.OpGetFree:
+		comment = constantName(operands[2])
+	case code.OpUndefined, code.OpGetMember:
+		comment = constantName(operands[0])
+	case code.OpJump, code.OpJumpNotTruthy:
+		comment = fmt.Sprintf("-> %04d", operands[0])
+	}
+
+	if comment != "" {
+		text = fmt.Sprintf("%-24s ; %s", text, comment)
+	}
+
+	return text, width, nil
+}
@@ -0,0 +1,57 @@
+package compiler
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+)
+
+func TestDisassemble(t *testing.T) {
+	input := `let a = 2;
+let add = fn(x, y) {
+  x + y + a;
+};
+if (add(1, 2) > 4) { "big" } else { foo.bar };`
+
+	expected := `== main ==
+0000    1 OpConstant 0             ; 2
+0003    | OpSetGlobal 0            ; a
+0006    2 OpClosure 1              ; <function 1/2>
+0009    | OpSetGlobal 1            ; add
+0012    5 OpConstant 2             ; 4
+0015    | OpGetGlobal 1            ; add
+0018    | OpConstant 3             ; 1
+0021    | OpConstant 4             ; 2
+0024    | OpCall 2
+0026    | OpGreaterThan
+0027    | OpJumpNotTruthy 36       ; -> 0036
+0030    | OpConstant 5             ; "big"
+0033    | OpJump 42                ; -> 0042
+0036    | OpUndefined 6            ; foo
+0039    | OpGetMember 7            ; bar
+0042    | OpPop
+== function 1 (x, y) ==
+0000    3 OpGetGlobal 0            ; a
+0003    | OpGetLocal 1             ; y
+0005    | OpGetLocal 0             ; x
+0007    | OpAdd
+0008    | OpAdd
+0009    | OpReturnValue
+`
+
+	compiler := New()
+	if err := compiler.Compile(parser.New(lexer.New(input)).ParseProgram()); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var out bytes.Buffer
+	if err := Disassemble(&out, compiler.Bytecode()); err != nil {
+		t.Fatalf("disassemble error: %s", err)
+	}
+
+	if out.String() != expected {
+		t.Errorf("wrong listing.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
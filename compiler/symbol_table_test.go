@@ -0,0 +1,63 @@
+package compiler
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+
+	tests := []struct {
+		table    *SymbolTable
+		name     string
+		expected Symbol
+	}{
+		{global, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{global, "b", Symbol{Name: "b", Scope: GlobalScope, Index: 1}},
+		{global, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{local, "c", Symbol{Name: "c", Scope: LocalScope, Index: 0}},
+		{local, "d", Symbol{Name: "d", Scope: LocalScope, Index: 1}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.table.Define(tt.name); got != tt.expected {
+			t.Errorf("wrong symbol for %s. expected=%+v, got=%+v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	first := NewEnclosedSymbolTable(global)
+	first.Define("b")
+
+	second := NewEnclosedSymbolTable(first)
+	second.Define("c")
+
+	third := NewEnclosedSymbolTable(second)
+
+	tests := []struct {
+		name     string
+		expected Symbol
+	}{
+		{"a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{"b", Symbol{Name: "b", Scope: FreeScope, Index: 0, Depth: 2}},
+		{"c", Symbol{Name: "c", Scope: FreeScope, Index: 0, Depth: 1}},
+	}
+
+	for _, tt := range tests {
+		got, ok := third.Resolve(tt.name)
+		if !ok {
+			t.Errorf("name %s not resolvable", tt.name)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("wrong symbol for %s. expected=%+v, got=%+v", tt.name, tt.expected, got)
+		}
+	}
+
+	if _, ok := third.Resolve("d"); ok {
+		t.Errorf("expected d to be unresolvable")
+	}
+}
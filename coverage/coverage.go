@@ -0,0 +1,280 @@
+// Package coverage records which statements of Monkey programs ran, which
+// branches of their if expressions were taken and which functions were
+// called. A Coverage is installed as an evaluator hook and reports per line
+// as text, as HTML with highlighted source or as an LCOV trace file.
+package coverage
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+// Coverage counts how often the statements, branches and functions of the
+// programs added to it run. It follows a single evaluation at a time.
+type Coverage struct {
+	files []*file
+
+	statements map[ast.Statement]*counter
+	ifs        map[*ast.IfExpression]*branch
+	blocks     map[*ast.BlockStatement]*counter
+	functions  map[*ast.FunctionLiteral]*function
+}
+
+type file struct {
+	name   string
+	source []string // the lines of the source
+
+	statements []*counter
+	branches   []*branch
+	functions  []*function
+}
+
+// counter counts the runs of something that starts at line.
+type counter struct {
+	line  int
+	count int64
+}
+
+// branch is an if expression, which runs its consequence or its
+// alternative, possibly an empty one.
+type branch struct {
+	line        int
+	count       int64
+	consequence *counter
+	alternative *counter // nil without else
+}
+
+// taken returns how often the consequence and the alternative ran.
+func (b *branch) taken() (int64, int64) {
+	if b.alternative != nil {
+		return b.consequence.count, b.alternative.count
+	}
+
+	return b.consequence.count, b.count - b.consequence.count
+}
+
+type function struct {
+	name string
+	counter
+}
+
+func New() *Coverage {
+	return &Coverage{
+		statements: map[ast.Statement]*counter{},
+		ifs:        map[*ast.IfExpression]*branch{},
+		blocks:     map[*ast.BlockStatement]*counter{},
+		functions:  map[*ast.FunctionLiteral]*function{},
+	}
+}
+
+// Add registers program, parsed from source read from filename. Only the
+// programs added are covered; their statements count as not run until
+// they are.
+func (c *Coverage) Add(filename, source string, program *ast.Program) {
+	f := &file{name: filename, source: strings.Split(strings.TrimSuffix(source, "\n"), "\n")}
+	c.files = append(c.files, f)
+
+	for _, s := range program.Statements {
+		c.addStatement(f, s)
+	}
+
+	sort.SliceStable(f.statements, func(i, j int) bool { return f.statements[i].line < f.statements[j].line })
+	sort.SliceStable(f.branches, func(i, j int) bool { return f.branches[i].line < f.branches[j].line })
+	sort.SliceStable(f.functions, func(i, j int) bool { return f.functions[i].line < f.functions[j].line })
+}
+
+func (c *Coverage) addStatement(f *file, s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		c.count(f, s, s.Token.Line)
+		c.addExpression(f, s.Value)
+	case *ast.ReturnStatement:
+		c.count(f, s, s.Token.Line)
+		c.addExpression(f, s.ReturnValue)
+	case *ast.ExpressionStatement:
+		c.count(f, s, s.Token.Line)
+		c.addExpression(f, s.Expression)
+	case *ast.BlockStatement:
+		for _, s := range s.Statements {
+			c.addStatement(f, s)
+		}
+	}
+}
+
+func (c *Coverage) count(f *file, s ast.Statement, line int) {
+	counter := &counter{line: line}
+	c.statements[s] = counter
+	f.statements = append(f.statements, counter)
+}
+
+func (c *Coverage) addExpression(f *file, e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.IfExpression:
+		b := &branch{line: e.Token.Line, consequence: &counter{}}
+		c.ifs[e] = b
+		c.blocks[e.Consequence] = b.consequence
+		if e.Alternative != nil {
+			b.alternative = &counter{}
+			c.blocks[e.Alternative] = b.alternative
+		}
+		f.branches = append(f.branches, b)
+
+		c.addExpression(f, e.Condition)
+		c.addStatement(f, e.Consequence)
+		if e.Alternative != nil {
+			c.addStatement(f, e.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		fn := &function{name: e.Name, counter: counter{line: e.Token.Line}}
+		if fn.name == "" {
+			fn.name = "anonymous"
+		}
+		c.functions[e] = fn
+		f.functions = append(f.functions, fn)
+
+		c.addStatement(f, e.Body)
+	case *ast.PrefixExpression:
+		c.addExpression(f, e.Right)
+	case *ast.InfixExpression:
+		c.addExpression(f, e.Left)
+		c.addExpression(f, e.Right)
+	case *ast.CallExpression:
+		c.addExpression(f, e.Function)
+		for _, a := range e.Arguments {
+			c.addExpression(f, a)
+		}
+	case *ast.MemberExpression:
+		c.addExpression(f, e.Object)
+	}
+}
+
+func (c *Coverage) OnNodeEnter(node ast.Node, scope evaluator.Scope) {
+	switch node := node.(type) {
+	case *ast.IfExpression:
+		if b, ok := c.ifs[node]; ok {
+			b.count++
+		}
+	case *ast.BlockStatement:
+		if counter, ok := c.blocks[node]; ok {
+			counter.count++
+		}
+	case ast.Statement:
+		if counter, ok := c.statements[node]; ok {
+			counter.count++
+		}
+	}
+}
+
+func (c *Coverage) OnNodeExit(node ast.Node, result object.Object) {}
+
+func (c *Coverage) OnCall(fn object.Object, args []object.Object) {
+	if fn, ok := fn.(*object.Function); ok {
+		if f, ok := c.functions[fn.Literal]; ok {
+			f.count++
+		}
+	}
+}
+
+func (c *Coverage) OnReturn(fn object.Object, result object.Object) {}
+
+// Summary tells how much of the programs added ran.
+type Summary struct {
+	Statements, StatementsRun int
+	// each if expression has two branches
+	Branches, BranchesTaken    int
+	Functions, FunctionsCalled int
+}
+
+// Percent returns the percentage of statements that ran.
+func (s Summary) Percent() float64 {
+	if s.Statements == 0 {
+		return 100
+	}
+
+	return 100 * float64(s.StatementsRun) / float64(s.Statements)
+}
+
+func (s *Summary) add(o Summary) {
+	s.Statements += o.Statements
+	s.StatementsRun += o.StatementsRun
+	s.Branches += o.Branches
+	s.BranchesTaken += o.BranchesTaken
+	s.Functions += o.Functions
+	s.FunctionsCalled += o.FunctionsCalled
+}
+
+// Summary returns the coverage of all programs added.
+func (c *Coverage) Summary() Summary {
+	var total Summary
+	for _, f := range c.files {
+		total.add(f.summary())
+	}
+
+	return total
+}
+
+func (f *file) summary() Summary {
+	s := Summary{Statements: len(f.statements), Branches: 2 * len(f.branches), Functions: len(f.functions)}
+
+	for _, counter := range f.statements {
+		if counter.count > 0 {
+			s.StatementsRun++
+		}
+	}
+	for _, b := range f.branches {
+		consequence, alternative := b.taken()
+		if consequence > 0 {
+			s.BranchesTaken++
+		}
+		if alternative > 0 {
+			s.BranchesTaken++
+		}
+	}
+	for _, fn := range f.functions {
+		if fn.count > 0 {
+			s.FunctionsCalled++
+		}
+	}
+
+	return s
+}
+
+// line is the coverage of a single line of source.
+type line struct {
+	number     int
+	text       string
+	statements int   // statements starting on the line
+	run        int   // how many of them ran
+	count      int64 // how often the line ran, the most any of its statements did
+}
+
+func (l line) covered() bool { return l.statements > 0 && l.run == l.statements }
+func (l line) partial() bool { return l.run > 0 && l.run < l.statements }
+
+func (f *file) lines() []line {
+	lines := make([]line, len(f.source))
+	for i, text := range f.source {
+		lines[i] = line{number: i + 1, text: text}
+	}
+
+	for _, counter := range f.statements {
+		if counter.line < 1 || counter.line > len(lines) {
+			continue
+		}
+
+		l := &lines[counter.line-1]
+		l.statements++
+		if counter.count > 0 {
+			l.run++
+		}
+		if counter.count > l.count {
+			l.count = counter.count
+		}
+	}
+
+	return lines
+}
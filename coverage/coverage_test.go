@@ -0,0 +1,162 @@
+package coverage
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+	"github.com/cupsadarius/monkey_interpreter/resolver"
+)
+
+const source = `let abs = fn(x) {
+  if (x < 0) {
+    return -x;
+  }
+  x;
+};
+let sign = fn(x) { if (x > 0) { 1 } else { if (x < 0) { -1 } else { 0 } } };
+let unused = fn() {
+  "never";
+};
+abs(-3) + abs(4) + sign(5);
+`
+
+func run(t *testing.T) *Coverage {
+	t.Helper()
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	resolver.Resolve(program, nil)
+
+	cov := New()
+	cov.Add("abs.mk", source, program)
+
+	result, err := evaluator.EvalContext(context.Background(), program, object.NewEnvironment(), evaluator.WithHook(cov))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "8" {
+		t.Fatalf("wrong result. got=%s", result.Inspect())
+	}
+
+	return cov
+}
+
+func TestSummary(t *testing.T) {
+	expected := Summary{
+		Statements: 13, StatementsRun: 9,
+		Branches: 6, BranchesTaken: 3,
+		Functions: 3, FunctionsCalled: 2,
+	}
+
+	if got := run(t).Summary(); got != expected {
+		t.Errorf("wrong summary.\nwant=%+v\ngot =%+v", expected, got)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	expected := `abs.mk: 69.2% of statements, 3/6 branches, 2/3 functions
+        1:    1: let abs = fn(x) {
+        2:    2:   if (x < 0) {
+        1:    3:     return -x;
+        -:    4:   }
+        1:    5:   x;
+        -:    6: };
+       1*:    7: let sign = fn(x) { if (x > 0) { 1 } else { if (x < 0) { -1 } else { 0 } } };
+        1:    8: let unused = fn() {
+    #####:    9:   "never";
+        -:   10: };
+        1:   11: abs(-3) + abs(4) + sign(5);
+
+`
+
+	var out bytes.Buffer
+	if err := run(t).WriteText(&out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if out.String() != expected {
+		t.Errorf("wrong report.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestWriteLCOV(t *testing.T) {
+	expected := `TN:
+SF:abs.mk
+FN:1,abs
+FN:7,sign
+FN:8,unused
+FNDA:2,abs
+FNDA:1,sign
+FNDA:0,unused
+FNF:3
+FNH:2
+BRDA:2,0,0,1
+BRDA:2,0,1,1
+BRDA:7,1,0,1
+BRDA:7,1,1,0
+BRDA:7,2,0,-
+BRDA:7,2,1,-
+BRF:6
+BRH:3
+DA:1,1
+DA:2,2
+DA:3,1
+DA:5,1
+DA:7,1
+DA:8,1
+DA:9,0
+DA:11,1
+LF:8
+LH:7
+end_of_record
+`
+
+	var out bytes.Buffer
+	if err := run(t).WriteLCOV(&out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if out.String() != expected {
+		t.Errorf("wrong trace.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var out bytes.Buffer
+	if err := run(t).WriteHTML(&out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	html := out.String()
+
+	for _, expected := range []string{
+		`<h2 id="abs.mk">abs.mk</h2>`,
+		`<span class="line covered"><span class="number">3</span><span class="count">1</span>    return -x;</span>`,
+		`<span class="line partial"><span class="number">7</span><span class="count">1</span>let sign = fn(x) { if (x &gt; 0)`,
+		`<span class="line uncovered"><span class="number">9</span><span class="count">0</span>  &#34;never&#34;;</span>`,
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("%q missing from the report:\n%s", expected, html)
+		}
+	}
+}
+
+func TestProgramsNotAddedAreIgnored(t *testing.T) {
+	cov := New()
+
+	program := parser.New(lexer.New("let f = fn(x) { if (x) { 1 } }; f(true);")).ParseProgram()
+	resolver.Resolve(program, nil)
+	evaluator.EvalContext(context.Background(), program, object.NewEnvironment(), evaluator.WithHook(cov))
+
+	if got := cov.Summary(); got != (Summary{}) {
+		t.Errorf("coverage recorded for a program that was not added: %+v", got)
+	}
+}
@@ -0,0 +1,159 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+)
+
+// WriteText writes a summary of each program followed by its source, every
+// line prefixed by how often it ran: "-" for lines without statements and
+// "#####" for lines whose statements never ran. Lines of which only some
+// statements ran are marked with a "*".
+func (c *Coverage) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	for _, f := range c.files {
+		s := f.summary()
+		fmt.Fprintf(bw, "%s: %.1f%% of statements, %d/%d branches, %d/%d functions\n",
+			f.name, s.Percent(), s.BranchesTaken, s.Branches, s.FunctionsCalled, s.Functions)
+
+		for _, l := range f.lines() {
+			count := "-"
+			switch {
+			case l.covered():
+				count = fmt.Sprint(l.count)
+			case l.partial():
+				count = fmt.Sprintf("%d*", l.count)
+			case l.statements > 0:
+				count = "#####"
+			}
+			fmt.Fprintf(bw, "%9s:%5d: %s\n", count, l.number, l.text)
+		}
+		fmt.Fprintln(bw)
+	}
+
+	return bw.Flush()
+}
+
+// WriteLCOV writes the coverage in the LCOV trace file format.
+func (c *Coverage) WriteLCOV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	for _, f := range c.files {
+		s := f.summary()
+
+		fmt.Fprintln(bw, "TN:")
+		fmt.Fprintf(bw, "SF:%s\n", f.name)
+
+		for _, fn := range f.functions {
+			fmt.Fprintf(bw, "FN:%d,%s\n", fn.line, fn.name)
+		}
+		for _, fn := range f.functions {
+			fmt.Fprintf(bw, "FNDA:%d,%s\n", fn.count, fn.name)
+		}
+		fmt.Fprintf(bw, "FNF:%d\nFNH:%d\n", s.Functions, s.FunctionsCalled)
+
+		for i, b := range f.branches {
+			consequence, alternative := b.taken()
+			fmt.Fprintf(bw, "BRDA:%d,%d,0,%s\n", b.line, i, taken(b, consequence))
+			fmt.Fprintf(bw, "BRDA:%d,%d,1,%s\n", b.line, i, taken(b, alternative))
+		}
+		fmt.Fprintf(bw, "BRF:%d\nBRH:%d\n", s.Branches, s.BranchesTaken)
+
+		lines, hit := 0, 0
+		for _, l := range f.lines() {
+			if l.statements == 0 {
+				continue
+			}
+			lines++
+			if l.count > 0 {
+				hit++
+			}
+			fmt.Fprintf(bw, "DA:%d,%d\n", l.number, l.count)
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\n", lines, hit)
+
+		fmt.Fprintln(bw, "end_of_record")
+	}
+
+	return bw.Flush()
+}
+
+// taken formats how often a branch was taken, which LCOV writes as "-" if
+// the if expression itself never ran.
+func taken(b *branch, count int64) string {
+	if b.count == 0 {
+		return "-"
+	}
+
+	return fmt.Sprint(count)
+}
+
+var htmlTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Monkey coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+pre { font-family: monospace; line-height: 1.3; }
+.line { display: block; }
+.number, .count { display: inline-block; text-align: right; color: #888; padding-right: 1em; }
+.number { width: 3em; }
+.count { width: 4em; }
+.covered { background: #d4f7d4; }
+.partial { background: #fbf1c2; }
+.uncovered { background: #f9d0d0; }
+</style>
+</head>
+<body>
+{{range .}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+<p>{{printf "%.1f" .Summary.Percent}}% of statements, {{.Summary.BranchesTaken}}/{{.Summary.Branches}} branches, {{.Summary.FunctionsCalled}}/{{.Summary.Functions}} functions</p>
+<pre>
+{{- range .Lines}}<span class="line {{.Class}}"><span class="number">{{.Number}}</span><span class="count">{{.Count}}</span>{{.Text}}</span>{{end -}}
+</pre>
+{{end}}
+</body>
+</html>
+`))
+
+type htmlFile struct {
+	Name    string
+	Summary Summary
+	Lines   []htmlLine
+}
+
+type htmlLine struct {
+	Number int
+	Count  string
+	Class  string
+	Text   string
+}
+
+// WriteHTML writes a page showing the source of every program, with lines
+// highlighted by whether their statements ran.
+func (c *Coverage) WriteHTML(w io.Writer) error {
+	files := make([]htmlFile, len(c.files))
+
+	for i, f := range c.files {
+		files[i] = htmlFile{Name: f.name, Summary: f.summary()}
+
+		for _, l := range f.lines() {
+			hl := htmlLine{Number: l.number, Text: l.text}
+			switch {
+			case l.covered():
+				hl.Class, hl.Count = "covered", fmt.Sprint(l.count)
+			case l.partial():
+				hl.Class, hl.Count = "partial", fmt.Sprint(l.count)
+			case l.statements > 0:
+				hl.Class, hl.Count = "uncovered", "0"
+			}
+			files[i].Lines = append(files[i].Lines, hl)
+		}
+	}
+
+	return htmlTemplate.Execute(w, files)
+}
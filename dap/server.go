@@ -0,0 +1,515 @@
+// Package dap implements a Debug Adapter Protocol server for Monkey,
+// speaking over a pair of streams such as stdin and stdout. It launches a
+// single script under the control of a debugger.Debugger and offers line
+// and conditional breakpoints, stepping, the call stack, the variables of
+// every frame and of the environments of the globals, and the evaluation of
+// expressions in paused frames.
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cupsadarius/monkey_interpreter/debugger"
+	"github.com/cupsadarius/monkey_interpreter/internal/framing"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+)
+
+// the only thread of a Monkey program
+const threadID = 1
+
+var (
+	errNotLaunched = errors.New("no program has been launched")
+	errNotPaused   = errors.New("the program is not paused")
+)
+
+// Server debugs the script a single client launches.
+type Server struct {
+	in *bufio.Reader
+
+	mu  sync.Mutex // guards out and seq, written to by the program too
+	out io.Writer
+	seq int
+
+	env      *object.Environment
+	path     string
+	debugger *debugger.Debugger
+	finished chan struct{} // closed once the end of the program is told
+
+	// the variables shown while the program is paused, by reference
+	containers []container
+	envs       map[*object.Environment]int
+
+	// after runs once the response to the request it was set by has been
+	// written
+	after func()
+}
+
+// container holds variables: the locals of a frame or an environment.
+type container struct {
+	frame *debugger.Frame
+	env   *object.Environment
+}
+
+type Option func(*Server)
+
+// WithEnvironment sets the environment the program is evaluated in, which
+// holds the globals it starts with.
+func WithEnvironment(env *object.Environment) Option {
+	return func(s *Server) {
+		s.env = env
+	}
+}
+
+// NewServer returns a server reading messages from in and writing them to
+// out.
+func NewServer(in io.Reader, out io.Writer, opts ...Option) *Server {
+	s := &Server{in: bufio.NewReader(in), out: out, env: object.NewEnvironment()}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+type handler func(s *Server, arguments json.RawMessage) (interface{}, error)
+
+var handlers = map[string]handler{
+	"initialize":        (*Server).initialize,
+	"launch":            (*Server).launch,
+	"setBreakpoints":    (*Server).setBreakpoints,
+	"configurationDone": (*Server).configurationDone,
+	"threads":           (*Server).threads,
+	"stackTrace":        (*Server).stackTrace,
+	"scopes":            (*Server).scopes,
+	"variables":         (*Server).variables,
+	"continue":          resume((*debugger.Debugger).Continue, ContinueResponse{AllThreadsContinued: true}),
+	"next":              resume((*debugger.Debugger).StepOver, nil),
+	"stepIn":            resume((*debugger.Debugger).StepIn, nil),
+	"stepOut":           resume((*debugger.Debugger).StepOut, nil),
+	"pause":             (*Server).pause,
+	"evaluate":          (*Server).evaluate,
+	"terminate":         (*Server).terminate,
+}
+
+// Serve handles requests until the client disconnects or closes the
+// input, terminating the program if it still runs.
+func (s *Server) Serve() error {
+	defer s.terminate(nil)
+
+	for {
+		body, err := framing.Read(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("dap: %w", err)
+		}
+
+		m := &message{}
+		if err := json.Unmarshal(body, m); err != nil {
+			return fmt.Errorf("dap: invalid message: %w", err)
+		}
+		if m.Type != "request" {
+			continue
+		}
+
+		if m.Command == "disconnect" {
+			s.terminate(nil)
+			return s.respond(m, nil, nil)
+		}
+
+		if err := s.handle(m); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(m *message) error {
+	h, ok := handlers[m.Command]
+	if !ok {
+		return s.respond(m, nil, fmt.Errorf("unsupported request: %s", m.Command))
+	}
+
+	body, err := h(s, m.Arguments)
+	if err := s.respond(m, body, err); err != nil {
+		return err
+	}
+
+	if after := s.after; after != nil {
+		s.after = nil
+		after()
+	}
+
+	return nil
+}
+
+func (s *Server) respond(m *message, body interface{}, err error) error {
+	r := response{Type: "response", RequestSeq: m.Seq, Success: err == nil, Command: m.Command, Body: body}
+	if err != nil {
+		r.Message = err.Error()
+	}
+
+	return s.write(&r.Seq, &r)
+}
+
+func (s *Server) event(name string, body interface{}) error {
+	e := event{Type: "event", Event: name, Body: body}
+
+	return s.write(&e.Seq, &e)
+}
+
+// write numbers the message v, whose seq field seq points to, and writes
+// it.
+func (s *Server) write(seq *int, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	*seq = s.seq
+
+	return framing.Write(s.out, v)
+}
+
+// decode unmarshals the arguments of a request into v.
+func decode(arguments json.RawMessage, v interface{}) error {
+	if len(arguments) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(arguments, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Server) initialize(arguments json.RawMessage) (interface{}, error) {
+	return Capabilities{
+		SupportsConfigurationDoneRequest: true,
+		SupportsConditionalBreakpoints:   true,
+		SupportsEvaluateForHovers:        true,
+		SupportsTerminateRequest:         true,
+	}, nil
+}
+
+// launch parses the program and tells the client to set the breakpoints,
+// which it does before it asks for the program to start with
+// configurationDone.
+func (s *Server) launch(arguments json.RawMessage) (interface{}, error) {
+	var args LaunchArguments
+	if err := decode(arguments, &args); err != nil {
+		return nil, err
+	}
+	if s.debugger != nil {
+		return nil, errors.New("a program has already been launched")
+	}
+
+	source, err := os.ReadFile(args.Program)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s: %s", args.Program, p.Errors()[0])
+	}
+
+	var opts []debugger.Option
+	if args.StopOnEntry {
+		opts = append(opts, debugger.WithStopOnEntry())
+	}
+
+	s.path = args.Program
+	s.debugger = debugger.New(program, opts...)
+	s.after = func() { s.event("initialized", nil) }
+
+	return nil, nil
+}
+
+func (s *Server) setBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	var args SetBreakpointsArguments
+	if err := decode(arguments, &args); err != nil {
+		return nil, err
+	}
+	if s.debugger == nil {
+		return nil, errNotLaunched
+	}
+
+	breakpoints := make([]Breakpoint, len(args.Breakpoints))
+	if filepath.Clean(args.Source.Path) != filepath.Clean(s.path) {
+		for i, bp := range args.Breakpoints {
+			breakpoints[i] = Breakpoint{Line: bp.Line, Message: "not the launched program"}
+		}
+		return SetBreakpointsResponse{Breakpoints: breakpoints}, nil
+	}
+
+	requested := make([]debugger.Breakpoint, len(args.Breakpoints))
+	for i, bp := range args.Breakpoints {
+		requested[i] = debugger.Breakpoint{Line: bp.Line, Condition: bp.Condition}
+	}
+	for i, bp := range s.debugger.SetBreakpoints(requested) {
+		breakpoints[i] = Breakpoint{Verified: bp.Verified, Message: bp.Message, Line: bp.Line}
+	}
+
+	return SetBreakpointsResponse{Breakpoints: breakpoints}, nil
+}
+
+// configurationDone starts the program.
+func (s *Server) configurationDone(arguments json.RawMessage) (interface{}, error) {
+	if s.debugger == nil {
+		return nil, errNotLaunched
+	}
+	if err := s.debugger.Start(s.env); err != nil {
+		return nil, err
+	}
+
+	s.finished = make(chan struct{})
+	s.after = func() { go s.run() }
+
+	return nil, nil
+}
+
+// run tells the client where the program stops and how it ends.
+func (s *Server) run() {
+	defer close(s.finished)
+
+	for stop := s.debugger.Wait(); stop != nil; stop = s.debugger.Wait() {
+		s.event("stopped", StoppedEvent{Reason: stop.Reason, ThreadID: threadID, AllThreadsStopped: true})
+	}
+
+	exitCode := 0
+	result, err := s.debugger.Result()
+	switch {
+	case errors.Is(err, context.Canceled):
+		// terminated by the client
+		exitCode = 1
+	case err != nil:
+		exitCode = 1
+		s.event("output", OutputEvent{Category: "stderr", Output: fmt.Sprintf("evaluation aborted: %s\n", err)})
+	case result != nil && result.Type() == object.ERROR_OBJ:
+		exitCode = 1
+		s.event("output", OutputEvent{Category: "stderr", Output: result.Inspect() + "\n"})
+	case result != nil:
+		s.event("output", OutputEvent{Category: "stdout", Output: result.Inspect() + "\n"})
+	}
+
+	s.event("exited", ExitedEvent{ExitCode: exitCode})
+	s.event("terminated", nil)
+}
+
+func (s *Server) threads(arguments json.RawMessage) (interface{}, error) {
+	return ThreadsResponse{Threads: []Thread{{ID: threadID, Name: "main"}}}, nil
+}
+
+// paused returns where the program is paused.
+func (s *Server) paused() (*debugger.Stop, error) {
+	if s.debugger == nil {
+		return nil, errNotLaunched
+	}
+
+	stop := s.debugger.Paused()
+	if stop == nil {
+		return nil, errNotPaused
+	}
+
+	return stop, nil
+}
+
+// frame returns the frame id stands for, the frames of a stop numbered
+// from 1, innermost first. The id 0 stands for the innermost frame.
+func (s *Server) frame(id int) (*debugger.Frame, error) {
+	stop, err := s.paused()
+	if err != nil {
+		return nil, err
+	}
+
+	if id == 0 {
+		id = 1
+	}
+	if id < 1 || id > len(stop.Frames) {
+		return nil, fmt.Errorf("no frame %d", id)
+	}
+
+	return stop.Frames[id-1], nil
+}
+
+func (s *Server) stackTrace(arguments json.RawMessage) (interface{}, error) {
+	var args StackTraceArguments
+	if err := decode(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	stop, err := s.paused()
+	if err != nil {
+		return nil, err
+	}
+
+	frames := []StackFrame{}
+	source := &Source{Name: filepath.Base(s.path), Path: s.path}
+	for i := args.StartFrame; i < len(stop.Frames); i++ {
+		if args.Levels > 0 && len(frames) == args.Levels {
+			break
+		}
+
+		f := stop.Frames[i]
+		frames = append(frames, StackFrame{ID: i + 1, Name: f.Name, Source: source, Line: f.Pos.Line, Column: f.Pos.Column})
+	}
+
+	return StackTraceResponse{StackFrames: frames, TotalFrames: len(stop.Frames)}, nil
+}
+
+// reference returns the reference of the variables of c.
+func (s *Server) reference(c container) int {
+	if c.env != nil {
+		if ref, ok := s.envs[c.env]; ok {
+			return ref
+		}
+	}
+
+	s.containers = append(s.containers, c)
+	ref := len(s.containers)
+	if c.env != nil {
+		if s.envs == nil {
+			s.envs = map[*object.Environment]int{}
+		}
+		s.envs[c.env] = ref
+	}
+
+	return ref
+}
+
+func (s *Server) scopes(arguments json.RawMessage) (interface{}, error) {
+	var args ScopesArguments
+	if err := decode(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	f, err := s.frame(args.FrameID)
+	if err != nil {
+		return nil, err
+	}
+
+	var scopes []Scope
+	if f.Function != nil {
+		scopes = append(scopes, Scope{Name: "Locals", VariablesReference: s.reference(container{frame: f})})
+	}
+	scopes = append(scopes, Scope{Name: "Globals", VariablesReference: s.reference(container{env: f.Globals()})})
+
+	return ScopesResponse{Scopes: scopes}, nil
+}
+
+func (s *Server) variables(arguments json.RawMessage) (interface{}, error) {
+	var args VariablesArguments
+	if err := decode(arguments, &args); err != nil {
+		return nil, err
+	}
+	if _, err := s.paused(); err != nil {
+		return nil, err
+	}
+	if args.VariablesReference < 1 || args.VariablesReference > len(s.containers) {
+		return nil, fmt.Errorf("no variables %d", args.VariablesReference)
+	}
+
+	variables := []Variable{}
+	c := s.containers[args.VariablesReference-1]
+
+	if c.frame != nil {
+		for _, v := range c.frame.Locals() {
+			variables = append(variables, variable(v.Name, v.Value))
+		}
+		return VariablesResponse{Variables: variables}, nil
+	}
+
+	for _, name := range c.env.Names() {
+		if value, ok := c.env.Get(name); ok {
+			variables = append(variables, variable(name, value))
+		}
+	}
+	// the environment the globals are enclosed in, named so that it cannot
+	// be a variable
+	if outer := c.env.Outer(); outer != nil {
+		variables = append(variables, Variable{
+			Name:               "(outer)",
+			Value:              "environment",
+			VariablesReference: s.reference(container{env: outer}),
+		})
+	}
+
+	return VariablesResponse{Variables: variables}, nil
+}
+
+func variable(name string, value object.Object) Variable {
+	return Variable{Name: name, Value: value.Inspect(), Type: string(value.Type())}
+}
+
+// resume returns the handler of a request resuming the program with step
+// and answered with body.
+func resume(step func(*debugger.Debugger) error, body interface{}) handler {
+	return func(s *Server, arguments json.RawMessage) (interface{}, error) {
+		if _, err := s.paused(); err != nil {
+			return nil, err
+		}
+
+		// the variables of the stop are gone, and the program only resumes
+		// once the response has been written, so that it comes before the
+		// next stop
+		s.containers, s.envs = nil, nil
+		s.after = func() { step(s.debugger) }
+
+		return body, nil
+	}
+}
+
+func (s *Server) pause(arguments json.RawMessage) (interface{}, error) {
+	if s.debugger == nil {
+		return nil, errNotLaunched
+	}
+	s.debugger.Pause()
+
+	return nil, nil
+}
+
+func (s *Server) evaluate(arguments json.RawMessage) (interface{}, error) {
+	var args EvaluateArguments
+	if err := decode(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	f, err := s.frame(args.FrameID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := f.Evaluate(args.Expression)
+	if err != nil {
+		return nil, err
+	}
+
+	return EvaluateResponse{Result: result.Inspect(), Type: string(result.Type())}, nil
+}
+
+// terminate aborts the program, if it runs, and waits for its end to be
+// told.
+func (s *Server) terminate(arguments json.RawMessage) (interface{}, error) {
+	if s.debugger == nil {
+		return nil, nil
+	}
+
+	s.debugger.Terminate()
+	if s.finished != nil {
+		<-s.finished
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,392 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/internal/framing"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+const script = `let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+let twice = fn(n) {
+  let once = add(n, n);
+  add(once, once)
+};
+let x = twice(2);
+x + 1`
+
+// client plays a scripted session against a server running in another
+// goroutine, collecting the events it sends.
+type client struct {
+	t        *testing.T
+	in       io.WriteCloser
+	messages chan *message
+	done     chan error
+
+	seq    int
+	events []*message
+}
+
+func newClient(t *testing.T, opts ...Option) *client {
+	t.Helper()
+
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &client{t: t, in: clientOut, messages: make(chan *message, 16), done: make(chan error, 1)}
+
+	go func() {
+		err := NewServer(serverIn, serverOut, opts...).Serve()
+		serverOut.Close()
+		c.done <- err
+	}()
+	go func() {
+		r := bufio.NewReader(clientIn)
+		for {
+			body, err := framing.Read(r)
+			m := &message{}
+			if err == nil {
+				err = json.Unmarshal(body, m)
+			}
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			c.messages <- m
+		}
+	}()
+
+	return c
+}
+
+// request sends a request and returns the response to it.
+func (c *client) request(command string, arguments interface{}) *message {
+	c.t.Helper()
+
+	c.seq++
+	m := map[string]interface{}{"seq": c.seq, "type": "request", "command": command}
+	if arguments != nil {
+		m["arguments"] = arguments
+	}
+	if err := framing.Write(c.in, m); err != nil {
+		c.t.Fatalf("writing %s: %s", command, err)
+	}
+
+	for m := range c.messages {
+		if m.Type == "event" {
+			c.events = append(c.events, m)
+			continue
+		}
+		if m.RequestSeq != c.seq || m.Command != command {
+			c.t.Fatalf("wrong response. expected %s to %d, got=%s to %d", command, c.seq, m.Command, m.RequestSeq)
+		}
+		return m
+	}
+
+	c.t.Fatalf("no response to %s", command)
+	return nil
+}
+
+// body sends a request that must succeed and decodes its body into v.
+func (c *client) body(command string, arguments interface{}, v interface{}) {
+	c.t.Helper()
+
+	m := c.request(command, arguments)
+	if !m.Success {
+		c.t.Fatalf("%s failed: %s", command, m.Message)
+	}
+	if v != nil {
+		if err := json.Unmarshal(m.Body, v); err != nil {
+			c.t.Fatalf("decoding the body of %s: %s", command, err)
+		}
+	}
+}
+
+// event waits for the event name, skipping the others, and returns its
+// body.
+func (c *client) event(name string) string {
+	c.t.Helper()
+
+	for {
+		var m *message
+		if len(c.events) > 0 {
+			m, c.events = c.events[0], c.events[1:]
+		} else {
+			var ok bool
+			if m, ok = <-c.messages; !ok {
+				c.t.Fatalf("no %s event", name)
+			}
+		}
+
+		if m.Type == "event" && m.Event == name {
+			return string(m.Body)
+		}
+	}
+}
+
+// launch starts a session debugging script with breakpoints on lines.
+func (c *client) launch(t *testing.T, stopOnEntry bool, breakpoints ...SourceBreakpoint) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c.body("initialize", map[string]interface{}{"adapterID": "monkey"}, nil)
+	c.body("launch", LaunchArguments{Program: path, StopOnEntry: stopOnEntry}, nil)
+	c.event("initialized")
+	if len(breakpoints) > 0 {
+		c.body("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: path}, Breakpoints: breakpoints}, nil)
+	}
+	c.body("configurationDone", nil, nil)
+}
+
+// stack returns the stack trace as "name@line:column ...".
+func (c *client) stack() string {
+	c.t.Helper()
+
+	var trace StackTraceResponse
+	c.body("stackTrace", StackTraceArguments{ThreadID: threadID}, &trace)
+
+	var frames []string
+	for _, f := range trace.StackFrames {
+		frames = append(frames, f.Name+"@"+itoa(f.Line)+":"+itoa(f.Column))
+	}
+
+	return strings.Join(frames, " ")
+}
+
+// variables returns the variables of ref as "name=value ...".
+func (c *client) variables(ref int) (string, map[string]int) {
+	c.t.Helper()
+
+	var vars VariablesResponse
+	c.body("variables", VariablesArguments{VariablesReference: ref}, &vars)
+
+	var got []string
+	refs := map[string]int{}
+	for _, v := range vars.Variables {
+		got = append(got, v.Name+"="+v.Value)
+		refs[v.Name] = v.VariablesReference
+	}
+
+	return strings.Join(got, " "), refs
+}
+
+func itoa(n int) string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
+
+func TestStepping(t *testing.T) {
+	c := newClient(t)
+	c.launch(t, true)
+
+	tests := []struct {
+		command string
+		reason  string
+		stack   string
+	}{
+		{"", "entry", "main@1:1"},
+		{"next", "step", "main@5:1"},
+		{"next", "step", "main@9:1"},
+		{"stepIn", "step", "twice@6:3 main@9:9"},
+		{"stepIn", "step", "add@2:3 twice@6:14 main@9:9"},
+		{"stepOut", "step", "twice@7:3 main@9:9"},
+		{"next", "step", "main@10:1"},
+	}
+
+	for i, tt := range tests {
+		if tt.command != "" {
+			c.body(tt.command, map[string]interface{}{"threadId": threadID}, nil)
+		}
+
+		var stopped StoppedEvent
+		if err := json.Unmarshal([]byte(c.event("stopped")), &stopped); err != nil {
+			t.Fatal(err)
+		}
+		if stopped.Reason != tt.reason {
+			t.Errorf("test[%d]: wrong reason. expected=%s, got=%s", i, tt.reason, stopped.Reason)
+		}
+		if got := c.stack(); got != tt.stack {
+			t.Errorf("test[%d]: wrong stack. expected=%q, got=%q", i, tt.stack, got)
+		}
+	}
+
+	c.body("continue", map[string]interface{}{"threadId": threadID}, nil)
+	if got := c.event("output"); got != `{"category":"stdout","output":"9\n"}` {
+		t.Errorf("wrong output. got=%s", got)
+	}
+	if got := c.event("exited"); got != `{"exitCode":0}` {
+		t.Errorf("wrong exit. got=%s", got)
+	}
+	c.event("terminated")
+
+	if m := c.request("stackTrace", StackTraceArguments{ThreadID: threadID}); m.Success || m.Message != "the program is not paused" {
+		t.Errorf("expected stackTrace to fail once the program finished. got=%+v", m)
+	}
+
+	c.body("disconnect", nil, nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	c := newClient(t)
+
+	path := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c.body("initialize", nil, nil)
+	if m := c.request("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: path}}); m.Success {
+		t.Errorf("expected setBreakpoints to fail before launch")
+	}
+	c.body("launch", LaunchArguments{Program: path}, nil)
+	c.event("initialized")
+
+	var set SetBreakpointsResponse
+	c.body("setBreakpoints", SetBreakpointsArguments{
+		Source: Source{Path: path},
+		Breakpoints: []SourceBreakpoint{
+			{Line: 3, Condition: "sum > 5"},
+			{Line: 4},
+			{Line: 20},
+		},
+	}, &set)
+	got, _ := json.Marshal(set)
+	expected := `{"breakpoints":[{"verified":true,"line":3},{"verified":true,"line":5},` +
+		`{"verified":false,"message":"no statement on or after line 20","line":20}]}`
+	if string(got) != expected {
+		t.Errorf("wrong breakpoints.\nexpected=%s\ngot=     %s", expected, got)
+	}
+
+	c.body("configurationDone", nil, nil)
+
+	c.event("stopped")
+	if got := c.stack(); got != "main@5:1" {
+		t.Errorf("wrong stack. expected=%q, got=%q", "main@5:1", got)
+	}
+	c.body("continue", nil, nil)
+
+	// the condition is false in the first call of add
+	if got := c.event("stopped"); got != `{"reason":"breakpoint","threadId":1,"allThreadsStopped":true}` {
+		t.Errorf("wrong stop. got=%s", got)
+	}
+	if got := c.stack(); got != "add@3:3 twice@7:3 main@9:9" {
+		t.Errorf("wrong stack. expected=%q, got=%q", "add@3:3 twice@7:3 main@9:9", got)
+	}
+
+	var scopes ScopesResponse
+	c.body("scopes", ScopesArguments{FrameID: 1}, &scopes)
+	if len(scopes.Scopes) != 2 || scopes.Scopes[0].Name != "Locals" || scopes.Scopes[1].Name != "Globals" {
+		t.Fatalf("wrong scopes. got=%+v", scopes.Scopes)
+	}
+	if got, _ := c.variables(scopes.Scopes[0].VariablesReference); got != "a=4 b=4 sum=8" {
+		t.Errorf("wrong locals. expected=%q, got=%q", "a=4 b=4 sum=8", got)
+	}
+	globals, _ := c.variables(scopes.Scopes[1].VariablesReference)
+	if !strings.HasPrefix(globals, "add=fn(a, b)") || !strings.Contains(globals, " twice=fn(n)") {
+		t.Errorf("wrong globals. got=%q", globals)
+	}
+
+	c.body("scopes", ScopesArguments{FrameID: 2}, &scopes)
+	if got, _ := c.variables(scopes.Scopes[0].VariablesReference); got != "n=2 once=4" {
+		t.Errorf("wrong locals of twice. expected=%q, got=%q", "n=2 once=4", got)
+	}
+
+	// the top level has no locals
+	c.body("scopes", ScopesArguments{FrameID: 3}, &scopes)
+	if len(scopes.Scopes) != 1 || scopes.Scopes[0].Name != "Globals" {
+		t.Errorf("wrong scopes of main. got=%+v", scopes.Scopes)
+	}
+
+	evaluations := []struct {
+		frame    int
+		expr     string
+		expected string
+	}{
+		{1, "a * b + sum", "24"},
+		{0, "sum", "8"},
+		{2, "n + once", "6"},
+		{3, "twice(1)", "4"},
+	}
+	for _, tt := range evaluations {
+		var result EvaluateResponse
+		c.body("evaluate", EvaluateArguments{Expression: tt.expr, FrameID: tt.frame, Context: "watch"}, &result)
+		if result.Result != tt.expected {
+			t.Errorf("wrong value of %q. expected=%s, got=%s", tt.expr, tt.expected, result.Result)
+		}
+	}
+	if m := c.request("evaluate", EvaluateArguments{Expression: "let", FrameID: 1}); m.Success {
+		t.Errorf("expected an invalid expression to fail")
+	}
+	if m := c.request("scopes", ScopesArguments{FrameID: 4}); m.Success || m.Message != "no frame 4" {
+		t.Errorf("expected scopes of a missing frame to fail. got=%+v", m)
+	}
+
+	c.body("continue", nil, nil)
+	c.event("exited")
+	c.event("terminated")
+}
+
+func TestOuterEnvironments(t *testing.T) {
+	base := object.NewEnvironment()
+	base.Set("base", object.NewInteger(1))
+	env := object.NewEnclosedEnvironment(base)
+	env.Set("offset", object.NewInteger(2))
+
+	c := newClient(t, WithEnvironment(env))
+	c.launch(t, false, SourceBreakpoint{Line: 10})
+	c.event("stopped")
+
+	var scopes ScopesResponse
+	c.body("scopes", ScopesArguments{FrameID: 1}, &scopes)
+	got, refs := c.variables(scopes.Scopes[0].VariablesReference)
+	if !strings.Contains(got, " offset=2 ") || !strings.HasSuffix(got, " x=8 (outer)=environment") {
+		t.Errorf("wrong globals. got=%q", got)
+	}
+	if got, _ := c.variables(refs["(outer)"]); got != "base=1" {
+		t.Errorf("wrong outer globals. expected=%q, got=%q", "base=1", got)
+	}
+
+	var result EvaluateResponse
+	c.body("evaluate", EvaluateArguments{Expression: "x + offset + base"}, &result)
+	if result.Result != "11" {
+		t.Errorf("wrong value. expected=11, got=%s", result.Result)
+	}
+
+	c.body("disconnect", nil, nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	c := newClient(t)
+	c.launch(t, true)
+	c.event("stopped")
+
+	c.body("terminate", nil, nil)
+	c.event("exited")
+	c.event("terminated")
+
+	if m := c.request("next", nil); m.Success {
+		t.Errorf("expected next to fail once the program terminated")
+	}
+	if m := c.request("restart", nil); m.Success || m.Message != "unsupported request: restart" {
+		t.Errorf("expected restart to be unsupported. got=%+v", m)
+	}
+}
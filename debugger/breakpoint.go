@@ -0,0 +1,90 @@
+package debugger
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+)
+
+// Breakpoint stops the program at the first statement of a line, if its
+// condition, when there is one, is true there.
+type Breakpoint struct {
+	Line      int
+	Condition string // an expression evaluated in the frame stopped in
+
+	// set by SetBreakpoints
+	Verified bool   // whether the breakpoint can be hit
+	Message  string // why it cannot
+
+	condition *ast.Program
+}
+
+// SetBreakpoints replaces the breakpoints of the program, which may be
+// running, by breakpoints and returns them as they are set. Breakpoints on
+// lines no statement starts on are moved to the next line one does.
+func (d *Debugger) SetBreakpoints(breakpoints []Breakpoint) []Breakpoint {
+	lines := make([]int, 0, len(d.lines))
+	for line := range d.lines {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+
+	result := make([]Breakpoint, len(breakpoints))
+	for i, bp := range breakpoints {
+		bp.Verified, bp.Message = false, ""
+
+		n := sort.SearchInts(lines, bp.Line)
+		if n == len(lines) {
+			bp.Message = fmt.Sprintf("no statement on or after line %d", bp.Line)
+			result[i] = bp
+			continue
+		}
+		bp.Line = lines[n]
+
+		if bp.Condition != "" {
+			condition, err := parse(bp.Condition)
+			if err != nil {
+				bp.Message = "invalid condition: " + err.Error()
+				result[i] = bp
+				continue
+			}
+			bp.condition = condition
+		}
+
+		bp.Verified = true
+		result[i] = bp
+	}
+
+	// the program reads copies, so that the caller may change the result
+	set := map[int]*Breakpoint{}
+	for _, bp := range result {
+		if bp.Verified {
+			bp := bp
+			set[bp.Line] = &bp
+		}
+	}
+
+	d.mu.Lock()
+	d.breakpoints = set
+	d.mu.Unlock()
+
+	return result
+}
+
+// hit reports whether bp stops the program in the frame running. A
+// condition failing to evaluate stops it, so that the mistake shows.
+func (d *Debugger) hit(bp *Breakpoint) bool {
+	if bp.condition == nil {
+		return true
+	}
+
+	result, err := evaluateProgram(d.stack[len(d.stack)-1].scope, bp.condition)
+	if err != nil {
+		return true
+	}
+
+	// errors raised by the condition are truthy
+	return evaluator.IsTruthy(result)
+}
@@ -0,0 +1,362 @@
+// Package debugger runs Monkey programs under the control of a debugger.
+// A Debugger is installed as an evaluator hook in an evaluation running in
+// a goroutine of its own, which it pauses at breakpoints, after steps and
+// when asked to. While the evaluation is paused the call stack, the
+// variables of every frame and the environments of the globals can be
+// inspected, and expressions evaluated in any frame.
+//
+// Execution stops at statements, and only at the first statement of each
+// line a function runs, so that a line is a single step.
+package debugger
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/resolver"
+)
+
+var (
+	ErrNotPaused = errors.New("debugger: the program is not paused")
+	ErrStarted   = errors.New("debugger: the program has already been started")
+)
+
+// Reasons the program stopped for.
+const (
+	ReasonEntry      = "entry"
+	ReasonBreakpoint = "breakpoint"
+	ReasonStep       = "step"
+	ReasonPause      = "pause"
+)
+
+// Debugger controls a single evaluation of a program. Its methods are safe
+// to call from any goroutine but the one running the evaluation.
+type Debugger struct {
+	program *ast.Program
+	lines   map[int]bool // the lines statements start on
+
+	stopOnEntry bool
+	limits      evaluator.Limits
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// handed over between the evaluation, when it pauses, and the
+	// goroutine controlling it
+	stops    chan *Stop
+	commands chan command
+	done     chan struct{}
+
+	mu          sync.Mutex
+	breakpoints map[int]*Breakpoint
+	pause       bool
+	started     bool
+	paused      *Stop
+	result      object.Object
+	err         error
+
+	// the state of the evaluation, only touched by its goroutine
+	stack []*frame
+	mode  command
+	depth int // of the stack when the step started
+}
+
+type Option func(*Debugger)
+
+// WithStopOnEntry makes the program stop before its first statement.
+func WithStopOnEntry() Option {
+	return func(d *Debugger) {
+		d.stopOnEntry = true
+	}
+}
+
+// WithLimits sets the resource limits of the evaluation.
+func WithLimits(limits evaluator.Limits) Option {
+	return func(d *Debugger) {
+		d.limits = limits
+	}
+}
+
+// New returns a debugger for program, which is not started yet. The
+// program is resolved first if that has not happened yet.
+func New(program *ast.Program, opts ...Option) *Debugger {
+	if !program.Resolved {
+		resolver.Resolve(program, nil)
+	}
+
+	d := &Debugger{
+		program:     program,
+		lines:       map[int]bool{},
+		stops:       make(chan *Stop),
+		commands:    make(chan command),
+		done:        make(chan struct{}),
+		breakpoints: map[int]*Breakpoint{},
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+
+	ast.Inspect(program, func(n ast.Node) bool {
+		if s, ok := n.(ast.Statement); ok && !isBlock(s) {
+			d.lines[s.Pos().Line] = true
+		}
+		return true
+	})
+
+	return d
+}
+
+func isBlock(s ast.Statement) bool {
+	_, ok := s.(*ast.BlockStatement)
+	return ok
+}
+
+// Stop describes where the program stopped and why.
+type Stop struct {
+	Reason string
+	// Frames is the call stack, innermost first; the last frame is the
+	// top level of the program.
+	Frames []*Frame
+}
+
+type command int
+
+const (
+	cmdContinue command = iota
+	cmdStepIn
+	cmdStepOver
+	cmdStepOut
+)
+
+// Start evaluates the program in env in a goroutine of its own. The
+// program runs until it stops, which Wait reports.
+func (d *Debugger) Start(env *object.Environment) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.started {
+		return ErrStarted
+	}
+	d.started = true
+
+	if d.stopOnEntry {
+		d.mode = cmdStepIn
+	}
+
+	go func() {
+		result, err := evaluator.EvalContext(d.ctx, d.program, env, evaluator.WithLimits(d.limits), evaluator.WithHook(hook{d}))
+
+		d.mu.Lock()
+		d.result, d.err = result, err
+		d.mu.Unlock()
+
+		close(d.done)
+	}()
+
+	return nil
+}
+
+// Wait waits for the program to stop and returns where, or nil once it
+// finished.
+func (d *Debugger) Wait() *Stop {
+	select {
+	case stop := <-d.stops:
+		d.mu.Lock()
+		d.paused = stop
+		d.mu.Unlock()
+
+		return stop
+	case <-d.done:
+		return nil
+	}
+}
+
+// Done returns a channel that is closed once the program finished.
+func (d *Debugger) Done() <-chan struct{} {
+	return d.done
+}
+
+// Result returns the value of the program, or the error it was aborted
+// with, once it finished.
+func (d *Debugger) Result() (object.Object, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.result, d.err
+}
+
+// Paused returns where the program is paused, or nil if it is not.
+func (d *Debugger) Paused() *Stop {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.paused
+}
+
+// Continue resumes the program until it hits a breakpoint.
+func (d *Debugger) Continue() error {
+	return d.resume(cmdContinue)
+}
+
+// StepIn resumes the program until the next line, in whatever function
+// it is.
+func (d *Debugger) StepIn() error {
+	return d.resume(cmdStepIn)
+}
+
+// StepOver resumes the program until the next line of the function it is
+// paused in, or of the function it returns to.
+func (d *Debugger) StepOver() error {
+	return d.resume(cmdStepOver)
+}
+
+// StepOut resumes the program until the function it is paused in returned.
+func (d *Debugger) StepOut() error {
+	return d.resume(cmdStepOut)
+}
+
+func (d *Debugger) resume(cmd command) error {
+	d.mu.Lock()
+	if d.paused == nil {
+		d.mu.Unlock()
+		return ErrNotPaused
+	}
+	d.paused = nil
+	d.mu.Unlock()
+
+	d.commands <- cmd
+
+	return nil
+}
+
+// Pause stops the program at the next line it runs.
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	d.pause = true
+	d.mu.Unlock()
+}
+
+// Terminate cancels the program, which runs on without stopping until the
+// evaluation notices, and waits for it to finish.
+func (d *Debugger) Terminate() {
+	d.mu.Lock()
+	started := d.started
+	d.paused = nil
+	d.mu.Unlock()
+
+	if !started {
+		return
+	}
+
+	d.cancel()
+	<-d.done
+}
+
+// hook follows the evaluation for the debugger without exporting the
+// methods of evaluator.Hook from it.
+type hook struct {
+	d *Debugger
+}
+
+func (h hook) OnNodeEnter(node ast.Node, scope evaluator.Scope) {
+	d := h.d
+
+	if _, ok := node.(*ast.Program); ok {
+		d.stack = append(d.stack[:0], &frame{name: "main"})
+	}
+
+	f := d.stack[len(d.stack)-1]
+	f.scope = scope
+
+	switch node := node.(type) {
+	case *ast.CallExpression:
+		f.calls = append(f.calls, node)
+	case *ast.BlockStatement:
+	case ast.Statement:
+		f.statement = node
+		if line := node.Pos().Line; line != f.line {
+			f.line = line
+			if reason := d.reason(node); reason != "" {
+				d.stop(reason)
+			}
+		}
+	}
+}
+
+func (h hook) OnNodeExit(node ast.Node, result object.Object) {
+	if _, ok := node.(*ast.CallExpression); ok {
+		f := h.d.stack[len(h.d.stack)-1]
+		f.calls = f.calls[:len(f.calls)-1]
+	}
+}
+
+func (h hook) OnCall(fn object.Object, args []object.Object) {
+	if fn, ok := fn.(*object.Function); ok {
+		h.d.stack = append(h.d.stack, &frame{name: functionName(fn), function: fn})
+	}
+}
+
+func (h hook) OnReturn(fn object.Object, result object.Object) {
+	if _, ok := fn.(*object.Function); ok {
+		h.d.stack = h.d.stack[:len(h.d.stack)-1]
+	}
+}
+
+// reason returns why the program stops at statement, which starts a line,
+// or the empty string if it does not.
+func (d *Debugger) reason(statement ast.Statement) string {
+	if d.ctx.Err() != nil {
+		return ""
+	}
+
+	d.mu.Lock()
+	bp := d.breakpoints[statement.Pos().Line]
+	pause := d.pause
+	d.pause = false
+	d.mu.Unlock()
+
+	if bp != nil && d.hit(bp) {
+		return ReasonBreakpoint
+	}
+
+	switch {
+	case pause:
+		return ReasonPause
+	case d.mode == cmdStepIn,
+		d.mode == cmdStepOver && len(d.stack) <= d.depth,
+		d.mode == cmdStepOut && len(d.stack) < d.depth:
+		if d.depth == 0 {
+			return ReasonEntry
+		}
+		return ReasonStep
+	}
+
+	return ""
+}
+
+// stop pauses the evaluation until the program is resumed or terminated.
+func (d *Debugger) stop(reason string) {
+	stop := &Stop{Reason: reason}
+	for i := len(d.stack) - 1; i >= 0; i-- {
+		stop.Frames = append(stop.Frames, d.stack[i].snapshot())
+	}
+
+	select {
+	case d.stops <- stop:
+	case <-d.ctx.Done():
+		return
+	}
+
+	select {
+	case d.mode = <-d.commands:
+		d.depth = len(d.stack)
+	case <-d.ctx.Done():
+	}
+}
@@ -0,0 +1,201 @@
+package debugger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+const input = `let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+let twice = fn(n) {
+  let once = add(n, n);
+  add(once, once)
+};
+let x = twice(2);
+x + 1`
+
+func parseInput(t *testing.T) *ast.Program {
+	t.Helper()
+
+	program, err := parse(input)
+	if err != nil {
+		t.Fatalf("parse error: %s", err)
+	}
+
+	return program
+}
+
+// where describes the stack of stop as "reason: name@line:column ...".
+func where(stop *Stop) string {
+	if stop == nil {
+		return "finished"
+	}
+
+	var frames []string
+	for _, f := range stop.Frames {
+		frames = append(frames, f.Name+"@"+f.Pos.String())
+	}
+
+	return stop.Reason + ": " + strings.Join(frames, " ")
+}
+
+func TestStepping(t *testing.T) {
+	d := New(parseInput(t), WithStopOnEntry())
+	if err := d.Start(object.NewEnvironment()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		resume   func() error
+		expected string
+	}{
+		{nil, "entry: main@1:1"},
+		{d.StepOver, "step: main@5:1"},
+		{d.StepOver, "step: main@9:1"},
+		{d.StepIn, "step: twice@6:3 main@9:9"},
+		{d.StepIn, "step: add@2:3 twice@6:14 main@9:9"},
+		{d.StepOver, "step: add@3:3 twice@6:14 main@9:9"},
+		// the rest of line 6 is not a step of its own
+		{d.StepOut, "step: twice@7:3 main@9:9"},
+		{d.StepOver, "step: main@10:1"},
+		{d.Continue, "finished"},
+	}
+
+	for i, tt := range tests {
+		if tt.resume != nil {
+			if err := tt.resume(); err != nil {
+				t.Fatalf("test[%d]: %s", i, err)
+			}
+		}
+		if got := where(d.Wait()); got != tt.expected {
+			t.Errorf("test[%d]: wrong stop. expected=%q, got=%q", i, tt.expected, got)
+		}
+	}
+
+	result, err := d.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Inspect() != "9" {
+		t.Errorf("wrong result. expected=9, got=%s", result.Inspect())
+	}
+	if err := d.Continue(); err != ErrNotPaused {
+		t.Errorf("wrong error. expected=%v, got=%v", ErrNotPaused, err)
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	d := New(parseInput(t))
+
+	got := d.SetBreakpoints([]Breakpoint{
+		{Line: 3, Condition: "sum > 5"},
+		{Line: 4},
+		{Line: 2, Condition: "sum +"},
+		{Line: 11},
+	})
+	expected := []struct {
+		line     int
+		verified bool
+		message  string
+	}{
+		{3, true, ""},
+		{5, true, ""},
+		{2, false, "invalid condition: no prefix parse function for EOF found"},
+		{11, false, "no statement on or after line 11"},
+	}
+	for i, bp := range got {
+		if bp.Line != expected[i].line || bp.Verified != expected[i].verified || bp.Message != expected[i].message {
+			t.Errorf("wrong breakpoint %d. expected=%+v, got=%+v", i, expected[i], bp)
+		}
+	}
+
+	globals := object.NewEnclosedEnvironment(object.NewEnvironment())
+	globals.Outer().Set("base", object.NewInteger(1))
+	if err := d.Start(globals); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := where(d.Wait()); got != "breakpoint: main@5:1" {
+		t.Fatalf("wrong stop. got=%q", got)
+	}
+	d.Continue()
+
+	stop := d.Wait()
+	if got := where(stop); got != "breakpoint: add@3:3 twice@7:3 main@9:9" {
+		t.Fatalf("wrong stop. got=%q", got)
+	}
+
+	var locals []string
+	for _, v := range stop.Frames[0].Locals() {
+		locals = append(locals, v.Name+"="+v.Value.Inspect())
+	}
+	if got := strings.Join(locals, " "); got != "a=4 b=4 sum=8" {
+		t.Errorf("wrong locals. expected=%q, got=%q", "a=4 b=4 sum=8", got)
+	}
+
+	env := stop.Frames[0].Globals()
+	if got := strings.Join(env.Names(), " "); got != "add twice" {
+		t.Errorf("wrong globals. expected=%q, got=%q", "add twice", got)
+	}
+	if got := strings.Join(env.Outer().Names(), " "); got != "base" {
+		t.Errorf("wrong outer globals. expected=%q, got=%q", "base", got)
+	}
+
+	evaluations := []struct {
+		frame    int
+		expr     string
+		expected string
+	}{
+		{0, "a * b + sum + base", "25"},
+		{1, "once", "4"},
+		{1, "let y = n * 10; y", "20"},
+		{2, "add(1, 2)", "3"},
+		{2, "n", "ERROR: identifier not found: n"},
+	}
+	for _, tt := range evaluations {
+		result, err := stop.Frames[tt.frame].Evaluate(tt.expr)
+		if err != nil {
+			t.Errorf("evaluating %q: %s", tt.expr, err)
+			continue
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("wrong value of %q. expected=%s, got=%s", tt.expr, tt.expected, result.Inspect())
+		}
+	}
+	if _, err := stop.Frames[0].Evaluate("let"); err == nil {
+		t.Errorf("expected an error for an invalid expression")
+	}
+
+	d.Continue()
+	if got := where(d.Wait()); got != "finished" {
+		t.Errorf("wrong stop. expected=finished, got=%q", got)
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	d := New(parseInput(t), WithStopOnEntry())
+	d.Terminate()
+
+	if err := d.Start(object.NewEnvironment()); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Start(object.NewEnvironment()); err != ErrStarted {
+		t.Errorf("wrong error. expected=%v, got=%v", ErrStarted, err)
+	}
+	if got := where(d.Wait()); got != "entry: main@1:1" {
+		t.Fatalf("wrong stop. got=%q", got)
+	}
+
+	d.Terminate()
+	if stop := d.Wait(); stop != nil {
+		t.Errorf("expected the program to have finished. got=%q", where(stop))
+	}
+	if d.Paused() != nil {
+		t.Errorf("expected the program not to be paused")
+	}
+}
@@ -0,0 +1,141 @@
+package debugger
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+	"github.com/cupsadarius/monkey_interpreter/resolver"
+	"github.com/cupsadarius/monkey_interpreter/token"
+)
+
+// how many nodes evaluating an expression, or a breakpoint condition, may
+// take, so that a mistyped call cannot hang the program
+const evaluateSteps = 1000000
+
+// frame is a function call, or the top level of the program, while it
+// runs.
+type frame struct {
+	name     string
+	function *object.Function
+	scope    evaluator.Scope
+
+	statement ast.Statement         // the statement running
+	calls     []*ast.CallExpression // the calls of it running, innermost last
+	line      int                   // the line of the last statement that started one
+}
+
+func (f *frame) snapshot() *Frame {
+	var node ast.Node = f.statement
+	if len(f.calls) > 0 {
+		node = f.calls[len(f.calls)-1]
+	}
+
+	return &Frame{Name: f.name, Function: f.function, Pos: node.Pos(), scope: f.scope}
+}
+
+// functionName returns the name fn is bound to, or where it is defined.
+func functionName(fn *object.Function) string {
+	fl := fn.Literal
+	if fl == nil {
+		return "anonymous"
+	}
+	if fl.Name != "" {
+		return fl.Name
+	}
+
+	return fmt.Sprintf("anonymous@%d:%d", fl.Token.Line, fl.Token.Column)
+}
+
+// Frame is a function call, or the top level of the program, where the
+// program stopped. Its variables can only be inspected until the program
+// is resumed.
+type Frame struct {
+	Name     string
+	Function *object.Function // nil for the top level
+	// Pos is the start of the statement running, or of the innermost call
+	// running in it.
+	Pos token.Position
+
+	scope evaluator.Scope
+}
+
+// Variable is a variable and its value.
+type Variable struct {
+	Name  string
+	Value object.Object
+}
+
+// Locals returns the parameters and lets of the function, and the
+// variables it captured, that have a value, sorted by name. It is empty
+// for the top level, whose variables are globals.
+func (f *Frame) Locals() []Variable {
+	var locals []Variable
+	for name, value := range f.scope.Locals() {
+		locals = append(locals, Variable{Name: name, Value: value})
+	}
+	sort.Slice(locals, func(i, j int) bool { return locals[i].Name < locals[j].Name })
+
+	return locals
+}
+
+// Globals returns the environment of the globals of the function, which
+// may be enclosed in others.
+func (f *Frame) Globals() *object.Environment {
+	return f.scope.Globals()
+}
+
+// Get returns the value of the variable name as seen from the frame.
+func (f *Frame) Get(name string) (object.Object, bool) {
+	return f.scope.Get(name)
+}
+
+// Evaluate evaluates expr, a program, with the variables of the frame.
+// Lets of expr define variables of its own, which are dropped afterwards.
+// Errors raised by expr are returned as *object.Error values.
+func (f *Frame) Evaluate(expr string) (object.Object, error) {
+	return evaluate(f.scope, expr)
+}
+
+func evaluate(scope evaluator.Scope, expr string) (object.Object, error) {
+	program, err := parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return evaluateProgram(scope, program)
+}
+
+func parse(expr string) (*ast.Program, error) {
+	p := parser.New(lexer.New(expr))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s", strings.Join(p.Errors(), "; "))
+	}
+	resolver.Resolve(program, nil)
+
+	return program, nil
+}
+
+func evaluateProgram(scope evaluator.Scope, program *ast.Program) (object.Object, error) {
+	env := object.NewEnclosedEnvironment(scope.Globals())
+	for name, value := range scope.Locals() {
+		env.Set(name, value)
+	}
+
+	result, err := evaluator.EvalContext(context.Background(), program, env, evaluator.WithLimits(evaluator.Limits{MaxSteps: evaluateSteps}))
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		result = object.NULL
+	}
+
+	return result, nil
+}
@@ -0,0 +1,31 @@
+package evaluator
+
+import (
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+var benchmarks = []struct {
+	name  string
+	input string
+}{
+	{"Fibonacci", "let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(15);"},
+	{"CountingLoop", "let loop = fn(i, sum) { if (i == 0) { return sum; } loop(i - 1, sum + i) }; loop(500, 0);"},
+	{"TailReturn", "let fib = fn(n) { if (n < 2) { return n; } return fib(n - 1) + fib(n - 2); }; fib(15);"},
+	{"StringLiterals", `let loop = fn(i) { if (i == 0) { return "done"; } let s = "monkey"; loop(i - 1) }; loop(500);`},
+}
+
+func BenchmarkEval(b *testing.B) {
+	for _, bm := range benchmarks {
+		program := parse(bm.input)
+
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				Eval(program, object.NewEnvironment())
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/cupsadarius/monkey_interpreter/ast"
@@ -8,91 +9,173 @@ import (
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
+// Eval evaluates node in env without any resource limits. Programs that
+// have not been resolved with resolver.Resolve look their variables up by
+// name, which is slower; Eval never resolves them itself, so that a program
+// can be evaluated by any number of goroutines at once.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	s := newState(context.Background())
+	return s.eval(node, &frame{globals: env})
+}
+
+// EvalContext evaluates node in env, stopping as soon as ctx is done or one
+// of the configured limits is exceeded. Errors raised by the script itself
+// are returned as *object.Error values; the error result is reserved for
+// aborted evaluations and is either ctx.Err() or one of the Err*Exceeded
+// values.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, opts ...Option) (object.Object, error) {
+	s := newState(ctx, opts...)
+
+	result := s.eval(node, &frame{globals: env})
+	if s.Err() != nil {
+		return nil, s.Err()
+	}
+
+	return result, nil
+}
+
+// CallContext calls fn, which must be a function or a builtin, with args.
+// Like EvalContext it returns a non-nil error only when the call has been
+// aborted by ctx or by one of the configured limits. Calls made with the
+// context handed to a builtin are charged to the evaluation that called the
+// builtin, whose limits apply instead.
+func CallContext(ctx context.Context, fn object.Object, args []object.Object, opts ...Option) (object.Object, error) {
+	s := newState(ctx, opts...)
+
+	result := s.applyFunction(fn, args)
+	if s.Err() != nil {
+		return nil, s.Err()
+	}
+
+	return result, nil
+}
+
+func (s *state) eval(node ast.Node, f *frame) object.Object {
+	// the hook is checked here rather than in a wrapper around eval, so
+	// that evaluations without a hook pay for nothing but the check
+	if s.hook != nil {
+		if !s.hooking {
+			return s.evalHooked(node, f)
+		}
+		s.hooking = false
+	}
+
+	if !s.Step() {
+		return s.Aborted()
+	}
+
 	switch node := node.(type) {
 
 	// Statements
 	case *ast.Program:
-		return evalProgram(node, env)
+		return s.evalProgram(node, f)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return s.eval(node.Expression, f)
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := s.eval(node.Right, f)
 		if isError(right) {
 			return right
 		}
 
-		return evalPrefixExpression(node.Operator, right)
+		return s.Allocated(evalPrefixExpression(node.Operator, right))
 	case *ast.InfixExpression:
-		right := Eval(node.Right, env)
+		right := s.eval(node.Right, f)
 		if isError(right) {
 			return right
 		}
 
-		left := Eval(node.Left, env)
+		left := s.eval(node.Left, f)
 		if isError(left) {
 			return left
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		return s.Allocated(evalInfixExpression(node.Operator, left, right))
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return s.evalBlockStatement(node, f)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return s.evalIfExpression(node, f)
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		function := s.eval(node.Function, f)
 		if isError(function) {
 			return function
 		}
 
-		args := evalExpressions(node.Arguments, env)
+		args := s.evalExpressions(node.Arguments, f)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		return s.applyFunction(function, args)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		tail := node == s.tail
+		val := s.eval(node.ReturnValue, f)
 		if isError(val) {
 			return val
 		}
 
+		// a return ending a function body or the program has nothing left
+		// to skip, so its value need not be wrapped
+		if tail {
+			return val
+		}
+
 		return &object.ReturnValue{Value: val}
 
 		// Expressions
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return s.Allocated(object.NewInteger(node.Value))
 	case *ast.FloatLiteral:
-		return &object.Float{Value: node.Value}
+		return s.Allocated(&object.Float{Value: node.Value})
 	case *ast.BooleanLiteral:
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
+		return s.stringLiteral(node)
 	case *ast.FunctionLiteral:
-		params := node.Parameters
-		body := node.Body
-
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return s.Allocated(&object.Function{
+			Literal:    node,
+			Parameters: node.Parameters,
+			Body:       node.Body,
+			Env:        f.globals,
+			Layout:     node.Layout,
+			Free:       f.Capture(node.Layout),
+		})
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		val := s.eval(node.Value, f)
 		if isError(val) {
 			return val
 		}
 
-		env.Set(node.Name.Value, val)
+		f.set(node.Name, val)
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return evalIdentifier(node, f)
+	case *ast.MemberExpression:
+		obj := s.eval(node.Object, f)
+		if isError(obj) {
+			return obj
+		}
+
+		return s.Allocated(evalMemberExpression(obj, node.Property.Value))
 	}
 
 	return nil
 }
 
+// evalHooked evaluates node between the calls of the hook.
+func (s *state) evalHooked(node ast.Node, f *frame) object.Object {
+	s.hook.OnNodeEnter(node, Scope{f, s.Meter})
+	s.hooking = true
+	result := s.eval(node, f)
+	s.hook.OnNodeExit(node, result)
+
+	return result
+}
+
 func evalInfixExpression(operator string, left object.Object, right object.Object) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
@@ -135,13 +218,16 @@ func evalIntegerInfixExpression(operator string, left object.Object, right objec
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return object.NewInteger(leftVal + rightVal)
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		return object.NewInteger(leftVal - rightVal)
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return object.NewInteger(leftVal / rightVal)
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return object.NewInteger(leftVal * rightVal)
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
@@ -196,7 +282,7 @@ func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 
 	if right.Type() == object.INTEGER_OBJ {
 		value := right.(*object.Integer).Value
-		return &object.Integer{Value: -value}
+		return object.NewInteger(-value)
 	}
 
 	if right.Type() == object.FLOAT_OBJ {
@@ -228,11 +314,14 @@ func nativeBoolToBooleanObject(input bool) object.Object {
 	return FALSE
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (s *state) evalProgram(program *ast.Program, f *frame) object.Object {
 	var result object.Object
 
-	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+	for i, statement := range program.Statements {
+		if i == len(program.Statements)-1 {
+			s.tail = statement
+		}
+		result = s.eval(statement, f)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
@@ -245,11 +334,15 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (s *state) evalBlockStatement(block *ast.BlockStatement, f *frame) object.Object {
 	var result object.Object
 
-	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+	body := block == s.tail
+	for i, statement := range block.Statements {
+		if body && i == len(block.Statements)-1 {
+			s.tail = statement
+		}
+		result = s.eval(statement, f)
 		if result != nil {
 
 			rt := result.Type()
@@ -284,34 +377,61 @@ func isError(obj object.Object) bool {
 	return false
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func (s *state) evalIfExpression(ie *ast.IfExpression, f *frame) object.Object {
+	condition := s.eval(ie.Condition, f)
 	if isError(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return s.eval(ie.Consequence, f)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return s.eval(ie.Alternative, f)
 	}
 
 	return NULL
 }
 
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
-	val, ok := env.Get(node.Value)
+func evalMemberExpression(obj object.Object, name string) object.Object {
+	getter, ok := obj.(object.MemberGetter)
 	if !ok {
-		return newError("identifier not found: %s", node.Value)
+		return newError("member access not supported: %s.%s", obj.Type(), name)
 	}
 
-	return val
+	return getter.GetMember(name)
 }
 
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
-	var result []object.Object
+// stringLiteral returns the object of a string literal, creating it the
+// first time the literal is evaluated.
+func (s *state) stringLiteral(node *ast.StringLiteral) object.Object {
+	if str, ok := s.strings[node]; ok {
+		return str
+	}
+
+	if s.strings == nil {
+		s.strings = map[*ast.StringLiteral]*object.String{}
+	}
+
+	str := &object.String{Value: node.Value}
+	s.strings[node] = str
+
+	return s.Allocated(str)
+}
+
+func evalIdentifier(node *ast.Identifier, f *frame) object.Object {
+	for ident := node; ident != nil; ident = ident.Shadowed {
+		if val, ok := f.get(ident); ok {
+			return val
+		}
+	}
+
+	return newError("identifier not found: %s", node.Value)
+}
+
+func (s *state) evalExpressions(exps []ast.Expression, f *frame) []object.Object {
+	result := make([]object.Object, 0, len(exps))
 	for _, e := range exps {
-		evaluated := Eval(e, env)
+		evaluated := s.eval(e, f)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -326,25 +446,58 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
-	function, ok := fn.(*object.Function)
-	if !ok {
-		return newError("not a function: %s", fn.Type())
-	}
+func (s *state) applyFunction(fn object.Object, args []object.Object) object.Object {
+	switch function := fn.(type) {
+	case *object.Function:
+		if len(args) != len(function.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(function.Parameters), len(args))
+		}
 
-	extendedEnv := extendFunctionEnv(function, args)
-	evaluated := Eval(function.Body, extendedEnv)
-	return unwrapReturnValue(evaluated)
-}
+		if !s.EnterCall() {
+			return s.Aborted()
+		}
+		defer s.ExitCall()
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+		if !s.Alloc() {
+			return s.Aborted()
+		}
 
-	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
-	}
+		if s.hook != nil {
+			s.hook.OnCall(function, args)
+		}
+		s.tail = function.Body
+		result := unwrapReturnValue(s.eval(function.Body, newFrame(function, args)))
+		if result == nil {
+			// the body is empty or ends with a let statement
+			result = NULL
+		}
+		if s.hook != nil {
+			s.hook.OnReturn(function, result)
+		}
+
+		return result
+	case *object.Builtin:
+		if !s.EnterCall() {
+			return s.Aborted()
+		}
+		defer s.ExitCall()
 
-	return env
+		if s.hook != nil {
+			s.hook.OnCall(function, args)
+		}
+		result := function.Call(s.Context(), args...)
+		if result == nil {
+			result = NULL
+		}
+		result = s.Allocated(result)
+		if s.hook != nil {
+			s.hook.OnReturn(function, result)
+		}
+
+		return result
+	default:
+		return newError("not a function: %s", fn.Type())
+	}
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -1,20 +1,45 @@
 package evaluator
 
 import (
+	"sync"
 	"testing"
 
+	"github.com/cupsadarius/monkey_interpreter/ast"
 	"github.com/cupsadarius/monkey_interpreter/lexer"
 	"github.com/cupsadarius/monkey_interpreter/object"
 	"github.com/cupsadarius/monkey_interpreter/parser"
+	"github.com/cupsadarius/monkey_interpreter/resolver"
 )
 
+// testEval evaluates input both resolved and not, failing with an error
+// object if the results differ.
 func testEval(input string) object.Object {
-	l := lexer.New(input)
-	p := parser.New(l)
-	program := p.ParseProgram()
-	env := object.NewEnvironment()
+	resolved := Eval(parse(input), object.NewEnvironment())
 
-	return Eval(program, env)
+	program := parser.New(lexer.New(input)).ParseProgram()
+	unresolved := Eval(program, object.NewEnvironment())
+
+	if inspect(resolved) != inspect(unresolved) {
+		return newError("results differ. resolved=%s, unresolved=%s", inspect(resolved), inspect(unresolved))
+	}
+
+	return resolved
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+
+	return string(obj.Type()) + " " + obj.Inspect()
+}
+
+// parse parses and resolves input.
+func parse(input string) *ast.Program {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	resolver.Resolve(program, nil)
+
+	return program
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
@@ -294,6 +319,7 @@ func TestErrorHandling(t *testing.T) {
 		expectedMessage string
 	}{
 		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"10 / (5 - 5);", "division by zero"},
 		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
 		{"-true", "unknown operator: -BOOLEAN"},
 		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
@@ -397,3 +423,144 @@ func TestClosure(t *testing.T) {
   `
 	testIntegerObject(t, testEval(input), 4)
 }
+
+func TestClosureCapturesOnlyUsedVariables(t *testing.T) {
+	input := `
+    let outer = fn(a, b, c) {
+      let unused = a + b;
+      fn() { c };
+    };
+
+    outer(1, 2, 3);
+  `
+	evaluated := testEval(input)
+
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Free) != 1 {
+		t.Fatalf("wrong number of captured variables. want=1, got=%d", len(fn.Free))
+	}
+
+	testIntegerObject(t, fn.Free[0].Value, 3)
+}
+
+func TestClosureSharesVariables(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let f = fn() { let x = 1; let g = fn() { x }; let x = 2; g() }; f();", 2},
+		{"let f = fn() { let g = fn() { later }; let later = 5; g() }; f();", 5},
+		{"let f = fn(a) { fn(b) { fn(c) { a + b + c } } }; f(1)(2)(3);", 6},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSmallIntegersAreShared(t *testing.T) {
+	first := testEval("let a = 3; a * 7;")
+	second := testEval("42 / 2")
+
+	if first != second {
+		t.Errorf("small integers are not shared. got=%p and %p", first, second)
+	}
+
+	if testEval("100000 * 3") == testEval("300000") {
+		t.Errorf("large integers must not be shared")
+	}
+}
+
+func TestNestedReturnValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let f = fn() { return 1; }; let g = fn() { return f() + f(); }; g();", 2},
+		{"let f = fn(x) { if (x) { return f(false) + 10; } return 5; }; f(true);", 15},
+		{"let f = fn() { return 7; }; return f() * 2;", 14},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+// TestEvalConcurrently evaluates one program from several goroutines,
+// which is only safe as long as evaluation leaves the program alone. Run it
+// with the race detector: go test -race
+func TestEvalConcurrently(t *testing.T) {
+	program := parse(`
+    let newAdder = fn(x) { fn(y) { return x + y; } };
+    let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+    newAdder(fib(10))(fn() { 5 }());
+  `)
+
+	var wg sync.WaitGroup
+	results := make(chan object.Object, 8)
+
+	for n := 0; n < cap(results); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- Eval(program, object.NewEnvironment())
+		}()
+	}
+
+	wg.Wait()
+	close(results)
+
+	for result := range results {
+		testIntegerObject(t, result, 60)
+	}
+}
+
+func TestEvalUnresolvedPrograms(t *testing.T) {
+	program := parser.New(lexer.New("let add = fn(x) { fn(y) { x + y } }; let x = 10; add(1)(2);")).ParseProgram()
+
+	evaluated := Eval(program, object.NewEnvironment())
+	testIntegerObject(t, evaluated, 3)
+
+	if program.Resolved {
+		t.Errorf("program was resolved by Eval")
+	}
+}
+
+func TestShadowedVariables(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 10; let f = fn() { let y = x; let x = 5; y }; f();", 10},
+		{"let x = 5; let f = fn() { if (false) { let x = 1; } x }; f();", 5},
+		{"let x = 1; let f = fn(b) { if (b) { let x = 2; } x }; f(false);", 1},
+		{"let x = 1; let f = fn(b) { if (b) { let x = 2; } x }; f(true);", 2},
+		{"let x = 1; let f = fn() { let x = x + 1; x }; f();", 2},
+		{"let f = fn(x) { fn() { let y = x; let x = 2; y + x } }; f(1)();", 3},
+		{"let x = 1; let f = fn() { let g = fn() { x }; let r = g(); let x = 2; r + g() }; f();", 3},
+		{"let f = fn() { let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(5) }; f();", 120},
+		{"let f = fn() { if (false) { let y = 1; } y }; f();", "identifier not found: y"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package evaluator
+
+import (
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+// frame holds the variables of a function call in the slots the resolver
+// assigned to them. The top level of a program runs in a frame without
+// slots, since all of its variables are globals. So do calls of functions
+// that have not been resolved, whose globals are an environment enclosing
+// the one they were defined in, holding their variables by name.
+type frame struct {
+	globals *object.Environment
+	layout  *ast.FrameLayout
+	Slots
+}
+
+// Slots are the locals, cells and free variables of a call, indexed as
+// the resolver numbered them. Engines other than Eval embed them in their
+// frames, so that every engine lays out calls the same way.
+type Slots struct {
+	Locals []object.Object
+	Cells  []*object.Cell
+	Free   []*object.Cell // captured by the function called
+
+	// backs Locals for the common case of functions with few locals, so
+	// that a call needs a single allocation for its frame
+	inline [inlineSlots]object.Object
+}
+
+const inlineSlots = 4
+
+// Init sets up s for a call with args of a function with layout and
+// params, which captured free.
+func (s *Slots) Init(layout *ast.FrameLayout, free []*object.Cell, params []*ast.Identifier, args []object.Object) {
+	s.Free = free
+
+	if n := len(layout.Locals); n > inlineSlots {
+		s.Locals = make([]object.Object, n)
+	} else {
+		s.Locals = s.inline[:n]
+	}
+	if n := len(layout.Cells); n > 0 {
+		s.Cells = make([]*object.Cell, n)
+		for i := range s.Cells {
+			s.Cells[i] = &object.Cell{}
+		}
+	}
+
+	for i, param := range params {
+		if param.Scope == ast.Cell {
+			s.Cells[param.Index].Value = args[i]
+		} else {
+			s.Locals[param.Index] = args[i]
+		}
+	}
+}
+
+// Capture collects the cells of the variables a closure with layout
+// captures from s.
+func (s *Slots) Capture(layout *ast.FrameLayout) []*object.Cell {
+	if layout == nil || len(layout.Free) == 0 {
+		return nil
+	}
+
+	free := make([]*object.Cell, len(layout.Free))
+	for i, ident := range layout.Free {
+		if ident.Scope == ast.Cell {
+			free[i] = s.Cells[ident.Index]
+		} else {
+			free[i] = s.Free[ident.Index]
+		}
+	}
+
+	return free
+}
+
+func newFrame(fn *object.Function, args []object.Object) *frame {
+	if fn.Layout == nil {
+		f := &frame{globals: object.NewEnclosedEnvironment(fn.Env)}
+		for i, param := range fn.Parameters {
+			f.set(param, args[i])
+		}
+
+		return f
+	}
+
+	f := &frame{globals: fn.Env, layout: fn.Layout}
+	f.Init(fn.Layout, fn.Free, fn.Parameters, args)
+
+	return f
+}
+
+func (f *frame) get(ident *ast.Identifier) (object.Object, bool) {
+	var val object.Object
+
+	switch ident.Scope {
+	case ast.Local:
+		val = f.Locals[ident.Index]
+	case ast.Cell:
+		val = f.Cells[ident.Index].Value
+	case ast.Free:
+		val = f.Free[ident.Index].Value
+	default:
+		return f.globals.Get(ident.Value)
+	}
+
+	return val, val != nil
+}
+
+func (f *frame) set(ident *ast.Identifier, val object.Object) {
+	switch ident.Scope {
+	case ast.Local:
+		f.Locals[ident.Index] = val
+	case ast.Cell:
+		f.Cells[ident.Index].Value = val
+	default:
+		f.globals.Set(ident.Value, val)
+	}
+}
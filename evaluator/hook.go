@@ -0,0 +1,105 @@
+package evaluator
+
+import (
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+// Hook observes an evaluation. Its methods are called synchronously by the
+// goroutine running the evaluation, so a hook used by several evaluations
+// at once has to be safe for concurrent use.
+type Hook interface {
+	// OnNodeEnter is called before node is evaluated in scope.
+	OnNodeEnter(node ast.Node, scope Scope)
+	// OnNodeExit is called after node has been evaluated to result, which
+	// is nil for let statements.
+	OnNodeExit(node ast.Node, result object.Object)
+	// OnCall is called before fn, a function or builtin, is applied to
+	// args.
+	OnCall(fn object.Object, args []object.Object)
+	// OnReturn is called when a call of fn returned result.
+	OnReturn(fn object.Object, result object.Object)
+}
+
+// WithHook installs a hook that is told about every node evaluated and every
+// function called.
+func WithHook(hook Hook) Option {
+	return func(s *state) {
+		s.hook = hook
+	}
+}
+
+// Scope gives access to the variables visible while a node is evaluated.
+// It is only valid while the evaluation is blocked in a hook, and only
+// until the function call, or the program, the node belongs to returns.
+type Scope struct {
+	f     *frame
+	meter *Meter
+}
+
+// Allocations returns how many objects the evaluation has allocated so
+// far.
+func (sc Scope) Allocations() int64 {
+	return sc.meter.allocs.Load()
+}
+
+// Globals returns the global environment.
+func (sc Scope) Globals() *object.Environment {
+	return sc.f.globals
+}
+
+// Get returns the value of the variable name as seen from the node.
+func (sc Scope) Get(name string) (object.Object, bool) {
+	if layout := sc.f.layout; layout != nil {
+		for i, local := range layout.Locals {
+			if local == name {
+				val := sc.f.Locals[i]
+				return val, val != nil
+			}
+		}
+		for i, cell := range layout.Cells {
+			if cell == name {
+				val := sc.f.Cells[i].Value
+				return val, val != nil
+			}
+		}
+		for i, free := range layout.Free {
+			if free.Value == name {
+				val := sc.f.Free[i].Value
+				return val, val != nil
+			}
+		}
+	}
+
+	return sc.f.globals.Get(name)
+}
+
+// Locals returns the variables of the function being evaluated, including
+// those it captured from enclosing functions, which have a value so far.
+// It is empty at the top level of a program.
+func (sc Scope) Locals() map[string]object.Object {
+	locals := map[string]object.Object{}
+
+	layout := sc.f.layout
+	if layout == nil {
+		return locals
+	}
+
+	for i, free := range layout.Free {
+		if val := sc.f.Free[i].Value; val != nil {
+			locals[free.Value] = val
+		}
+	}
+	for i, name := range layout.Locals {
+		if val := sc.f.Locals[i]; val != nil {
+			locals[name] = val
+		}
+	}
+	for i, name := range layout.Cells {
+		if val := sc.f.Cells[i].Value; val != nil {
+			locals[name] = val
+		}
+	}
+
+	return locals
+}
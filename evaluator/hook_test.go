@@ -0,0 +1,193 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+// recorder is a hook writing down everything it is told.
+type recorder struct {
+	events []string
+	depth  int
+	onNode func(node ast.Node, scope Scope)
+}
+
+func (r *recorder) OnNodeEnter(node ast.Node, scope Scope) {
+	r.depth++
+	if r.onNode != nil {
+		r.onNode(node, scope)
+	}
+}
+
+func (r *recorder) OnNodeExit(node ast.Node, result object.Object) {
+	r.depth--
+}
+
+func (r *recorder) OnCall(fn object.Object, args []object.Object) {
+	r.events = append(r.events, fmt.Sprintf("call %s%s", name(fn), inspectAll(args)))
+}
+
+func (r *recorder) OnReturn(fn object.Object, result object.Object) {
+	r.events = append(r.events, fmt.Sprintf("return %s %s", name(fn), result.Inspect()))
+}
+
+func name(fn object.Object) string {
+	if builtin, ok := fn.(*object.Builtin); ok {
+		return builtin.Name
+	}
+	return "fn"
+}
+
+func inspectAll(objects []object.Object) string {
+	out := make([]string, len(objects))
+	for i, obj := range objects {
+		out[i] = obj.Inspect()
+	}
+	return "(" + strings.Join(out, ", ") + ")"
+}
+
+func evalWithHook(t *testing.T, input string, env *object.Environment, hook Hook) object.Object {
+	t.Helper()
+
+	program := parse(input)
+	result, err := EvalContext(context.Background(), program, env, WithHook(hook))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return result
+}
+
+func TestHookCalls(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("double", &object.Builtin{Name: "double", Fn: func(args ...object.Object) object.Object {
+		return object.NewInteger(args[0].(*object.Integer).Value * 2)
+	}})
+
+	r := &recorder{}
+	evaluated := evalWithHook(t, "let add = fn(x, y) { x + y }; add(1, double(add(2, 3)));", env, r)
+	testIntegerObject(t, evaluated, 11)
+
+	expected := []string{
+		"call fn(2, 3)",
+		"return fn 5",
+		"call double(5)",
+		"return double 10",
+		"call fn(1, 10)",
+		"return fn 11",
+	}
+	if strings.Join(r.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong events.\nwant=%v\ngot =%v", expected, r.events)
+	}
+
+	if r.depth != 0 {
+		t.Errorf("node enters and exits don't match. depth=%d", r.depth)
+	}
+}
+
+func TestHookScope(t *testing.T) {
+	input := `
+    let offset = 100;
+    let outer = fn(a) {
+      let b = a * 2;
+      let inner = fn(c) { a + b + c + offset };
+      inner(3);
+    };
+    outer(1);
+  `
+
+	var locals map[string]object.Object
+	var offset, a object.Object
+	r := &recorder{onNode: func(node ast.Node, scope Scope) {
+		infix, ok := node.(*ast.InfixExpression)
+		if !ok || infix.String() != "(((a + b) + c) + offset)" {
+			return
+		}
+		locals = scope.Locals()
+		offset, _ = scope.Get("offset")
+		a, _ = scope.Get("a")
+	}}
+
+	evaluated := evalWithHook(t, input, object.NewEnvironment(), r)
+	testIntegerObject(t, evaluated, 106)
+
+	if len(locals) != 3 {
+		t.Fatalf("wrong locals. got=%v", locals)
+	}
+	for name, value := range map[string]int64{"a": 1, "b": 2, "c": 3} {
+		testIntegerObject(t, locals[name], value)
+	}
+	testIntegerObject(t, offset, 100)
+	testIntegerObject(t, a, 1)
+}
+
+func TestHookSeesEveryNode(t *testing.T) {
+	counts := map[string]int{}
+	r := &recorder{onNode: func(node ast.Node, scope Scope) {
+		counts[fmt.Sprintf("%T", node)]++
+	}}
+
+	evalWithHook(t, "let a = 1; if (a < 2) { -a } else { 0 };", object.NewEnvironment(), r)
+
+	expected := map[string]int{
+		"*ast.Program":             1,
+		"*ast.LetStatement":        1,
+		"*ast.ExpressionStatement": 2,
+		"*ast.IfExpression":        1,
+		"*ast.InfixExpression":     1,
+		"*ast.Identifier":          2,
+		"*ast.IntegerLiteral":      2,
+		"*ast.BlockStatement":      1,
+		"*ast.PrefixExpression":    1,
+	}
+	for typ, count := range expected {
+		if counts[typ] != count {
+			t.Errorf("wrong count of %s. expected=%d, got=%d", typ, count, counts[typ])
+		}
+	}
+}
+
+type nopHook struct{}
+
+func (nopHook) OnNodeEnter(ast.Node, Scope)           {}
+func (nopHook) OnNodeExit(ast.Node, object.Object)    {}
+func (nopHook) OnCall(object.Object, []object.Object) {}
+func (nopHook) OnReturn(object.Object, object.Object) {}
+
+// BenchmarkHook runs every program of BenchmarkEval through plain Eval,
+// through EvalContext without a hook and with a hook that does nothing, so
+// that the cost of the support for hooks and of an installed hook show side
+// by side.
+func BenchmarkHook(b *testing.B) {
+	for _, bm := range benchmarks {
+		program := parse(bm.input)
+
+		for _, variant := range []struct {
+			name string
+			eval func(env *object.Environment)
+		}{
+			{"Eval", func(env *object.Environment) {
+				Eval(program, env)
+			}},
+			{"NoHook", func(env *object.Environment) {
+				EvalContext(context.Background(), program, env)
+			}},
+			{"NopHook", func(env *object.Environment) {
+				EvalContext(context.Background(), program, env, WithHook(nopHook{}))
+			}},
+		} {
+			b.Run(bm.name+"/"+variant.name, func(b *testing.B) {
+				b.ReportAllocs()
+
+				for i := 0; i < b.N; i++ {
+					variant.eval(object.NewEnvironment())
+				}
+			})
+		}
+	}
+}
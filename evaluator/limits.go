@@ -0,0 +1,229 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+var (
+	ErrStepLimitExceeded       = errors.New("step limit exceeded")
+	ErrTimeLimitExceeded       = errors.New("time limit exceeded")
+	ErrAllocationLimitExceeded = errors.New("allocation limit exceeded")
+	ErrDepthLimitExceeded      = errors.New("call depth limit exceeded")
+)
+
+// how many steps are taken between two checks of the context and the clock
+const checkInterval = 256
+
+// Limits bounds the resources a single evaluation may use.
+// A zero value for any of the fields means that resource is unlimited.
+type Limits struct {
+	MaxSteps       int64         // number of AST nodes evaluated
+	MaxDuration    time.Duration // wall-clock time
+	MaxAllocations int64         // number of objects allocated
+	MaxCallDepth   int           // number of nested function calls
+}
+
+type Option func(*state)
+
+// WithLimits sets the resource limits for an evaluation.
+func WithLimits(limits Limits) Option {
+	return func(s *state) {
+		s.limits = limits
+	}
+}
+
+// state holds everything that belongs to a single evaluation.
+type state struct {
+	*Meter
+	limits Limits
+	hook   Hook
+
+	// hooking tells eval that the hook has already been told about the
+	// node it is called with.
+	hooking bool
+
+	// tail is the function body or statement evaluated last in a function
+	// body or the program, see the evaluation of return statements.
+	tail ast.Node
+
+	// strings holds the objects of the string literals evaluated so far,
+	// which can be shared since strings are immutable.
+	strings map[*ast.StringLiteral]*object.String
+}
+
+func newState(ctx context.Context, opts ...Option) *state {
+	s := &state{}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.Meter = MeterFor(ctx, s.limits)
+
+	return s
+}
+
+// Meter enforces Limits and the cancellation of a context for a single
+// evaluation. Execution engines other than Eval use it to apply the same
+// limits with the same errors. It is safe for concurrent use, so that
+// builtins may call back into Monkey from other goroutines.
+type Meter struct {
+	ctx      context.Context
+	limits   Limits
+	deadline time.Time
+
+	steps  atomic.Int64
+	allocs atomic.Int64
+	depth  atomic.Int64
+
+	// set once the evaluation has been aborted
+	abortion atomic.Pointer[abortion]
+
+	// handed to builtins, see Context
+	builtinCtx context.Context
+}
+
+// abortion tells why an evaluation has been aborted; aborted is the error
+// object used to unwind the evaluation back to its entry point.
+type abortion struct {
+	err     error
+	aborted *object.Error
+}
+
+func NewMeter(ctx context.Context, limits Limits) *Meter {
+	m := &Meter{ctx: ctx, limits: limits}
+	m.builtinCtx = context.WithValue(ctx, meterKey{}, m)
+
+	if limits.MaxDuration > 0 {
+		m.deadline = time.Now().Add(limits.MaxDuration)
+	}
+
+	return m
+}
+
+// meterKey is the key of the meter in the contexts handed to builtins.
+type meterKey struct{}
+
+// MeterFor returns the meter an evaluation under ctx is charged to: the one
+// of the evaluation that handed ctx to a builtin, so that calling back into
+// Monkey cannot escape its limits, or else a new one enforcing limits.
+func MeterFor(ctx context.Context, limits Limits) *Meter {
+	if m, ok := ctx.Value(meterKey{}).(*Meter); ok {
+		return m
+	}
+
+	return NewMeter(ctx, limits)
+}
+
+// Context returns the context handed to the builtins the evaluation calls.
+// Evaluations under it are charged to m, including those started by other
+// goroutines, so it must not be used once the builtin returned.
+func (m *Meter) Context() context.Context {
+	return m.builtinCtx
+}
+
+// Err returns why the evaluation has been aborted, or nil.
+func (m *Meter) Err() error {
+	if a := m.abortion.Load(); a != nil {
+		return a.err
+	}
+
+	return nil
+}
+
+// Aborted returns the error object that unwinds an aborted evaluation.
+func (m *Meter) Aborted() object.Object {
+	if a := m.abortion.Load(); a != nil {
+		return a.aborted
+	}
+
+	return nil
+}
+
+func (m *Meter) abort(err error) bool {
+	m.abortion.CompareAndSwap(nil, &abortion{err: err, aborted: newError("evaluation aborted: %s", err)})
+
+	return false
+}
+
+// Step accounts for a single evaluated node and reports whether the
+// evaluation may continue.
+func (m *Meter) Step() bool {
+	if m.abortion.Load() != nil {
+		return false
+	}
+
+	steps := m.steps.Add(1)
+
+	if m.limits.MaxSteps > 0 && steps > m.limits.MaxSteps {
+		return m.abort(ErrStepLimitExceeded)
+	}
+
+	if steps%checkInterval == 0 {
+		if err := m.ctx.Err(); err != nil {
+			return m.abort(err)
+		}
+		if !m.deadline.IsZero() && time.Now().After(m.deadline) {
+			return m.abort(ErrTimeLimitExceeded)
+		}
+	}
+
+	return true
+}
+
+// Alloc accounts for a single allocated object and reports whether the
+// evaluation may continue.
+func (m *Meter) Alloc() bool {
+	if m.abortion.Load() != nil {
+		return false
+	}
+
+	allocs := m.allocs.Add(1)
+
+	if m.limits.MaxAllocations > 0 && allocs > m.limits.MaxAllocations {
+		return m.abort(ErrAllocationLimitExceeded)
+	}
+
+	return true
+}
+
+// Allocated accounts for obj if it is a freshly allocated object and returns
+// it, or the abort error if the allocation limit has been exceeded.
+func (m *Meter) Allocated(obj object.Object) object.Object {
+	if object.Interned(obj) || isError(obj) {
+		return obj
+	}
+
+	if !m.Alloc() {
+		return m.Aborted()
+	}
+
+	return obj
+}
+
+// EnterCall accounts for a function call and reports whether the evaluation
+// may continue. Every successful EnterCall must be paired with ExitCall.
+func (m *Meter) EnterCall() bool {
+	if m.abortion.Load() != nil {
+		return false
+	}
+
+	depth := m.depth.Add(1)
+
+	if m.limits.MaxCallDepth > 0 && depth > int64(m.limits.MaxCallDepth) {
+		m.depth.Add(-1)
+		return m.abort(ErrDepthLimitExceeded)
+	}
+
+	return true
+}
+
+func (m *Meter) ExitCall() {
+	m.depth.Add(-1)
+}
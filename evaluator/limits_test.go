@@ -0,0 +1,146 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+const infiniteRecursion = `
+  let loop = fn(x) { loop(x + 1); };
+  loop(0);
+`
+
+func testEvalContext(ctx context.Context, input string, limits Limits) (object.Object, error) {
+	program := parse(input)
+	env := object.NewEnvironment()
+
+	return EvalContext(ctx, program, env, WithLimits(limits))
+}
+
+func TestEvalContextWithinLimits(t *testing.T) {
+	input := "let add = fn(x, y) { x + y; }; add(1, 2);"
+
+	limits := Limits{MaxSteps: 100, MaxDuration: time.Second, MaxAllocations: 100, MaxCallDepth: 10}
+	evaluated, err := testEvalContext(context.Background(), input, limits)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	testIntegerObject(t, evaluated, 3)
+}
+
+func TestEvalContextLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		limits   Limits
+		expected error
+	}{
+		{"steps", infiniteRecursion, Limits{MaxSteps: 1000}, ErrStepLimitExceeded},
+		{"time", infiniteRecursion, Limits{MaxDuration: 10 * time.Millisecond, MaxCallDepth: 1 << 20}, ErrTimeLimitExceeded},
+		{"allocations", infiniteRecursion, Limits{MaxAllocations: 1000}, ErrAllocationLimitExceeded},
+		{"depth", infiniteRecursion, Limits{MaxCallDepth: 100}, ErrDepthLimitExceeded},
+		{"allocations in arithmetic", "10000 + 20000 + 30000 + 40000", Limits{MaxAllocations: 3}, ErrAllocationLimitExceeded},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEvalContext(context.Background(), tt.input, tt.limits)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%s: wrong error. expected=%v, got=%v", tt.name, tt.expected, err)
+		}
+		if evaluated != nil {
+			t.Errorf("%s: expected no result, got=%T (%+v)", tt.name, evaluated, evaluated)
+		}
+	}
+}
+
+func TestEvalContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := testEvalContext(ctx, infiniteRecursion, Limits{MaxCallDepth: 1 << 20})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("wrong error. expected=%v, got=%v", context.Canceled, err)
+	}
+}
+
+func TestEvalContextScriptErrors(t *testing.T) {
+	evaluated, err := testEvalContext(context.Background(), "5 + true;", Limits{MaxSteps: 100})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+// TestMeterConcurrentCallbacks calls back into Monkey from several
+// goroutines with the context handed to a builtin. Run it with the race
+// detector: go test -race
+func TestMeterConcurrentCallbacks(t *testing.T) {
+	const goroutines, calls = 8, 100
+
+	spawn := &object.Builtin{
+		Name: "spawn",
+		FnContext: func(ctx context.Context, args ...object.Object) object.Object {
+			var wg sync.WaitGroup
+			for n := 0; n < goroutines; n++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < calls; i++ {
+						CallContext(ctx, args[0], []object.Object{object.NewInteger(int64(i))})
+					}
+				}()
+			}
+			wg.Wait()
+
+			return nil
+		},
+	}
+
+	m := NewMeter(context.Background(), Limits{})
+	env := object.NewEnvironment()
+	env.Set("spawn", spawn)
+
+	_, err := EvalContext(m.Context(), parse("spawn(fn(x) { x + 1 });"), env)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// each call evaluates the body block, its statement, the infix
+	// expression and both of its operands
+	if steps := m.steps.Load(); steps < goroutines*calls*5 {
+		t.Errorf("callbacks not charged to the meter. steps=%d", steps)
+	}
+	if depth := m.depth.Load(); depth != 0 {
+		t.Errorf("calls and returns don't match. depth=%d", depth)
+	}
+}
+
+func TestCallDepthAfterAbortedCall(t *testing.T) {
+	m := NewMeter(context.Background(), Limits{MaxAllocations: 1})
+
+	// allocating the function uses up the allocations, so that the
+	// frame of the call cannot be allocated
+	_, err := EvalContext(m.Context(), parse("fn() { 1 }();"), object.NewEnvironment())
+	if !errors.Is(err, ErrAllocationLimitExceeded) {
+		t.Fatalf("wrong error. expected=%v, got=%v", ErrAllocationLimitExceeded, err)
+	}
+	if depth := m.depth.Load(); depth != 0 {
+		t.Errorf("aborted call left the depth at %d", depth)
+	}
+}
@@ -0,0 +1,27 @@
+package evaluator
+
+import "github.com/cupsadarius/monkey_interpreter/object"
+
+// The functions below expose the semantics of the operators to other
+// execution engines, so that they produce exactly the same values and
+// errors as Eval does.
+
+// EvalInfix applies a binary operator to two evaluated operands.
+func EvalInfix(operator string, left object.Object, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
+
+// EvalPrefix applies a unary operator to an evaluated operand.
+func EvalPrefix(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+// EvalMember reads the member name of obj.
+func EvalMember(obj object.Object, name string) object.Object {
+	return evalMemberExpression(obj, name)
+}
+
+// IsTruthy reports whether obj counts as true in a condition.
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
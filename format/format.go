@@ -0,0 +1,345 @@
+// Package format prints Monkey programs as canonical source. Blocks are
+// indented by two spaces and kept on a single line when they hold at most
+// one expression or return statement and fit in 80 columns; operators are
+// surrounded by spaces and only the parentheses needed to keep the meaning
+// of an expression are written. Comments and single blank lines between
+// statements are kept; comments stay after the code they follow, breaking
+// expressions they end a line of. Formatting formatted source changes
+// nothing.
+package format
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+	"github.com/cupsadarius/monkey_interpreter/token"
+)
+
+const (
+	indentation = "  "
+	maxWidth    = 80
+)
+
+// Source formats the Monkey source src. It fails if src does not parse.
+func Source(src []byte) ([]byte, error) {
+	l := lexer.New(string(src))
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parse error: %s", strings.Join(p.Errors(), "; "))
+	}
+
+	pr := &printer{comments: l.Comments()}
+	pr.program(program)
+
+	return []byte(pr.out.String()), nil
+}
+
+// Node writes node, a program, statement or expression, formatted to w.
+// Nodes carry no comments, so none are written.
+func Node(w io.Writer, node ast.Node) error {
+	p := &printer{}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		p.program(node)
+	case ast.Statement:
+		p.statement(node, nil)
+	case ast.Expression:
+		p.expression(node)
+	default:
+		return fmt.Errorf("format: unsupported node %T", node)
+	}
+
+	_, err := io.WriteString(w, p.out.String())
+	return err
+}
+
+type printer struct {
+	out    strings.Builder
+	column int // of the next byte written
+	depth  int // of indentation
+
+	comments []token.Token
+	next     int // the first comment not written yet
+	lastLine int // source line the item written last ends on
+}
+
+func (p *printer) write(s string) {
+	p.out.WriteString(s)
+
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		p.column = len(s) - i - 1
+	} else {
+		p.column += len(s)
+	}
+}
+
+// newline starts an indented line, after an empty one if blank is set.
+func (p *printer) newline(blank bool) {
+	if blank {
+		p.out.WriteString("\n")
+	}
+	p.write("\n" + strings.Repeat(indentation, p.depth))
+}
+
+// fits tells whether s fits on the current line followed by extra bytes.
+func (p *printer) fits(s string, extra int) bool {
+	return !strings.Contains(s, "\n") && p.column+len(s)+extra <= maxWidth
+}
+
+// commentsBefore tells whether a comment not written yet starts before
+// line.
+func (p *printer) commentsBefore(line int) bool {
+	return p.next < len(p.comments) && p.comments[p.next].Line < line
+}
+
+// commentsBeforePos tells whether a comment not written yet starts before
+// pos.
+func (p *printer) commentsBeforePos(pos token.Position) bool {
+	return p.next < len(p.comments) && p.comments[p.next].Offset < pos.Offset
+}
+
+// breakAfterComments writes the comments not written yet that start before
+// pos at the end of the current line, breaking the line after each, so that
+// they stay with the code they follow. It tells whether it wrote any.
+func (p *printer) breakAfterComments(pos token.Position) bool {
+	if !p.commentsBeforePos(pos) {
+		return false
+	}
+
+	out := strings.TrimRight(p.out.String(), " ")
+	p.out.Reset()
+	p.out.WriteString(out)
+
+	for p.commentsBeforePos(pos) {
+		c := p.comments[p.next]
+		p.next++
+
+		p.write(" " + c.Literal)
+		p.lastLine = c.Line
+		p.write("\n" + strings.Repeat(indentation, p.depth+1))
+	}
+
+	return true
+}
+
+func (p *printer) program(program *ast.Program) {
+	p.statements(program.Statements, math.MaxInt)
+
+	if p.out.Len() > 0 {
+		p.out.WriteString("\n")
+	}
+}
+
+// statements writes list, each statement and comment on its own lines,
+// together with the comments that start before the source line end.
+func (p *printer) statements(list []ast.Statement, end int) {
+	first := true
+	item := func(line int) {
+		if p.out.Len() > 0 {
+			p.newline(!first && line > p.lastLine+1)
+		}
+		first = false
+	}
+	comment := func() {
+		c := p.comments[p.next]
+		p.next++
+
+		item(c.Line)
+		p.write(c.Literal)
+		p.lastLine = c.Line
+	}
+
+	for i, s := range list {
+		start := firstLine(s)
+		for p.commentsBefore(start) {
+			comment()
+		}
+
+		item(start)
+
+		var next ast.Statement
+		if i+1 < len(list) {
+			next = list[i+1]
+		}
+		p.statement(s, next)
+
+		stop := lastLine(s)
+		p.trailingComments(stop)
+		p.lastLine = stop
+	}
+
+	for p.commentsBefore(end) {
+		comment()
+	}
+}
+
+// trailingComments writes the comments left on the source lines up to and
+// including stop, the first of them at the end of the current line.
+func (p *printer) trailingComments(stop int) {
+	for trailing := true; p.commentsBefore(stop + 1); trailing = false {
+		c := p.comments[p.next]
+		p.next++
+
+		if trailing {
+			p.write(" " + c.Literal)
+		} else {
+			p.newline(false)
+			p.write(c.Literal)
+		}
+	}
+}
+
+// statement writes s followed by the semicolon it needs when next follows
+// it in the same block.
+func (p *printer) statement(s ast.Statement, next ast.Statement) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.write("let " + s.Name.Value + " = ")
+		p.expression(s.Value)
+		p.write(";")
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.expression(s.ReturnValue)
+		p.write(";")
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression)
+		if needsSemicolon(s, next) {
+			p.write(";")
+		}
+	case *ast.BlockStatement:
+		p.block(s)
+	}
+}
+
+// needsSemicolon tells whether the expression statement s needs to be
+// terminated. Statements ending in a block read better without, unless the
+// statement that follows would continue them as an operand.
+func needsSemicolon(s *ast.ExpressionStatement, next ast.Statement) bool {
+	if _, ok := s.Expression.(*ast.IfExpression); !ok {
+		return true
+	}
+
+	es, ok := next.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+
+	text, _ := flat(es.Expression)
+	return strings.HasPrefix(text, "(") || strings.HasPrefix(text, "-")
+}
+
+func (p *printer) expression(e ast.Expression) {
+	p.breakAfterComments(e.Pos())
+
+	if text, ok := flat(e); ok && p.fits(text, 1) && !p.commentsBeforePos(e.End()) {
+		p.write(text)
+		return
+	}
+
+	switch e := e.(type) {
+	case *ast.PrefixExpression:
+		p.write(e.Operator)
+		p.operand(e.Right, operandNeedsParens(e))
+	case *ast.InfixExpression:
+		prec := precedences[e.Operator]
+		p.operand(e.Left, needsParens(e.Left, prec))
+		if p.breakAfterComments(e.Token.Pos()) {
+			p.write(e.Operator + " ")
+		} else {
+			p.write(" " + e.Operator + " ")
+		}
+		p.operand(e.Right, needsParens(e.Right, prec+1))
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(e.Condition)
+		p.write(") ")
+		// the branches are broken alike
+		p.brokenBlock(e.Consequence)
+		if e.Alternative != nil {
+			p.write(" else ")
+			p.brokenBlock(e.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		p.write("fn(" + parameters(e.Parameters) + ") ")
+		p.block(e.Body)
+	case *ast.CallExpression:
+		p.operand(e.Function, needsParens(e.Function, call))
+		p.write("(")
+		for i, a := range e.Arguments {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(a)
+		}
+		p.breakAfterComments(e.Rparen.Pos())
+		p.write(")")
+	case *ast.MemberExpression:
+		p.operand(e.Object, needsParens(e.Object, call))
+		p.write("." + e.Property.Value)
+	default:
+		text, _ := flat(e)
+		p.write(text)
+	}
+}
+
+func (p *printer) operand(e ast.Expression, parens bool) {
+	if parens {
+		p.write("(")
+	}
+	p.expression(e)
+	if parens {
+		p.write(")")
+	}
+}
+
+// block writes b on a single line if it can, otherwise with a statement
+// per line.
+func (p *printer) block(b *ast.BlockStatement) {
+	if text, ok := flatBlock(b); ok && p.fits(text, 1) && !p.commentsBefore(closingLine(b)) {
+		p.write(text)
+		return
+	}
+
+	p.brokenBlock(b)
+}
+
+// brokenBlock writes b with a statement per line. A comment following the
+// opening brace on its line stays there.
+func (p *printer) brokenBlock(b *ast.BlockStatement) {
+	if len(b.Statements) == 0 && !p.commentsBefore(closingLine(b)) {
+		p.write("{}")
+		return
+	}
+
+	p.write("{")
+	if p.next < len(p.comments) && p.comments[p.next].Line == b.Token.Line && p.commentsBefore(closingLine(b)) &&
+		(len(b.Statements) == 0 || p.commentsBeforePos(b.Statements[0].Pos())) {
+		p.write(" " + p.comments[p.next].Literal)
+		p.next++
+		p.lastLine = b.Token.Line
+	}
+
+	p.depth++
+	p.statements(b.Statements, closingLine(b))
+	p.depth--
+	p.newline(false)
+	p.write("}")
+}
+
+// closingLine returns the source line of the brace closing b, which for
+// blocks left open is past their last statement.
+func closingLine(b *ast.BlockStatement) int {
+	if b.Rbrace.Line > 0 {
+		return b.Rbrace.Line
+	}
+
+	return lastLine(b) + 1
+}
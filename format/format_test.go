@@ -0,0 +1,186 @@
+package format
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/internal/enginetest"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"let x=5", "let x = 5;\n"},
+		{"let add = fn(a,b){a+b}; add(1,2)", "let add = fn(a, b) { a + b };\nadd(1, 2);\n"},
+		{"return  -x", "return -x;\n"},
+		{`"monkey" .length`, "\"monkey\".length;\n"},
+		// only the parentheses that matter are kept
+		{"(1 + 2) * 3; 1 + (2 * 3); (1 - 2) - 3; 1 - (2 - 3)", "(1 + 2) * 3;\n1 + 2 * 3;\n1 - 2 - 3;\n1 - (2 - 3);\n"},
+		{"-(a + b); -(-a); (-a).b; -(a.b); (a + b)(c); (fn(x) { x })(1)", "-(a + b);\n-(-a);\n(-a).b;\n-a.b;\n(a + b)(c);\nfn(x) { x }(1);\n"},
+		{"a == (b < c); (a == b) < c", "a == b < c;\n(a == b) < c;\n"},
+		// a minus is never followed by another
+		{"- -a; -(-a.b); -(-a)(b); !!a; -!a; !-a", "-(-a);\n-(-a.b);\n-(-a)(b);\n!!a;\n-!a;\n!-a;\n"},
+		// blocks of a single expression or return fit on a line, others
+		// are broken
+		{"if (x) { return 1; } else { 2; }", "if (x) { return 1; } else { 2 }\n"},
+		{"fn() {}", "fn() {};\n"},
+		{"fn() { let y = 1; y }", "fn() {\n  let y = 1;\n  y;\n};\n"},
+		{
+			"let f = fn(x) { if (x > 10) { x } else { f(x + 1) + f(x + 2) + f(x + 3) + f(x + 4) } };",
+			`let f = fn(x) {
+  if (x > 10) { x } else { f(x + 1) + f(x + 2) + f(x + 3) + f(x + 4) }
+};
+`,
+		},
+		{
+			"let f = fn(x) { if (x > 10) { x } else { f(x + 1) + f(x + 2) + f(x + 3) + f(x + 4) + f(x + 5) + f(x + 6) } };",
+			`let f = fn(x) {
+  if (x > 10) {
+    x;
+  } else {
+    f(x + 1) + f(x + 2) + f(x + 3) + f(x + 4) + f(x + 5) + f(x + 6);
+  }
+};
+`,
+		},
+		// if statements need no semicolon unless the next statement would
+		// continue them
+		{"if (a) { b }; c; if (a) { b }; -c", "if (a) { b }\nc;\nif (a) { b };\n-c;\n"},
+		// a single blank line between statements is kept
+		{"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;\n", "let a = 1;\n\nlet b = 2;\nlet c = 3;\n"},
+		{
+			`// header
+
+let add = fn(a, b) {   // adds
+	// the sum
+  a + b
+
+  // nothing else
+};
+let x = add(1, // one
+  2) // two
+// done
+`,
+			`// header
+
+let add = fn(a, b) { // adds
+  // the sum
+  a + b;
+
+  // nothing else
+};
+let x = add(1, // one
+  2); // two
+// done
+`,
+		},
+		// comments stay with the code they follow
+		{"fn(x) { x // trailing\n}", "fn(x) {\n  x; // trailing\n};\n"},
+		{"f(a, // c\n b)", "f(a, // c\n  b);\n"},
+		{"let y = a // c\n  + b * c;", "let y = a // c\n  + b * c;\n"},
+		{
+			"if (x) {\n  // todo\n} else { y }",
+			"if (x) {\n  // todo\n} else {\n  y;\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+
+		if string(got) != tt.expected {
+			t.Errorf("wrong output for %q.\nexpected=\n%s\ngot=\n%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSourceIsStable(t *testing.T) {
+	inputs := append([]string{
+		"let x = add(1, // one\n  fn() {\n    // two\n    2\n  });\n",
+		"// only a comment",
+		"fn(x) { x // trailing\n}",
+		"f(a, // c\n b)",
+		"let y = a // c\n  + b * c;",
+		"let f = fn() {\n\n  1\n\n};\n\n\n",
+	}, enginetest.Inputs...)
+
+	for _, input := range inputs {
+		once, err := Source([]byte(input))
+		if err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+
+		twice, err := Source(once)
+		if err != nil {
+			t.Fatalf("%q formatted does not parse: %s\n%s", input, err, once)
+		}
+
+		if !bytes.Equal(once, twice) {
+			t.Errorf("formatting %q again changed it.\nonce=\n%s\ntwice=\n%s", input, once, twice)
+		}
+	}
+}
+
+func TestSourceKeepsMeaning(t *testing.T) {
+	for _, input := range enginetest.Inputs {
+		formatted, err := Source([]byte(input))
+		if err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+
+		expected, got := parse(t, input), parse(t, string(formatted))
+		if expected != got {
+			t.Errorf("formatting %q changed its meaning.\nexpected=%s\ngot=%s", input, expected, got)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("%q does not parse: %v", input, p.Errors())
+	}
+
+	return program.String()
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source([]byte("let = 1;"))
+	if err == nil || !strings.HasPrefix(err.Error(), "parse error: ") {
+		t.Errorf("wrong error. expected a parse error, got=%v", err)
+	}
+}
+
+func TestNode(t *testing.T) {
+	p := parser.New(lexer.New("let f = fn(a) { let b = a * (a + 1); b }; // gone"))
+	program := p.ParseProgram()
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{program, "let f = fn(a) {\n  let b = a * (a + 1);\n  b;\n};\n"},
+		{program.Statements[0], "let f = fn(a) {\n  let b = a * (a + 1);\n  b;\n};"},
+		{program.Statements[0].(*ast.LetStatement).Value, "fn(a) {\n  let b = a * (a + 1);\n  b;\n}"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := Node(&out, tt.node); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("wrong output.\nexpected=\n%s\ngot=\n%s", tt.expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package format
+
+import (
+	"strings"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+)
+
+// precedences of the operators, as the parser binds them
+const (
+	_ int = iota
+	lowest
+	equals
+	lessGreater
+	sum
+	product
+	prefix
+	call
+	primary
+)
+
+var precedences = map[string]int{
+	"==": equals,
+	"!=": equals,
+	"<":  lessGreater,
+	">":  lessGreater,
+	"<=": lessGreater,
+	">=": lessGreater,
+	"+":  sum,
+	"-":  sum,
+	"*":  product,
+	"/":  product,
+}
+
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return precedences[e.Operator]
+	case *ast.PrefixExpression:
+		return prefix
+	case *ast.CallExpression, *ast.MemberExpression:
+		return call
+	}
+
+	return primary
+}
+
+// needsParens tells whether e has to be parenthesized where an expression
+// binding at least as tightly as min is parsed.
+func needsParens(e ast.Expression, min int) bool {
+	return precedence(e) < min
+}
+
+// operandNeedsParens tells whether the operand of the prefix expression e
+// has to be parenthesized: besides binding too loosely, a negated operand
+// starting with a minus would read as "--".
+func operandNeedsParens(e *ast.PrefixExpression) bool {
+	if needsParens(e.Right, prefix) {
+		return true
+	}
+
+	text, _ := flat(e.Right)
+	return e.Operator == "-" && strings.HasPrefix(text, "-")
+}
+
+// flat returns e written on a single line. It reports false if e holds a
+// block that should not be written on a single line.
+func flat(e ast.Expression) (string, bool) {
+	var out strings.Builder
+	ok := writeFlat(&out, e)
+
+	return out.String(), ok
+}
+
+func writeFlat(out *strings.Builder, e ast.Expression) bool {
+	ok := true
+	operand := func(e ast.Expression, parens bool) {
+		if parens {
+			out.WriteString("(")
+		}
+		ok = writeFlat(out, e) && ok
+		if parens {
+			out.WriteString(")")
+		}
+	}
+	block := func(b *ast.BlockStatement) {
+		text, flat := flatBlock(b)
+		out.WriteString(text)
+		ok = flat && ok
+	}
+
+	switch e := e.(type) {
+	case *ast.Identifier:
+		out.WriteString(e.Value)
+	case *ast.IntegerLiteral:
+		out.WriteString(e.Token.Literal)
+	case *ast.FloatLiteral:
+		out.WriteString(e.Token.Literal)
+	case *ast.BooleanLiteral:
+		out.WriteString(e.Token.Literal)
+	case *ast.StringLiteral:
+		out.WriteString(`"` + e.Value + `"`)
+	case *ast.PrefixExpression:
+		out.WriteString(e.Operator)
+		operand(e.Right, operandNeedsParens(e))
+	case *ast.InfixExpression:
+		prec := precedences[e.Operator]
+		operand(e.Left, needsParens(e.Left, prec))
+		out.WriteString(" " + e.Operator + " ")
+		operand(e.Right, needsParens(e.Right, prec+1))
+	case *ast.IfExpression:
+		out.WriteString("if (")
+		operand(e.Condition, false)
+		out.WriteString(") ")
+		block(e.Consequence)
+		if e.Alternative != nil {
+			out.WriteString(" else ")
+			block(e.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		out.WriteString("fn(" + parameters(e.Parameters) + ") ")
+		block(e.Body)
+	case *ast.CallExpression:
+		operand(e.Function, needsParens(e.Function, call))
+		out.WriteString("(")
+		for i, a := range e.Arguments {
+			if i > 0 {
+				out.WriteString(", ")
+			}
+			operand(a, false)
+		}
+		out.WriteString(")")
+	case *ast.MemberExpression:
+		operand(e.Object, needsParens(e.Object, call))
+		out.WriteString("." + e.Property.Value)
+	}
+
+	return ok
+}
+
+// flatBlock returns b written on a single line. It reports false unless b
+// holds at most a single expression or return statement.
+func flatBlock(b *ast.BlockStatement) (string, bool) {
+	switch len(b.Statements) {
+	case 0:
+		return "{}", true
+	case 1:
+	default:
+		return "{ ... }", false
+	}
+
+	switch s := b.Statements[0].(type) {
+	case *ast.ExpressionStatement:
+		text, ok := flat(s.Expression)
+		return "{ " + text + " }", ok
+	case *ast.ReturnStatement:
+		text, ok := flat(s.ReturnValue)
+		return "{ return " + text + "; }", ok
+	}
+
+	return "{ ... }", false
+}
+
+func parameters(params []*ast.Identifier) string {
+	names := make([]string, len(params))
+	for i, p := range params {
+		names[i] = p.Value
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// firstLine returns the source line s starts on.
+func firstLine(s ast.Statement) int {
+	return s.Pos().Line
+}
+
+// lastLine returns the last source line node spans.
+func lastLine(node ast.Node) int {
+	return node.End().Line
+}
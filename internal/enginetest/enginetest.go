@@ -0,0 +1,239 @@
+// Package enginetest checks that an execution engine produces the same
+// results as the tree-walking evaluator.
+package enginetest
+
+import (
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+	"github.com/cupsadarius/monkey_interpreter/resolver"
+)
+
+// Engine runs a parsed program in a fresh global environment and returns
+// its result.
+type Engine func(program *ast.Program) (object.Object, error)
+
+// Inputs are the programs of the evaluator test suite, plus a few that
+// exercise closures and recursion more heavily.
+var Inputs = []string{
+	// integers
+	"5", "10", "-5", "-10", "-(-5)",
+	"5 + 5 + 5 + 5 - 10",
+	"2 * 2 * 2 * 2 * 2",
+	"-50 + 100 -50",
+	"5 * 2 + 10",
+	"5 + 2 * 10",
+	"20 + 2 * -10",
+	"50 / 2 * 2 + 10",
+	"2 * (5 + 10)",
+	"3 * 3 * 3 + 10",
+	"3 * (3 * 3) + 10",
+	"(5 + 10 * 2 + 15 / 3) * 2 + -10",
+
+	// strings
+	`"hello world"`,
+	`"hello" + " " + "world";`,
+
+	// floats
+	"5.1", "10.01", "-5.1", "-10.01",
+	"5.0 + 5.0 + 5.0 + 5.0 - 10.0",
+	"2 * 2 * 2 * 2 * 2.5",
+	"5.0 * 2.5 + 10.0",
+	"5.5 + 2.0 * 10.0",
+	"20.0 + 2.0 * -10.0",
+	"50.0 / 2.0 * 2.0 + 10.0",
+	"2.0 * (5.0 + 10.0)",
+	"3.0 * 3.0 * 3.0 + 10.0",
+	"3.0 * (3.0 * 3.0) + 10.0",
+	"(5.0 + 10.0 * 2.0 + 15.0 / 3.0) * 2.0 + -10.0",
+
+	// booleans
+	"true", "false",
+	"1 < 2", "1 > 2", "1 < 1", "1 > 1",
+	"1 == 1", "1 != 1", "1 == 2", "1 != 2",
+	"true == true", "true == false", "false == false",
+	"true != false", "false != true",
+	"(1 < 2) == true", "(1 > 2) == true",
+	"(1 < 2) == false", "(1 > 2) == false",
+
+	// bang operator
+	"!true", "!false", "!5", "!!true", "!!false", "!!5",
+
+	// if else
+	"if (true) { 10 }",
+	"if (false) { 10 }",
+	"if (1) { 10 }",
+	"if (1 < 2) { 10.2 }",
+	"if (1 > 2) { 10 }",
+	"if (1 > 2) { 10 } else { 20 }",
+	"if (1 < 2) { 10 } else { 20 }",
+
+	// return statements
+	"return 10;",
+	"return 1.1;",
+	"return 10; 9;",
+	"return 2 * 5;",
+	"return 2 * 5.1;",
+	"9; return 2 * 5; 9;",
+	`
+      if (10 > 1) {
+        if (10 > 1) {
+          return 10;
+        }
+
+        return 1;
+      }
+    `,
+	// a return value kept by a let must not change with later returns
+	"let f = fn() { let a = if (true) { return 1; }; let b = fn() { return 2; }(); a }; f();",
+	// returns ending a function body, nested in calls ending one
+	"let f = fn(x) { if (x > 1) { return x; } return f(x + 1) * 10; }; let g = fn() { return f(0) + 1; }; g(); return g() + 1;",
+
+	// errors
+	"5 + true;",
+	"10 / (5 - 5);",
+	"5 + true; 5;",
+	"-true",
+	"true + false;",
+	"5; true + false; 5;",
+	"if (10 > 1) { true + false; }",
+	`
+      if (10 > 1) {
+        if (10 > 1) {
+          return true + false;
+        }
+
+        return 1;
+      }
+      `,
+	"foobar",
+	`"a" - "b";`,
+
+	// let statements
+	"let a = 5; a;",
+	"let a = 5 * 5; a;",
+	"let a = 5; let b = a; b;",
+	"let a = 5; let b = a; let c = a + b + 5; c;",
+	"let a = 5.1; a;",
+	"let a = 5 * 5.1; a;",
+	"let a = 5.1; let b = a; b;",
+	"let a = 5; let b = a; let c = a + b + 5.1; c;",
+
+	// functions
+	"fn(x) { x + 2; };",
+	"let identity = fn(x) { x; }; identity(5);",
+	"let identity = fn(x) { return x; }; identity(5);",
+	"let double = fn(x) {x * 2;}; double(5);",
+	"let add = fn(x, y) {x + y;}; add(5, 5);",
+	"let add = fn(x, y) {x + y;}; add(5 + 5, add(5, 5));",
+	"let identity = fn(x) { x; }; identity(5.1);",
+	"let identity = fn(x) { return x; }; identity(5.1);",
+	"fn() {}();",
+	"let f = fn() { let a = 1; }; f();",
+	"let double = fn(x) {x * 2;}; double(5.1);",
+	"let add = fn(x, y) {x + y;}; add(5.1, 5.1);",
+	"let add = fn(x, y) {x + y;}; add(5.1 + 5.1, add(5.1, 5.1));",
+
+	// closures
+	`
+    let newAdder = fn(x) {
+      fn(y) { x + y; };
+    };
+
+    let addTwo = newAdder(2);
+    addTwo(2);
+  `,
+
+	// beyond the evaluator suite
+	"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15);",
+	"let f = fn() { g(); }; let g = fn() { 42 }; f();",
+	`
+    let outer = fn(a) {
+      let middle = fn(b) {
+        let inner = fn(c) { a + b + c + later; };
+        let later = 1000;
+        inner(3);
+      };
+      middle(2);
+    };
+    outer(1);
+  `,
+	`
+    let counter = fn(n) {
+      let loop = fn(i, acc) { if (i > n) { acc } else { loop(i + 1, acc + i) } };
+      loop(1, 0);
+    };
+    counter(100);
+  `,
+	"let a = fn(x) { x }; a(1, 2);",
+	"let a = 1; a();",
+	"let f = fn() { x; }; f();",
+	"1 <= 2",
+	"if (if (false) { 1 }) { 1 } else { 2 }",
+	`"a" == "a"`,
+	"fn() { 1 } == fn() { 1 }",
+	"5 + fn() { 1 }",
+	`"monkey".length`,
+}
+
+// Run checks that engine agrees with evaluator.Eval on every input.
+func Run(t *testing.T, engine Engine) {
+	t.Helper()
+
+	for _, input := range Inputs {
+		expected := evaluator.Eval(parse(t, input), object.NewEnvironment())
+
+		got, err := engine(parse(t, input))
+		if err != nil {
+			t.Errorf("%q: engine error: %s", input, err)
+			continue
+		}
+
+		if !Equal(expected, got) {
+			t.Errorf("%q: results differ.\nEval:   %s\nengine: %s", input, describe(expected), describe(got))
+		}
+	}
+}
+
+// Equal reports whether two results are the same. Functions are compared by
+// type only, since every engine has its own representation of them.
+func Equal(expected, got object.Object) bool {
+	if expected == nil || got == nil {
+		return expected == got
+	}
+
+	if expected.Type() != got.Type() {
+		return false
+	}
+
+	if expected.Type() == object.FUNCTION_OBJ {
+		return true
+	}
+
+	return expected.Inspect() == got.Inspect()
+}
+
+func describe(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+
+	return string(obj.Type()) + " " + obj.Inspect()
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("%q: parser errors: %v", input, p.Errors())
+	}
+	resolver.Resolve(program, nil)
+
+	return program
+}
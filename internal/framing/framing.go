@@ -0,0 +1,60 @@
+// Package framing reads and writes the messages of the language server and
+// debug adapter protocols, which both send JSON bodies preceded by a
+// Content-Length header.
+package framing
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// maxLength bounds the bodies Read accepts, so that a bad header cannot make
+// it allocate without limit.
+const maxLength = 64 << 20
+
+// Read reads the body of the next message. It returns io.EOF when r ends
+// before a message starts; other errors are left for the protocol to wrap.
+func Read(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	if length > maxLength {
+		return nil, fmt.Errorf("Content-Length %d exceeds the limit of %d", length, maxLength)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("reading body: %w", err)
+	}
+
+	return body, nil
+}
+
+// Write writes v encoded as JSON, framed by a Content-Length header.
+func Write(w io.Writer, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+
+	return err
+}
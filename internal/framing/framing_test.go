@@ -0,0 +1,49 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadWrite(t *testing.T) {
+	var buf bytes.Buffer
+	for _, v := range []interface{}{map[string]int{"seq": 1}, "é"} {
+		if err := Write(&buf, v); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if expected := "Content-Length: 9\r\n\r\n{\"seq\":1}Content-Length: 4\r\n\r\n\"é\""; buf.String() != expected {
+		t.Fatalf("wrong framing. expected=%q, got=%q", expected, buf.String())
+	}
+
+	r := bufio.NewReader(&buf)
+	for _, expected := range []string{`{"seq":1}`, `"é"`} {
+		body, err := Read(r)
+		if err != nil || string(body) != expected {
+			t.Fatalf("wrong body. expected=%q, got=%q (%v)", expected, body, err)
+		}
+	}
+	if _, err := Read(r); err != io.EOF {
+		t.Errorf("wrong error at the end of the input. expected=EOF, got=%v", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Content-Length: x\r\n\r\n", `invalid Content-Length "x"`},
+		{"Content-Type: json\r\n\r\n{}", `invalid Content-Length ""`},
+		{"Content-Length: 10\r\n\r\n{}", "reading body: unexpected EOF"},
+		{"Content-Length: 67108865\r\n\r\n{}", "Content-Length 67108865 exceeds the limit of 67108864"},
+	}
+
+	for _, tt := range tests {
+		_, err := Read(bufio.NewReader(strings.NewReader(tt.input)))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
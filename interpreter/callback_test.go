@@ -0,0 +1,139 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+func TestCallObjectFromBuiltin(t *testing.T) {
+	i := New()
+
+	i.Set("sortBy", func(xs []int64, less object.Object) ([]int64, error) {
+		var callErr error
+
+		sort.SliceStable(xs, func(a, b int) bool {
+			result, err := i.CallObject(less, &object.Integer{Value: xs[a]}, &object.Integer{Value: xs[b]})
+			if err != nil {
+				callErr = err
+				return false
+			}
+			return result == object.TRUE
+		})
+
+		return xs, callErr
+	})
+
+	i.Set("numbers", []int{1, 3, 2})
+	got, err := i.Eval(`let offset = 10; sortBy(numbers, fn(a, b) { a + offset > b + offset; });`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []interface{}{int64(3), int64(2), int64(1)}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong value. expected=%#v, got=%#v", expected, got)
+	}
+
+	_, err = i.Eval(`sortBy(numbers, fn(a, b) { a + true; });`)
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected a *RuntimeError. got=%T (%v)", err, err)
+	}
+	if runtimeErr.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error message. got=%q", runtimeErr.Message)
+	}
+}
+
+func TestCallbacksChargeTheCaller(t *testing.T) {
+	tests := []struct {
+		limits   evaluator.Limits
+		input    string
+		expected error
+	}{
+		{evaluator.Limits{MaxSteps: 1000}, "each(10000, fn(k) { k * 2 });", evaluator.ErrStepLimitExceeded},
+		{evaluator.Limits{MaxAllocations: 1000}, "each(10000, fn(k) { k * 2 });", evaluator.ErrAllocationLimitExceeded},
+		{evaluator.Limits{MaxCallDepth: 50}, "let f = fn(n) { each(1, fn(k) { f(n + 1) }) }; f(0);", evaluator.ErrDepthLimitExceeded},
+	}
+
+	for _, engine := range []Engine{TreeWalker, Closures} {
+		for _, tt := range tests {
+			i := New(WithEngine(engine), WithLimits(tt.limits))
+			i.Set("each", func(ctx context.Context, n int, f object.Object) error {
+				for k := 0; k < n; k++ {
+					if _, err := i.CallObjectContext(ctx, f, &object.Integer{Value: int64(k)}); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+
+			_, err := i.Run(tt.input)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("engine %d, %q: wrong error. expected=%v, got=%v", engine, tt.input, tt.expected, err)
+			}
+		}
+	}
+}
+
+func TestCallObjectAfterRun(t *testing.T) {
+	i := New(WithLimits(evaluator.Limits{MaxSteps: 1000}))
+
+	var handlers []object.Object
+	i.Set("on", func(handler object.Object) {
+		handlers = append(handlers, handler)
+	})
+
+	_, err := i.Run(`
+    let prefix = "got ";
+    on(fn(event) { prefix + event; });
+    on(fn(event) { let loop = fn() { loop(); }; loop(); });
+    on("not a function");
+  `)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(handlers) != 3 {
+		t.Fatalf("wrong number of handlers. got=%d", len(handlers))
+	}
+
+	var wg sync.WaitGroup
+	results := make([]object.Object, 16)
+	errs := make([]error, 16)
+
+	for n := range results {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			results[n], errs[n] = i.CallObject(handlers[0], &object.String{Value: "click"})
+		}(n)
+	}
+	wg.Wait()
+
+	for n := range results {
+		if errs[n] != nil {
+			t.Fatalf("unexpected error: %s", errs[n])
+		}
+		if results[n].Inspect() != "got click" {
+			t.Errorf("wrong result. got=%q", results[n].Inspect())
+		}
+	}
+
+	_, err = i.CallObject(handlers[1], &object.String{Value: "click"})
+	if !errors.Is(err, evaluator.ErrStepLimitExceeded) {
+		t.Errorf("expected ErrStepLimitExceeded. got=%v", err)
+	}
+
+	_, err = i.CallObject(handlers[2])
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Message != "not a function: STRING" {
+		t.Errorf("expected a not a function error. got=%v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package interpreter
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+)
+
+// These tests are meant to be run with the race detector: go test -race
+
+const workers = 32
+
+// globalName returns a distinct identifier for every worker; identifiers
+// can't contain digits.
+func globalName(n int) string {
+	return "global" + string(rune('a'+n/26)) + string(rune('a'+n%26))
+}
+
+func TestConcurrentSharedClosures(t *testing.T) {
+	i := New()
+
+	_, err := i.Run(`
+    let newAdder = fn(x) { fn(y) { let sum = x + y; sum; }; };
+    let addTwo = newAdder(2);
+    let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+  `)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	addTwo, _ := i.Environment().Get("addTwo")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*3)
+
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+
+			result, err := i.CallObject(addTwo, &object.Integer{Value: int64(n)})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if result.Inspect() != fmt.Sprintf("%d", n+2) {
+				errs <- fmt.Errorf("addTwo(%d) = %s", n, result.Inspect())
+			}
+
+			value, err := i.Eval(fmt.Sprintf("fib(10) + addTwo(%d)", n))
+			if err != nil {
+				errs <- err
+				return
+			}
+			if value != int64(55+n+2) {
+				errs <- fmt.Errorf("fib(10) + addTwo(%d) = %v", n, value)
+			}
+
+			// defining globals while others read them
+			name := globalName(n)
+			if _, err := i.Run(fmt.Sprintf("let %s = addTwo(%d);", name, n)); err != nil {
+				errs <- err
+			}
+		}(n)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for n := 0; n < workers; n++ {
+		if value, ok := i.Get(globalName(n)); !ok || value != int64(n+2) {
+			t.Errorf("%s = %v", globalName(n), value)
+		}
+	}
+}
+
+func TestConcurrentProgramExecution(t *testing.T) {
+	program, err := Compile(`
+    let double = fn(x) { x * 2 };
+    let result = double(input);
+    result;
+  `)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	shared := New()
+	shared.Set("offset", 1)
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, workers)
+	errs := make([]error, workers)
+
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+
+			i := shared.Clone()
+			i.Set("input", n)
+
+			result, err := i.Exec(program)
+			if err != nil {
+				errs[n] = err
+				return
+			}
+			results[n] = object.ToGo(result)
+		}(n)
+	}
+
+	wg.Wait()
+
+	for n := 0; n < workers; n++ {
+		if errs[n] != nil {
+			t.Fatalf("unexpected error: %s", errs[n])
+		}
+		if results[n] != int64(n*2) {
+			t.Errorf("worker %d: wrong result %v", n, results[n])
+		}
+	}
+
+	if _, ok := shared.Get("result"); ok {
+		t.Errorf("globals defined by clones leaked into the shared interpreter")
+	}
+}
+
+func TestConcurrentParsing(t *testing.T) {
+	var wg sync.WaitGroup
+
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			p := parser.New(lexer.New("let add = fn(x, y) { x + y; }; add(1, 2 * 3);"))
+			p.ParseProgram()
+			if len(p.Errors()) != 0 {
+				t.Errorf("parser errors: %v", p.Errors())
+			}
+		}()
+	}
+
+	wg.Wait()
+}
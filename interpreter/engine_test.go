@@ -0,0 +1,103 @@
+package interpreter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/closure"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+func TestEngines(t *testing.T) {
+	engines := []struct {
+		name   string
+		engine Engine
+	}{
+		{"TreeWalker", TreeWalker},
+		{"Closures", Closures},
+	}
+
+	for _, e := range engines {
+		i := New(WithEngine(e.engine), WithLimits(evaluator.Limits{MaxSteps: 10000}))
+
+		i.Set("twice", func(fn object.Object, x int64) (object.Object, error) {
+			once, err := i.CallObject(fn, &object.Integer{Value: x})
+			if err != nil {
+				return nil, err
+			}
+			return i.CallObject(fn, once)
+		})
+
+		got, err := i.Eval("let inc = fn(x) { x + 1 }; twice(inc, 40);")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", e.name, err)
+		}
+		if got != int64(42) {
+			t.Errorf("%s: wrong value. expected=42, got=%#v", e.name, got)
+		}
+
+		got, err = i.Call("inc", 1)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", e.name, err)
+		}
+		if got != int64(2) {
+			t.Errorf("%s: wrong value. expected=2, got=%#v", e.name, got)
+		}
+
+		_, err = i.Run("5 + true")
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) || runtimeErr.Message != "type mismatch: INTEGER + BOOLEAN" {
+			t.Errorf("%s: wrong error. got=%v", e.name, err)
+		}
+
+		_, err = i.Run("let loop = fn() { loop() }; loop();")
+		if !errors.Is(err, evaluator.ErrStepLimitExceeded) {
+			t.Errorf("%s: expected ErrStepLimitExceeded. got=%v", e.name, err)
+		}
+	}
+}
+
+func TestClosuresEngineCreatesCompiledFunctions(t *testing.T) {
+	i := New(WithEngine(Closures))
+
+	if _, err := i.Run("let f = fn() { 1 };"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	fn, _ := i.Environment().Get("f")
+	if _, ok := fn.(*closure.Function); !ok {
+		t.Errorf("wrong function type. got=%T", fn)
+	}
+}
+
+type callCounter struct {
+	calls int
+}
+
+func (c *callCounter) OnNodeEnter(ast.Node, evaluator.Scope) {}
+func (c *callCounter) OnNodeExit(ast.Node, object.Object)    {}
+func (c *callCounter) OnCall(object.Object, []object.Object) { c.calls++ }
+func (c *callCounter) OnReturn(object.Object, object.Object) {}
+
+func TestHookUsesTreeWalker(t *testing.T) {
+	hook := &callCounter{}
+	i := New(WithEngine(Closures), WithHook(hook))
+
+	got, err := i.Eval("let inc = fn(x) { x + 1 }; inc(inc(1));")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got != int64(3) {
+		t.Errorf("wrong value. expected=3, got=%#v", got)
+	}
+
+	if _, err := i.Call("inc", 1); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if hook.calls != 3 {
+		t.Errorf("wrong number of calls. expected=3, got=%d", hook.calls)
+	}
+}
@@ -0,0 +1,357 @@
+package interpreter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/closure"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+	"github.com/cupsadarius/monkey_interpreter/resolver"
+)
+
+// ParseError is returned when the source handed to the interpreter does not
+// parse.
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return "parse error: " + strings.Join(e.Errors, "; ")
+}
+
+// ResolveError is returned when a program refers to globals that are
+// defined neither by the program nor in the global environment.
+type ResolveError struct {
+	Errors []string
+}
+
+func (e *ResolveError) Error() string {
+	return "resolve error: " + strings.Join(e.Errors, "; ")
+}
+
+// RuntimeError is returned when a script evaluates to a Monkey error.
+type RuntimeError struct {
+	Message string
+
+	object *object.Error
+}
+
+func (e *RuntimeError) Error() string {
+	return "runtime error: " + e.Message
+}
+
+// Unwrap returns the Monkey error, so that a builtin returning the error of
+// a call back into Monkey raises that same error.
+func (e *RuntimeError) Unwrap() error {
+	if e.object == nil {
+		return nil
+	}
+
+	return e.object
+}
+
+// Interpreter evaluates Monkey source in a persistent global environment and
+// converts values between Go and Monkey. All of its methods are safe for
+// concurrent use.
+type Interpreter struct {
+	ctx    context.Context
+	limits evaluator.Limits
+	env    *object.Environment
+	engine Engine
+	hook   evaluator.Hook
+}
+
+// Engine selects how programs are executed. All engines produce the same
+// results; they only differ in speed.
+type Engine int
+
+const (
+	// TreeWalker evaluates the syntax tree directly.
+	TreeWalker Engine = iota
+	// Closures compiles every program once into Go closures before it
+	// runs.
+	Closures
+)
+
+type Option func(*Interpreter)
+
+// WithEngine selects the engine that executes programs.
+func WithEngine(engine Engine) Option {
+	return func(i *Interpreter) {
+		i.engine = engine
+	}
+}
+
+// WithContext sets the context every evaluation runs under.
+func WithContext(ctx context.Context) Option {
+	return func(i *Interpreter) {
+		i.ctx = ctx
+	}
+}
+
+// WithLimits sets the limits applied to each call of Run, Eval and Call.
+func WithLimits(limits evaluator.Limits) Option {
+	return func(i *Interpreter) {
+		i.limits = limits
+	}
+}
+
+// WithHook installs hook in every evaluation. Only the TreeWalker engine
+// reports to hooks, so programs are evaluated by it whenever a hook is
+// installed.
+func WithHook(hook evaluator.Hook) Option {
+	return func(i *Interpreter) {
+		i.hook = hook
+	}
+}
+
+// WithEnvironment makes the interpreter use env as its global environment.
+func WithEnvironment(env *object.Environment) Option {
+	return func(i *Interpreter) {
+		i.env = env
+	}
+}
+
+func New(opts ...Option) *Interpreter {
+	i := &Interpreter{ctx: context.Background(), env: object.NewEnvironment()}
+
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	return i
+}
+
+// Environment returns the global environment of the interpreter.
+func (i *Interpreter) Environment() *object.Environment {
+	return i.env
+}
+
+// Program is parsed and resolved Monkey source. It is never modified by
+// evaluation, so a single Program can be executed by any number of
+// interpreters at once.
+type Program struct {
+	program *ast.Program
+	globals []string // globals the program uses without defining them
+
+	compileOnce sync.Once
+	compiled    *closure.Program
+}
+
+// AST returns the resolved syntax tree of the program, which must not be
+// modified.
+func (p *Program) AST() *ast.Program {
+	return p.program
+}
+
+// closures returns the program compiled for the Closures engine, compiling
+// it the first time it is needed.
+func (p *Program) closures() *closure.Program {
+	p.compileOnce.Do(func() {
+		p.compiled = closure.Compile(p.program)
+	})
+
+	return p.compiled
+}
+
+// Compile parses source into a Program.
+func Compile(source string) (*Program, error) {
+	l := lexer.New(source)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+
+	compiled := &Program{program: program}
+	resolver.Resolve(program, func(name string) bool {
+		compiled.globals = append(compiled.globals, name)
+		return true
+	})
+
+	return compiled, nil
+}
+
+// Clone returns an interpreter with the same options whose global environment
+// is layered on top of the one of i: the clone sees every global of i, while
+// globals it defines itself stay private to it. Clones are the cheap way to
+// give each goroutine its own copy-on-write view of shared globals.
+func (i *Interpreter) Clone() *Interpreter {
+	clone := *i
+	clone.env = object.NewEnclosedEnvironment(i.env)
+
+	return &clone
+}
+
+// Run parses and evaluates source in the global environment and returns the
+// value of the last statement.
+func (i *Interpreter) Run(source string) (object.Object, error) {
+	program, err := Compile(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.Exec(program)
+}
+
+// Exec evaluates a compiled program in the global environment and returns
+// the value of the last statement. Programs using globals that are not
+// defined fail with a ResolveError before anything is evaluated.
+func (i *Interpreter) Exec(program *Program) (object.Object, error) {
+	var errors []string
+	for _, name := range program.globals {
+		if _, ok := i.env.Get(name); !ok {
+			errors = append(errors, "identifier not found: "+name)
+		}
+	}
+	if len(errors) != 0 {
+		return nil, &ResolveError{Errors: errors}
+	}
+
+	var result object.Object
+	var err error
+
+	switch {
+	case i.engine == Closures && i.hook == nil:
+		result, err = program.closures().RunContext(i.ctx, i.env, i.limits)
+	default:
+		result, err = evaluator.EvalContext(i.ctx, program.program, i.env, i.evalOptions()...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := runtimeError(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Eval evaluates expr like Run does and converts the result into a Go value.
+func (i *Interpreter) Eval(expr string) (interface{}, error) {
+	result, err := i.Run(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.ToGo(result), nil
+}
+
+// Set binds the Go value to name in the global environment.
+func (i *Interpreter) Set(name string, value interface{}) error {
+	obj, err := object.FromGo(value)
+	if err != nil {
+		return fmt.Errorf("set %s: %w", name, err)
+	}
+
+	if builtin, ok := obj.(*object.Builtin); ok && builtin.Name == "" {
+		if _, isObject := value.(object.Object); !isObject {
+			builtin.Name = name
+		}
+	}
+
+	i.env.Set(name, obj)
+
+	return nil
+}
+
+// Get looks name up in the global environment and converts its value into a
+// Go value.
+func (i *Interpreter) Get(name string) (interface{}, bool) {
+	obj, ok := i.env.Get(name)
+	if !ok {
+		return nil, false
+	}
+
+	return object.ToGo(obj), true
+}
+
+// Call calls the function bound to fnName with args converted to objects and
+// converts its result back into a Go value.
+func (i *Interpreter) Call(fnName string, args ...interface{}) (interface{}, error) {
+	fn, ok := i.env.Get(fnName)
+	if !ok {
+		return nil, fmt.Errorf("call %s: identifier not found", fnName)
+	}
+
+	objects := make([]object.Object, len(args))
+	for idx, arg := range args {
+		obj, err := object.FromGo(arg)
+		if err != nil {
+			return nil, fmt.Errorf("call %s: argument %d: %w", fnName, idx+1, err)
+		}
+		objects[idx] = obj
+	}
+
+	result, err := i.CallObject(fn, objects...)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.ToGo(result), nil
+}
+
+// CallObject calls fn, a Monkey function or builtin, with args under the
+// context of the interpreter. Every call is evaluated on its own, under the
+// limits of the interpreter, so Go code may call back into Monkey from
+// other goroutines or long after the Run that produced fn has returned.
+// Builtins calling back while they run use CallObjectContext instead.
+func (i *Interpreter) CallObject(fn object.Object, args ...object.Object) (object.Object, error) {
+	return i.CallObjectContext(i.ctx, fn, args...)
+}
+
+// CallObjectContext calls fn like CallObject, under ctx. Builtins taking a
+// context.Context as their first parameter are handed the one of the
+// evaluation calling them: calls made with it are charged to that
+// evaluation, so that a script cannot escape the limits of the interpreter
+// through a callback.
+func (i *Interpreter) CallObjectContext(ctx context.Context, fn object.Object, args ...object.Object) (object.Object, error) {
+	if fn == nil {
+		return nil, &RuntimeError{Message: "not a function: nil"}
+	}
+
+	var result object.Object
+	var err error
+
+	// functions are called by the engine that created them
+	switch fn.(type) {
+	case *closure.Function:
+		result, err = closure.CallContext(ctx, fn, args, i.limits)
+	default:
+		result, err = evaluator.CallContext(ctx, fn, args, i.evalOptions()...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := runtimeError(result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (i *Interpreter) evalOptions() []evaluator.Option {
+	opts := []evaluator.Option{evaluator.WithLimits(i.limits)}
+	if i.hook != nil {
+		opts = append(opts, evaluator.WithHook(i.hook))
+	}
+
+	return opts
+}
+
+func runtimeError(result object.Object) error {
+	if errObj, ok := result.(*object.Error); ok {
+		return &RuntimeError{Message: errObj.Message, object: errObj}
+	}
+
+	return nil
+}
@@ -0,0 +1,317 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+func TestRun(t *testing.T) {
+	i := New()
+
+	result, err := i.Run("let add = fn(x, y) { x + y; }; add(1, 2);")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	integer, ok := result.(*object.Integer)
+	if !ok || integer.Value != 3 {
+		t.Fatalf("wrong result. got=%T (%+v)", result, result)
+	}
+
+	// the global environment persists between runs
+	value, err := i.Eval("add(2, 3)")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if value != int64(5) {
+		t.Fatalf("wrong result. got=%T (%+v)", value, value)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	i := New(WithLimits(evaluator.Limits{MaxSteps: 1000}))
+
+	_, err := i.Run("let x = ;")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Errorf("expected a *ParseError. got=%T (%v)", err, err)
+	}
+
+	result, err := i.Run("5 + true")
+	if result != nil {
+		t.Errorf("expected no result with an error. got=%T (%+v)", result, result)
+	}
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected a *RuntimeError. got=%T (%v)", err, err)
+	}
+	if runtimeErr.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error message. got=%q", runtimeErr.Message)
+	}
+
+	_, err = i.Run("let loop = fn() { loop(); }; loop();")
+	if !errors.Is(err, evaluator.ErrStepLimitExceeded) {
+		t.Errorf("expected ErrStepLimitExceeded. got=%v", err)
+	}
+
+	_, err = i.Run("let f = fn() { missing }; 5;")
+	var resolveErr *ResolveError
+	if !errors.As(err, &resolveErr) {
+		t.Fatalf("expected a *ResolveError. got=%T (%v)", err, err)
+	}
+	if len(resolveErr.Errors) != 1 || resolveErr.Errors[0] != "identifier not found: missing" {
+		t.Errorf("wrong errors. got=%q", resolveErr.Errors)
+	}
+
+	if err := i.Set("missing", 1); err != nil {
+		t.Fatalf("set failed: %s", err)
+	}
+	if _, err := i.Run("let f = fn() { missing }; f();"); err != nil {
+		t.Errorf("unexpected error once defined: %s", err)
+	}
+}
+
+func TestSetAndGet(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected interface{}
+	}{
+		{5, int64(5)},
+		{int32(-7), int64(-7)},
+		{uint8(7), int64(7)},
+		{2.5, 2.5},
+		{"monkey", "monkey"},
+		{true, true},
+		{nil, nil},
+		{[]int{1, 2, 3}, []interface{}{int64(1), int64(2), int64(3)}},
+		{map[string]int{"a": 1}, map[interface{}]interface{}{"a": int64(1)}},
+	}
+
+	for _, tt := range tests {
+		i := New()
+
+		if err := i.Set("value", tt.value); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		got, ok := i.Get("value")
+		if !ok {
+			t.Fatalf("value not found")
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("wrong value. expected=%#v, got=%#v", tt.expected, got)
+		}
+	}
+
+	if _, ok := New().Get("missing"); ok {
+		t.Errorf("expected missing to be unset")
+	}
+
+	if err := New().Set("channel", make(chan int)); err == nil {
+		t.Errorf("expected an error when setting a channel")
+	}
+	if err := New().Set("big", uint64(math.MaxUint64)); err == nil {
+		t.Errorf("expected an error when setting a uint64 above MaxInt64")
+	}
+}
+
+func TestGoFunctions(t *testing.T) {
+	i := New()
+
+	i.Set("greet", func(name string, times int) string {
+		return strings.Repeat("hello "+name+" ", times)
+	})
+	i.Set("sum", func(xs ...float64) float64 {
+		total := 0.0
+		for _, x := range xs {
+			total += x
+		}
+		return total
+	})
+	i.Set("divide", func(a, b int) (int, error) {
+		if b == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return a / b, nil
+	})
+	i.Set("raw", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: int64(len(args))}
+	})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`greet("monkey", 2)`, "hello monkey hello monkey "},
+		{`sum(1, 2.5, 3)`, 6.5},
+		{`sum()`, 0.0},
+		{`divide(10, 2)`, int64(5)},
+		{`raw(1, true, "x")`, int64(3)},
+	}
+
+	for _, tt := range tests {
+		got, err := i.Eval(tt.input)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tt.input, err)
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: wrong value. expected=%#v, got=%#v", tt.input, tt.expected, got)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`divide(1, 0)`, "division by zero"},
+		{`greet("monkey")`, "wrong number of arguments. got=1, want=2"},
+		{`greet(1, 2)`, "argument 1: cannot use INTEGER as string"},
+	}
+
+	for _, tt := range errorTests {
+		_, err := i.Eval(tt.input)
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) {
+			t.Fatalf("%s: expected a *RuntimeError. got=%T (%v)", tt.input, err, err)
+		}
+		if runtimeErr.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, runtimeErr.Message)
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	i := New()
+
+	if _, err := i.Run(`let join = fn(a, b) { a + " " + b; };`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := i.Call("join", "hello", "world")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got != "hello world" {
+		t.Errorf("wrong value. got=%#v", got)
+	}
+
+	if _, err := i.Call("join", "hello"); err == nil {
+		t.Errorf("expected an error for a missing argument")
+	}
+
+	if _, err := i.Call("missing"); err == nil {
+		t.Errorf("expected an error for an unknown function")
+	}
+}
+
+type account struct {
+	Owner   string
+	Balance float64
+	secret  string
+}
+
+func (a *account) Deposit(amount float64) float64 {
+	a.Balance += amount
+	return a.Balance
+}
+
+func (a *account) Withdraw(amount float64) (float64, error) {
+	if amount > a.Balance {
+		return a.Balance, fmt.Errorf("insufficient funds: %.2f", a.Balance)
+	}
+	a.Balance -= amount
+	return a.Balance, nil
+}
+
+func (a account) Greeting(prefix string) string {
+	return prefix + " " + a.Owner
+}
+
+type inner struct {
+	X int
+}
+
+type outer struct {
+	*inner
+	Y int
+}
+
+func TestGoValues(t *testing.T) {
+	acc := &account{Owner: "monkey", Balance: 10, secret: "banana"}
+
+	i := New()
+	i.Set("account", acc)
+	i.Set("open", func(owner string) *account {
+		return &account{Owner: owner}
+	})
+	i.Set("embedding", outer{inner: &inner{X: 1}, Y: 2})
+	i.Set("embeddingNil", outer{Y: 2})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`account.Owner`, "monkey"},
+		{`account.Deposit(5)`, 15.0},
+		{`account.Balance`, 15.0},
+		{`account.Greeting("hello")`, "hello monkey"},
+		{`let greet = account.Greeting; greet("hi")`, "hi monkey"},
+		{`open("gorilla").Deposit(2.5)`, 2.5},
+		{`account.Withdraw(5)`, 10.0},
+		{`embedding.X + embedding.Y`, int64(3)},
+		{`embeddingNil.Y`, int64(2)},
+	}
+
+	for _, tt := range tests {
+		got, err := i.Eval(tt.input)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tt.input, err)
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: wrong value. expected=%#v, got=%#v", tt.input, tt.expected, got)
+		}
+	}
+
+	if acc.Balance != 10 {
+		t.Errorf("methods did not act on the Go value. got=%f", acc.Balance)
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`account.Withdraw(100)`, "insufficient funds: 10.00"},
+		{`account.secret`, "unknown member secret on *interpreter.account"},
+		{`account.Missing()`, "unknown member Missing on *interpreter.account"},
+		{`"monkey".Owner`, "member access not supported: STRING.Owner"},
+		{`embeddingNil.X`, "member X of interpreter.outer is in a nil embedded struct"},
+	}
+
+	for _, tt := range errorTests {
+		_, err := i.Eval(tt.input)
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) {
+			t.Fatalf("%s: expected a *RuntimeError. got=%T (%v)", tt.input, err, err)
+		}
+		if runtimeErr.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, tt.expected, runtimeErr.Message)
+		}
+	}
+
+	got, ok := i.Get("account")
+	if !ok || got != acc {
+		t.Errorf("account did not round trip. got=%#v", got)
+	}
+
+	i.Set("balance", func(a *account) float64 { return a.Balance })
+	if got, err := i.Eval("balance(account)"); err != nil || got != 10.0 {
+		t.Errorf("go value was not passed back to Go. got=%#v, err=%v", got, err)
+	}
+}
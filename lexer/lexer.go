@@ -1,6 +1,8 @@
 package lexer
 
 import (
+	"strings"
+
 	"github.com/cupsadarius/monkey_interpreter/token"
 )
 
@@ -11,6 +13,8 @@ type Lexer struct {
 	ch            byte // current char under examination
 	currentLine   int  // current line in input
 	currentColumn int  // current postion on the line
+
+	comments []token.Token
 }
 
 func newToken(tokenType token.TokenType, ch byte, line, col int) token.Token {
@@ -82,6 +86,44 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// skipComments skips whitespace and the comments running from // to the
+// end of the line, keeping the comments aside.
+func (l *Lexer) skipComments() {
+	l.skipWhitespace()
+
+	for l.ch == '/' && l.peakAhead() == '/' {
+		line, column, position := l.currentLine, l.currentColumn, l.position
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+
+		literal := strings.TrimRight(l.input[position:l.position], " \t\r")
+		l.comments = append(l.comments, token.Token{Type: token.COMMENT, Literal: literal, Line: line, Column: column, Offset: position})
+
+		l.skipWhitespace()
+	}
+}
+
+// Comments returns the comments read so far, in the order they appear in
+// the input.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
+// Tokens returns the tokens left in the input, up to and including EOF.
+func (l *Lexer) Tokens() []token.Token {
+	var tokens []token.Token
+
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+
+		if tok.Type == token.EOF {
+			return tokens
+		}
+	}
+}
+
 func (l *Lexer) peakAhead() byte {
 	if l.readPosition >= len(l.input) {
 		return 0
@@ -109,10 +151,14 @@ func (l *Lexer) readString() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+func (l *Lexer) NextToken() (tok token.Token) {
+	l.skipComments()
 
-	l.skipWhitespace()
+	// every token is positioned at its first character
+	line, column, offset := l.currentLine, l.currentColumn, l.position
+	defer func() {
+		tok.Line, tok.Column, tok.Offset = line, column, offset
+	}()
 
 	switch l.ch {
 	case '(':
@@ -129,11 +175,8 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.SEMICOLON, l.ch, l.currentLine, l.currentColumn)
 	case '.':
 		if l.isPartOfNumber(l.ch) {
-			tok = token.Token{}
 			tok.Literal = l.readNumber()
 			tok.Type = token.LookupNumericIdentifier(tok.Literal)
-			tok.Line = l.currentLine
-			tok.Column = l.currentColumn - 1
 
 			return tok
 		} else {
@@ -146,7 +189,7 @@ func (l *Lexer) NextToken() token.Token {
 			ch := l.ch
 			l.readChar()
 			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.EQ, Literal: literal, Line: l.currentLine, Column: l.currentColumn}
+			tok = token.Token{Type: token.EQ, Literal: literal}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch, l.currentLine, l.currentColumn)
 		}
@@ -157,7 +200,7 @@ func (l *Lexer) NextToken() token.Token {
 			ch := l.ch
 			l.readChar()
 			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.NOT_EQ, Literal: literal, Line: l.currentLine, Column: l.currentColumn}
+			tok = token.Token{Type: token.NOT_EQ, Literal: literal}
 		} else {
 			tok = newToken(token.BANG, l.ch, l.currentLine, l.currentColumn)
 		}
@@ -170,7 +213,7 @@ func (l *Lexer) NextToken() token.Token {
 			ch := l.ch
 			l.readChar()
 			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.LT_EQ, Literal: literal, Line: l.currentLine, Column: l.currentColumn}
+			tok = token.Token{Type: token.LT_EQ, Literal: literal}
 		} else {
 			tok = newToken(token.LT, l.ch, l.currentLine, l.currentColumn)
 		}
@@ -179,31 +222,25 @@ func (l *Lexer) NextToken() token.Token {
 			ch := l.ch
 			l.readChar()
 			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.GT_EQ, Literal: literal, Line: l.currentLine, Column: l.currentColumn}
+			tok = token.Token{Type: token.GT_EQ, Literal: literal}
 		} else {
 			tok = newToken(token.GT, l.ch, l.currentLine, l.currentColumn)
 		}
 	case '"':
 		str := l.readString()
-		tok = token.Token{Type: token.STRING, Literal: str, Line: l.currentLine, Column: l.currentColumn - len(str) + 1}
+		tok = token.Token{Type: token.STRING, Literal: str}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
-		tok.Line = l.currentLine
-		tok.Column = l.currentColumn
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdentifier(tok.Literal)
-			tok.Line = l.currentLine
-			tok.Column = l.currentColumn - 1
 
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Literal = l.readNumber()
 			tok.Type = token.LookupNumericIdentifier(tok.Literal)
-			tok.Line = l.currentLine
-			tok.Column = l.currentColumn - 1
 
 			return tok
 		} else {
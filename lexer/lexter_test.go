@@ -1,6 +1,8 @@
 package lexer
 
 import (
+	"encoding/json"
+	"reflect"
 	"testing"
 
 	"github.com/cupsadarius/monkey_interpreter/token"
@@ -63,11 +65,11 @@ func TestFloats(t *testing.T) {
 		expectedLine    int
 		expectedColumn  int
 	}{
-		{token.FLOAT, ".023", 1, 4},
+		{token.FLOAT, ".023", 1, 1},
 		{token.SEMICOLON, ";", 1, 5},
-		{token.FLOAT, "1.23", 1, 10},
+		{token.FLOAT, "1.23", 1, 7},
 		{token.SEMICOLON, ";", 1, 11},
-		{token.FLOAT, "1.", 1, 14},
+		{token.FLOAT, "1.", 1, 13},
 		{token.SEMICOLON, ";", 1, 15},
 		{token.EOF, "", 1, 16},
 	}
@@ -110,41 +112,41 @@ func TestSimpleSyntax(t *testing.T) {
 		expectedLine    int
 		expectedColumn  int
 	}{
-		{token.LET, "let", 2, 5},
-		{token.IDENT, "five", 2, 10},
+		{token.LET, "let", 2, 3},
+		{token.IDENT, "five", 2, 7},
 		{token.ASSIGN, "=", 2, 12},
 		{token.INT, "5", 2, 14},
 		{token.SEMICOLON, ";", 2, 15},
-		{token.LET, "let", 3, 5},
-		{token.IDENT, "ten", 3, 9},
+		{token.LET, "let", 3, 3},
+		{token.IDENT, "ten", 3, 7},
 		{token.ASSIGN, "=", 3, 11},
-		{token.INT, "10", 3, 14},
+		{token.INT, "10", 3, 13},
 		{token.SEMICOLON, ";", 3, 15},
-		{token.LET, "let", 5, 5},
-		{token.IDENT, "add", 5, 9},
+		{token.LET, "let", 5, 3},
+		{token.IDENT, "add", 5, 7},
 		{token.ASSIGN, "=", 5, 11},
-		{token.FUNCTION, "fn", 5, 14},
+		{token.FUNCTION, "fn", 5, 13},
 		{token.LPAREN, "(", 5, 15},
 		{token.IDENT, "x", 5, 16},
 		{token.COMMA, ",", 5, 17},
 		{token.IDENT, "y", 5, 19},
 		{token.RPAREN, ")", 5, 20},
 		{token.LBRACE, "{", 5, 22},
-		{token.RETURN, "return", 6, 10},
+		{token.RETURN, "return", 6, 5},
 		{token.IDENT, "x", 6, 12},
 		{token.PLUS, "+", 6, 14},
 		{token.IDENT, "y", 6, 16},
 		{token.SEMICOLON, ";", 6, 17},
 		{token.RBRACE, "}", 7, 3},
 		{token.SEMICOLON, ";", 7, 4},
-		{token.LET, "let", 9, 5},
-		{token.IDENT, "result", 9, 12},
+		{token.LET, "let", 9, 3},
+		{token.IDENT, "result", 9, 7},
 		{token.ASSIGN, "=", 9, 14},
-		{token.IDENT, "add", 9, 18},
+		{token.IDENT, "add", 9, 16},
 		{token.LPAREN, "(", 9, 19},
-		{token.IDENT, "five", 9, 23},
+		{token.IDENT, "five", 9, 20},
 		{token.COMMA, ",", 9, 24},
-		{token.IDENT, "ten", 9, 28},
+		{token.IDENT, "ten", 9, 26},
 		{token.RPAREN, ")", 9, 29},
 		{token.SEMICOLON, ";", 9, 30},
 		{token.EOF, "", 9, 31},
@@ -202,20 +204,20 @@ func TestComplexSyntax(t *testing.T) {
 		expectedLine    int
 		expectedColumn  int
 	}{
-		{token.LET, "let", 1, 3},
-		{token.IDENT, "five", 1, 8},
+		{token.LET, "let", 1, 1},
+		{token.IDENT, "five", 1, 5},
 		{token.ASSIGN, "=", 1, 10},
 		{token.INT, "5", 1, 12},
 		{token.SEMICOLON, ";", 1, 13},
-		{token.LET, "let", 2, 5},
-		{token.IDENT, "ten", 2, 9},
+		{token.LET, "let", 2, 3},
+		{token.IDENT, "ten", 2, 7},
 		{token.ASSIGN, "=", 2, 11},
-		{token.INT, "10", 2, 14},
+		{token.INT, "10", 2, 13},
 		{token.SEMICOLON, ";", 2, 15},
-		{token.LET, "let", 4, 5},
-		{token.IDENT, "add", 4, 9},
+		{token.LET, "let", 4, 3},
+		{token.IDENT, "add", 4, 7},
 		{token.ASSIGN, "=", 4, 11},
-		{token.FUNCTION, "fn", 4, 14},
+		{token.FUNCTION, "fn", 4, 13},
 		{token.LPAREN, "(", 4, 15},
 		{token.IDENT, "x", 4, 16},
 		{token.COMMA, ",", 4, 17},
@@ -228,14 +230,14 @@ func TestComplexSyntax(t *testing.T) {
 		{token.SEMICOLON, ";", 5, 10},
 		{token.RBRACE, "}", 6, 3},
 		{token.SEMICOLON, ";", 6, 4},
-		{token.LET, "let", 8, 5},
-		{token.IDENT, "result", 8, 12},
+		{token.LET, "let", 8, 3},
+		{token.IDENT, "result", 8, 7},
 		{token.ASSIGN, "=", 8, 14},
-		{token.IDENT, "add", 8, 18},
+		{token.IDENT, "add", 8, 16},
 		{token.LPAREN, "(", 8, 19},
-		{token.IDENT, "five", 8, 23},
+		{token.IDENT, "five", 8, 20},
 		{token.COMMA, ",", 8, 24},
-		{token.IDENT, "ten", 8, 28},
+		{token.IDENT, "ten", 8, 26},
 		{token.RPAREN, ")", 8, 29},
 		{token.SEMICOLON, ";", 8, 30},
 		{token.BANG, "!", 9, 3},
@@ -246,46 +248,46 @@ func TestComplexSyntax(t *testing.T) {
 		{token.SEMICOLON, ";", 9, 8},
 		{token.INT, "5", 10, 3},
 		{token.LT, "<", 10, 5},
-		{token.INT, "10", 10, 8},
+		{token.INT, "10", 10, 7},
 		{token.GT, ">", 10, 10},
 		{token.INT, "5", 10, 12},
 		{token.SEMICOLON, ";", 10, 13},
-		{token.IF, "if", 12, 4},
+		{token.IF, "if", 12, 3},
 		{token.LPAREN, "(", 12, 6},
 		{token.INT, "5", 12, 7},
 		{token.LT, "<", 12, 9},
-		{token.INT, "10", 12, 12},
+		{token.INT, "10", 12, 11},
 		{token.RPAREN, ")", 12, 13},
 		{token.LBRACE, "{", 12, 15},
-		{token.RETURN, "return", 13, 10},
-		{token.TRUE, "true", 13, 15},
+		{token.RETURN, "return", 13, 5},
+		{token.TRUE, "true", 13, 12},
 		{token.SEMICOLON, ";", 13, 16},
 		{token.RBRACE, "}", 14, 3},
-		{token.ELSE, "else", 14, 8},
+		{token.ELSE, "else", 14, 5},
 		{token.LBRACE, "{", 14, 10},
-		{token.RETURN, "return", 15, 10},
-		{token.FALSE, "false", 15, 16},
+		{token.RETURN, "return", 15, 5},
+		{token.FALSE, "false", 15, 12},
 		{token.SEMICOLON, ";", 15, 17},
 		{token.RBRACE, "}", 16, 3},
-		{token.INT, "10", 18, 4},
-		{token.EQ, "==", 18, 7},
-		{token.INT, "10", 18, 10},
+		{token.INT, "10", 18, 3},
+		{token.EQ, "==", 18, 6},
+		{token.INT, "10", 18, 9},
 		{token.SEMICOLON, ";", 18, 11},
-		{token.INT, "10", 19, 4},
-		{token.NOT_EQ, "!=", 19, 7},
+		{token.INT, "10", 19, 3},
+		{token.NOT_EQ, "!=", 19, 6},
 		{token.INT, "9", 19, 9},
 		{token.SEMICOLON, ";", 19, 10},
-		{token.INT, "10", 20, 4},
-		{token.LT_EQ, "<=", 20, 7},
-		{token.INT, "11", 20, 10},
+		{token.INT, "10", 20, 3},
+		{token.LT_EQ, "<=", 20, 6},
+		{token.INT, "11", 20, 9},
 		{token.SEMICOLON, ";", 20, 11},
-		{token.INT, "11", 21, 4},
-		{token.GT_EQ, ">=", 21, 7},
-		{token.INT, "10", 21, 10},
+		{token.INT, "11", 21, 3},
+		{token.GT_EQ, ">=", 21, 6},
+		{token.INT, "10", 21, 9},
 		{token.SEMICOLON, ";", 21, 11},
-		{token.STRING, "foobar", 22, 4},
+		{token.STRING, "foobar", 22, 2},
 		{token.SEMICOLON, ";", 22, 10},
-		{token.STRING, "foo bar", 23, 4},
+		{token.STRING, "foo bar", 23, 2},
 		{token.SEMICOLON, ";", 23, 11},
 		{token.EOF, "", 24, 3},
 	}
@@ -311,3 +313,103 @@ func TestComplexSyntax(t *testing.T) {
 		}
 	}
 }
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 10 / 2; // trailing
+//
+x`
+
+	expectedTokens := []token.TokenType{
+		token.LET, token.IDENT, token.ASSIGN, token.INT, token.SLASH, token.INT, token.SEMICOLON,
+		token.IDENT, token.EOF,
+	}
+
+	l := New(input)
+
+	for i, expected := range expectedTokens {
+		tok := l.NextToken()
+		if tok.Type != expected {
+			t.Fatalf("tests[%d] - tokenType wrong. expected=%q, got=%q", i, expected, tok.Type)
+		}
+	}
+
+	expectedComments := []token.Token{
+		{Type: token.COMMENT, Literal: "// leading", Line: 1, Column: 1, Offset: 0},
+		{Type: token.COMMENT, Literal: "// trailing", Line: 2, Column: 17, Offset: 27},
+		{Type: token.COMMENT, Literal: "//", Line: 3, Column: 1, Offset: 39},
+	}
+
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expectedComments), len(comments))
+	}
+	for i, expected := range expectedComments {
+		if comments[i] != expected {
+			t.Errorf("comments[%d] wrong. expected=%+v, got=%+v", i, expected, comments[i])
+		}
+	}
+}
+
+func TestTokensAtEndOfLine(t *testing.T) {
+	input := "foo\n12\n3.5\nbar"
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+		expectedOffset int
+	}{
+		{token.IDENT, 1, 1, 0},
+		{token.INT, 2, 1, 4},
+		{token.FLOAT, 3, 1, 7},
+		{token.IDENT, 4, 1, 11},
+		{token.EOF, 4, 4, 14},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Line != tt.expectedLine {
+			t.Fatalf("tests[%d] - tokenLine wrong. expected=%d, got=%d", i, tt.expectedLine, tok.Line)
+		}
+		if tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - tokenColumn wrong. expected=%d, got=%d", i, tt.expectedColumn, tok.Column)
+		}
+		if tok.Offset != tt.expectedOffset {
+			t.Fatalf("tests[%d] - tokenOffset wrong. expected=%d, got=%d", i, tt.expectedOffset, tok.Offset)
+		}
+	}
+}
+
+func TestTokensJSON(t *testing.T) {
+	input := "let s = \"a b\";\nf(1.5)"
+
+	tokens := New(input).Tokens()
+	if tokens[len(tokens)-1].Type != token.EOF {
+		t.Fatalf("tokens do not end with EOF. got=%+v", tokens[len(tokens)-1])
+	}
+
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var decoded []token.Token
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(decoded, tokens) {
+		t.Errorf("wrong tokens.\nexpected=%+v\ngot=%+v", tokens, decoded)
+	}
+
+	expected := `{"type":"STRING","literal":"a b","line":1,"column":9,"offset":8}`
+	if first, _ := json.Marshal(tokens[3]); string(first) != expected {
+		t.Errorf("wrong JSON. expected=%s, got=%s", expected, first)
+	}
+}
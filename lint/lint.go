@@ -0,0 +1,301 @@
+// Package lint reports suspicious constructs in Monkey programs. Every
+// rule has an ID and a severity; rules can be turned off for a linter, or
+// for parts of a file with comments:
+//
+//	// lint:ignore unused-let,shadowed the reason
+//
+// silences the listed rules, or all of them when none is listed, on the
+// line of the comment and on the next one, while
+//
+//	// lint:file-ignore self-comparison
+//
+// silences them in the whole file.
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+	"github.com/cupsadarius/monkey_interpreter/resolver"
+	"github.com/cupsadarius/monkey_interpreter/token"
+)
+
+// Severity tells how serious a diagnostic is.
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// ParseSeverity returns the severity named s.
+func ParseSeverity(s string) (Severity, error) {
+	switch s {
+	case "warning":
+		return Warning, nil
+	case "error":
+		return Error, nil
+	}
+
+	return 0, fmt.Errorf("unknown severity %q", s)
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	severity, err := ParseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+
+	*s = severity
+	return nil
+}
+
+// Diagnostic is a problem found in a file.
+type Diagnostic struct {
+	File     string         `json:"file"`
+	Rule     string         `json:"rule"`
+	Severity Severity       `json:"severity"`
+	Message  string         `json:"message"`
+	Pos      token.Position `json:"pos"`
+	End      token.Position `json:"end"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%s: %s: %s [%s]", d.File, d.Pos, d.Severity, d.Message, d.Rule)
+}
+
+// Rule is a check of the linter.
+type Rule struct {
+	ID       string
+	Severity Severity // the default one
+	Doc      string
+	check    func(p *pass)
+}
+
+// Rules returns the rules of the linter, sorted by ID.
+func Rules() []Rule {
+	list := make([]Rule, len(rules))
+	for i, r := range rules {
+		list[i] = *r
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	return list
+}
+
+// Lookup returns the rule with the given ID.
+func Lookup(id string) (Rule, bool) {
+	for _, r := range rules {
+		if r.ID == id {
+			return *r, true
+		}
+	}
+
+	return Rule{}, false
+}
+
+// Linter checks programs with a configured set of rules.
+type Linter struct {
+	disabled   map[string]bool
+	severities map[string]Severity
+}
+
+type Option func(*Linter)
+
+// WithDisabled turns off the rules with the given IDs.
+func WithDisabled(ids ...string) Option {
+	return func(l *Linter) {
+		for _, id := range ids {
+			l.disabled[id] = true
+		}
+	}
+}
+
+// WithSeverity reports the diagnostics of the rule id with severity.
+func WithSeverity(id string, severity Severity) Option {
+	return func(l *Linter) {
+		l.severities[id] = severity
+	}
+}
+
+func New(opts ...Option) *Linter {
+	l := &Linter{disabled: map[string]bool{}, severities: map[string]Severity{}}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+// Lint checks the source src of file, which only names the file in the
+// diagnostics. The diagnostics are sorted by position. It fails if src
+// does not parse.
+func (l *Linter) Lint(file string, src []byte) ([]Diagnostic, error) {
+	lex := lexer.New(string(src))
+	p := parser.New(lex)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parse error: %s", strings.Join(p.Errors(), "; "))
+	}
+
+	ignores := parseIgnores(lex.Comments())
+	pass := &pass{src: src, program: program, bindings: resolver.Bind(program)}
+
+	for _, r := range rules {
+		if l.disabled[r.ID] {
+			continue
+		}
+
+		pass.rule = r
+		pass.severity = r.Severity
+		if s, ok := l.severities[r.ID]; ok {
+			pass.severity = s
+		}
+		r.check(pass)
+	}
+
+	var diagnostics []Diagnostic
+	for _, d := range pass.diagnostics {
+		if ignores.ignored(d) {
+			continue
+		}
+
+		d.File = file
+		diagnostics = append(diagnostics, d)
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Pos.Offset < diagnostics[j].Pos.Offset
+	})
+
+	return diagnostics, nil
+}
+
+// pass holds what the rules share while checking a program.
+type pass struct {
+	src      []byte
+	program  *ast.Program
+	bindings *resolver.Bindings
+
+	rule        *Rule
+	severity    Severity
+	diagnostics []Diagnostic
+}
+
+// report records a diagnostic of the current rule spanning node.
+func (p *pass) report(node ast.Node, format string, args ...interface{}) {
+	p.reportSpan(node.Pos(), node.End(), format, args...)
+}
+
+// source returns the text node was parsed from, so that messages show
+// expressions as they are written, strings with their quotes.
+func (p *pass) source(node ast.Node) string {
+	return string(p.src[node.Pos().Offset:node.End().Offset])
+}
+
+func (p *pass) reportSpan(pos, end token.Position, format string, args ...interface{}) {
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Rule:     p.rule.ID,
+		Severity: p.severity,
+		Message:  fmt.Sprintf(format, args...),
+		Pos:      pos,
+		End:      end,
+	})
+}
+
+const (
+	ignoreDirective     = "lint:ignore"
+	fileIgnoreDirective = "lint:file-ignore"
+	allRules            = "" // stands for every rule in ignores
+)
+
+// ignores records the rules silenced by comments.
+type ignores struct {
+	file  map[string]bool
+	lines map[int]map[string]bool
+}
+
+func parseIgnores(comments []token.Token) *ignores {
+	ig := &ignores{file: map[string]bool{}, lines: map[int]map[string]bool{}}
+
+	for _, c := range comments {
+		text := strings.TrimSpace(strings.TrimPrefix(c.Literal, "//"))
+
+		var ids []string
+		var silence func(id string)
+		switch {
+		case strings.HasPrefix(text, fileIgnoreDirective):
+			ids = ruleIDs(strings.TrimPrefix(text, fileIgnoreDirective))
+			silence = func(id string) { ig.file[id] = true }
+		case strings.HasPrefix(text, ignoreDirective):
+			ids = ruleIDs(strings.TrimPrefix(text, ignoreDirective))
+			silence = func(id string) {
+				for _, line := range []int{c.Line, c.Line + 1} {
+					if ig.lines[line] == nil {
+						ig.lines[line] = map[string]bool{}
+					}
+					ig.lines[line][id] = true
+				}
+			}
+		default:
+			continue
+		}
+
+		if len(ids) == 0 {
+			ids = []string{allRules}
+		}
+		for _, id := range ids {
+			silence(id)
+		}
+	}
+
+	return ig
+}
+
+// ruleIDs splits the comma separated list of IDs that follows a directive,
+// leaving out the text after it.
+func ruleIDs(text string) []string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	var ids []string
+	for _, id := range strings.Split(fields[0], ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+func (ig *ignores) ignored(d Diagnostic) bool {
+	if ig.file[allRules] || ig.file[d.Rule] {
+		return true
+	}
+
+	line := ig.lines[d.Pos.Line]
+	return line[allRules] || line[d.Rule]
+}
@@ -0,0 +1,179 @@
+package lint
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// lint returns the diagnostics of input as "line:column rule: message".
+func lint(t *testing.T, input string, opts ...Option) []string {
+	t.Helper()
+
+	diagnostics, err := New(opts...).Lint("test.mk", []byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, d.Pos.String()+" "+d.Rule+": "+d.Message)
+	}
+
+	return got
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			"let f = fn(a, b, _c) { let x = 1; let y = a; y };",
+			[]string{
+				"1:15 unused-parameter: parameter b is never used",
+				"1:28 unused-let: x is never used",
+			},
+		},
+		{
+			// top-level names may be read by the host
+			"let x = 1; let f = fn() { let g = fn() { g() }; g };",
+			nil,
+		},
+		{
+			"let x = 1; let f = fn(x) { let f = x; f };",
+			[]string{
+				"1:23 shadowed: x shadows the x declared at 1:5",
+				"1:32 shadowed: f shadows the f declared at 1:16",
+			},
+		},
+		{
+			"let f = fn(n) { if (n > 1) { return n; n + 1; n } else { n }; return 1; 2 };",
+			[]string{
+				"1:40 unreachable: unreachable code",
+				"1:73 unreachable: unreachable code",
+			},
+		},
+		{
+			"let x = 1; x == x; x < x; x.len >= x.len; f() == f(); x == 1;",
+			[]string{
+				"1:12 self-comparison: x is compared with itself, which is always true",
+				"1:20 self-comparison: x is compared with itself, which is always false",
+				"1:27 self-comparison: x.len is compared with itself, which is always true",
+			},
+		},
+		{
+			"let x = 1; if (true) { 1 }; if (1 > 2) { 1 }; if (fn() {}) { 1 }; if (x) { 1 }; if (1 / 0) { 1 };",
+			[]string{
+				"1:16 constant-condition: condition is always true",
+				"1:33 constant-condition: condition is always false",
+				"1:51 constant-condition: condition is always true",
+			},
+		},
+		{
+			"let n = 5; let f = fn(g) { g(1) }; n(1); 1(); (1 + 2)(); f(f); fn() {}(); if (true) { f } else { f }();",
+			[]string{
+				"1:36 not-callable: n is not a function, it is bound to 5",
+				"1:42 not-callable: 1 is not a function",
+				"1:47 not-callable: (1 + 2) is not a function",
+				"1:79 constant-condition: condition is always true",
+			},
+		},
+		{
+			`let s = "f"; s(); "f"(); ("a" + "b")();`,
+			[]string{
+				`1:14 not-callable: s is not a function, it is bound to "f"`,
+				`1:19 not-callable: "f" is not a function`,
+				`1:26 not-callable: ("a" + "b") is not a function`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got := lint(t, tt.input)
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong diagnostics for %q.\nexpected=\n%s\ngot=\n%s", tt.input, strings.Join(tt.expected, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestIgnoreComments(t *testing.T) {
+	input := `// lint:file-ignore self-comparison
+let f = fn(a) { // lint:ignore unused-parameter the callback API wants it
+  let x = 1;
+  // lint:ignore
+  let y = 2;
+  let z = 3; // lint:ignore shadowed,unused-let
+  1 == 1
+};
+`
+	expected := []string{"3:7 unused-let: x is never used"}
+
+	got := lint(t, input)
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong diagnostics.\nexpected=\n%s\ngot=\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestOptions(t *testing.T) {
+	input := "let f = fn(a) { let x = 1; 2 };"
+
+	got := lint(t, input, WithDisabled("unused-parameter"))
+	if strings.Join(got, "\n") != "1:21 unused-let: x is never used" {
+		t.Errorf("rule not disabled. got=%q", got)
+	}
+
+	diagnostics, err := New(WithSeverity("unused-let", Error)).Lint("test.mk", []byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(diagnostics) != 2 || diagnostics[0].Severity != Warning || diagnostics[1].Severity != Error {
+		t.Errorf("wrong severities. got=%+v", diagnostics)
+	}
+}
+
+func TestDiagnosticOutput(t *testing.T) {
+	diagnostics, err := New().Lint("test.mk", []byte("let n = 1;\nn()"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. got=%+v", diagnostics)
+	}
+
+	expected := "test.mk:2:1: error: n is not a function, it is bound to 1 [not-callable]"
+	if diagnostics[0].String() != expected {
+		t.Errorf("wrong text. expected=%q, got=%q", expected, diagnostics[0].String())
+	}
+
+	data, err := json.Marshal(diagnostics[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected = `{"file":"test.mk","rule":"not-callable","severity":"error",` +
+		`"message":"n is not a function, it is bound to 1",` +
+		`"pos":{"offset":11,"line":2,"column":1},"end":{"offset":12,"line":2,"column":2}}`
+	if string(data) != expected {
+		t.Errorf("wrong JSON.\nexpected=%s\ngot=%s", expected, data)
+	}
+
+	var decoded Diagnostic
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded != diagnostics[0] {
+		t.Errorf("wrong decoded diagnostic. got=%+v, %v", decoded, err)
+	}
+}
+
+func TestRuleList(t *testing.T) {
+	for _, r := range Rules() {
+		if r.ID == "" || r.Doc == "" {
+			t.Errorf("rule without ID or doc: %+v", r)
+		}
+		if found, ok := Lookup(r.ID); !ok || found.ID != r.ID {
+			t.Errorf("rule %s not found", r.ID)
+		}
+	}
+
+	if _, err := New().Lint("test.mk", []byte("let = 1")); err == nil {
+		t.Errorf("expected a parse error")
+	}
+}
@@ -0,0 +1,234 @@
+package lint
+
+import (
+	"strings"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/resolver"
+)
+
+var rules = []*Rule{
+	{
+		ID:       "unused-let",
+		Severity: Warning,
+		Doc:      "a let statement in a function binds a name that is never read; top-level names may be read by the host",
+		check:    unusedLets,
+	},
+	{
+		ID:       "unused-parameter",
+		Severity: Warning,
+		Doc:      "a function parameter is never read; names starting with _ are exempt",
+		check:    unusedParameters,
+	},
+	{
+		ID:       "shadowed",
+		Severity: Warning,
+		Doc:      "a parameter or let statement of a function hides a name of an enclosing scope",
+		check:    shadowed,
+	},
+	{
+		ID:       "unreachable",
+		Severity: Warning,
+		Doc:      "statements follow a return statement in the same block",
+		check:    unreachable,
+	},
+	{
+		ID:       "self-comparison",
+		Severity: Warning,
+		Doc:      "a value is compared with itself, which always gives the same result",
+		check:    selfComparison,
+	},
+	{
+		ID:       "constant-condition",
+		Severity: Warning,
+		Doc:      "the condition of an if expression does not depend on anything, so the same branch always runs",
+		check:    constantCondition,
+	},
+	{
+		ID:       "not-callable",
+		Severity: Error,
+		Doc:      "a value that cannot be a function is called",
+		check:    notCallable,
+	},
+}
+
+func unusedLets(p *pass) {
+	for _, v := range p.bindings.Variables {
+		if v.Function == nil || v.IsParameter() || len(v.Uses) > 0 || ignored(v) {
+			continue
+		}
+
+		p.report(v.Declarations[0], "%s is never used", v.Name)
+	}
+}
+
+func unusedParameters(p *pass) {
+	for _, v := range p.bindings.Variables {
+		if !v.IsParameter() || len(v.Uses) > 0 || ignored(v) {
+			continue
+		}
+
+		p.report(v.Declarations[0], "parameter %s is never used", v.Name)
+	}
+}
+
+// ignored tells whether the name of v marks it as unused on purpose.
+func ignored(v *resolver.Variable) bool {
+	return strings.HasPrefix(v.Name, "_")
+}
+
+func shadowed(p *pass) {
+	for _, v := range p.bindings.Variables {
+		if v.Shadows == nil {
+			continue
+		}
+
+		p.report(v.Declarations[0], "%s shadows the %s declared at %s", v.Name, v.Name, v.Shadows.Declarations[0].Pos())
+	}
+}
+
+func unreachable(p *pass) {
+	check := func(statements []ast.Statement) {
+		for i := 0; i < len(statements)-1; i++ {
+			if _, ok := statements[i].(*ast.ReturnStatement); ok {
+				p.reportSpan(statements[i+1].Pos(), statements[len(statements)-1].End(), "unreachable code")
+				return
+			}
+		}
+	}
+
+	check(p.program.Statements)
+	ast.Inspect(p.program, func(n ast.Node) bool {
+		if b, ok := n.(*ast.BlockStatement); ok {
+			check(b.Statements)
+		}
+		return true
+	})
+}
+
+func selfComparison(p *pass) {
+	results := map[string]bool{"==": true, "<=": true, ">=": true, "!=": false, "<": false, ">": false}
+
+	ast.Inspect(p.program, func(n ast.Node) bool {
+		ie, ok := n.(*ast.InfixExpression)
+		if !ok {
+			return true
+		}
+
+		result, comparison := results[ie.Operator]
+		if comparison && pure(ie.Left) && ie.Left.String() == ie.Right.String() {
+			p.report(ie, "%s is compared with itself, which is always %t", ie.Left, result)
+		}
+		return true
+	})
+}
+
+func constantCondition(p *pass) {
+	ast.Inspect(p.program, func(n ast.Node) bool {
+		ie, ok := n.(*ast.IfExpression)
+		if !ok || ie.Condition == nil {
+			return true
+		}
+
+		if _, ok := ie.Condition.(*ast.FunctionLiteral); ok {
+			p.report(ie.Condition, "condition is always true")
+			return true
+		}
+		if value, ok := constant(ie.Condition); ok {
+			p.report(ie.Condition, "condition is always %t", evaluator.IsTruthy(value))
+		}
+		return true
+	})
+}
+
+func notCallable(p *pass) {
+	ast.Inspect(p.program, func(n ast.Node) bool {
+		ce, ok := n.(*ast.CallExpression)
+		if !ok {
+			return true
+		}
+
+		switch fn := ce.Function.(type) {
+		case *ast.Identifier:
+			// a name bound once, to a value that cannot be a function
+			v := p.bindings.Lookup(fn)
+			if v != nil && !v.IsParameter() && len(v.Lets) == 1 && v.Lets[0].Value != nil && !function(v.Lets[0].Value) {
+				p.report(fn, "%s is not a function, it is bound to %s", fn.Value, p.source(v.Lets[0].Value))
+			}
+		default:
+			if !function(fn) {
+				p.report(fn, "%s is not a function", p.source(fn))
+			}
+		}
+		return true
+	})
+}
+
+// function tells whether e may evaluate to a function. Literals and the
+// results of operators never do.
+func function(e ast.Expression) bool {
+	switch e.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.BooleanLiteral,
+		*ast.PrefixExpression, *ast.InfixExpression:
+		return false
+	}
+
+	return true
+}
+
+// pure tells whether evaluating e has no effects, so that it gives the
+// same value every time.
+func pure(e ast.Expression) bool {
+	switch e := e.(type) {
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.BooleanLiteral:
+		return true
+	case *ast.PrefixExpression:
+		return pure(e.Right)
+	case *ast.InfixExpression:
+		return pure(e.Left) && pure(e.Right)
+	case *ast.MemberExpression:
+		return pure(e.Object)
+	}
+
+	return false
+}
+
+// constant returns the value of an expression made of literals and
+// operators only. Expressions whose evaluation fails are not constant.
+func constant(e ast.Expression) (object.Object, bool) {
+	var value object.Object
+
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: e.Value}, true
+	case *ast.FloatLiteral:
+		return &object.Float{Value: e.Value}, true
+	case *ast.StringLiteral:
+		return &object.String{Value: e.Value}, true
+	case *ast.BooleanLiteral:
+		return object.NativeBoolToBoolean(e.Value), true
+	case *ast.PrefixExpression:
+		right, ok := constant(e.Right)
+		if !ok {
+			return nil, false
+		}
+		value = evaluator.EvalPrefix(e.Operator, right)
+	case *ast.InfixExpression:
+		left, leftOk := constant(e.Left)
+		right, rightOk := constant(e.Right)
+		if !leftOk || !rightOk {
+			return nil, false
+		}
+		value = evaluator.EvalInfix(e.Operator, left, right)
+	default:
+		return nil, false
+	}
+
+	if value.Type() == object.ERROR_OBJ {
+		return nil, false
+	}
+
+	return value, true
+}
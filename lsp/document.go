@@ -0,0 +1,122 @@
+package lsp
+
+import (
+	"sort"
+	"unicode/utf8"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+	"github.com/cupsadarius/monkey_interpreter/resolver"
+	"github.com/cupsadarius/monkey_interpreter/token"
+)
+
+// document is an open text document, parsed every time it changes. The
+// tree of a document that fails to parse holds what could be parsed.
+type document struct {
+	uri     string
+	version int
+	text    string
+	lines   []int // offsets of the first byte of every line
+
+	program  *ast.Program
+	errors   []parser.Error
+	bindings *resolver.Bindings
+}
+
+func newDocument(uri string, version int, text string) *document {
+	d := &document{uri: uri, version: version, text: text, lines: []int{0}}
+
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+
+	p := parser.New(lexer.New(text))
+	d.program = p.ParseProgram()
+	d.errors = p.ErrorList()
+	d.bindings = resolver.Bind(d.program)
+
+	return d
+}
+
+// position converts a byte offset into a position of the protocol.
+func (d *document) position(offset int) Position {
+	if offset > len(d.text) {
+		offset = len(d.text)
+	}
+
+	line := sort.Search(len(d.lines), func(i int) bool { return d.lines[i] > offset }) - 1
+	character := 0
+	for _, r := range d.text[d.lines[line]:offset] {
+		character += utf16Len(r)
+	}
+
+	return Position{Line: line, Character: character}
+}
+
+// offset converts a position of the protocol into a byte offset. Positions
+// past the end of their line stand for the end of the line.
+func (d *document) offset(p Position) int {
+	if p.Line < 0 {
+		return 0
+	}
+	if p.Line >= len(d.lines) {
+		return len(d.text)
+	}
+
+	offset := d.lines[p.Line]
+	for character := 0; character < p.Character && offset < len(d.text) && d.text[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(d.text[offset:])
+		character += utf16Len(r)
+		offset += size
+	}
+
+	return offset
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+
+	return 1
+}
+
+func (d *document) span(pos, end token.Position) Range {
+	return Range{Start: d.position(pos.Offset), End: d.position(end.Offset)}
+}
+
+func (d *document) rangeOf(node ast.Node) Range {
+	return d.span(node.Pos(), node.End())
+}
+
+// identifierAt returns the identifier under, or just before, offset.
+func (d *document) identifierAt(offset int) *ast.Identifier {
+	var found *ast.Identifier
+
+	ast.Inspect(d.program, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok && ident.Token.Pos().Offset <= offset && offset <= ident.Token.End().Offset {
+			found = ident
+		}
+		return found == nil
+	})
+
+	return found
+}
+
+// functionAt returns the innermost function literal whose fn keyword is
+// under offset.
+func (d *document) functionAt(offset int) *ast.FunctionLiteral {
+	var found *ast.FunctionLiteral
+
+	ast.Inspect(d.program, func(n ast.Node) bool {
+		if fl, ok := n.(*ast.FunctionLiteral); ok && fl.Token.Pos().Offset <= offset && offset <= fl.Token.End().Offset {
+			found = fl
+		}
+		return true
+	})
+
+	return found
+}
@@ -0,0 +1,290 @@
+package lsp
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/format"
+	"github.com/cupsadarius/monkey_interpreter/resolver"
+)
+
+var keywords = []string{"else", "false", "fn", "if", "let", "return", "true"}
+
+// diagnostics returns the errors of the parser, each spanning the token it
+// was found at.
+func (d *document) diagnostics() []Diagnostic {
+	diagnostics := []Diagnostic{}
+
+	for _, e := range d.errors {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    d.span(e.Token.Pos(), e.Token.End()),
+			Severity: SeverityError,
+			Source:   "monkey",
+			Message:  e.Msg,
+		})
+	}
+
+	return diagnostics
+}
+
+// identifierRange returns the range of the name of ident, leaving out the
+// parentheses around it.
+func (d *document) identifierRange(ident *ast.Identifier) Range {
+	return d.span(ident.Token.Pos(), ident.Token.End())
+}
+
+// variableAt returns the variable named by the identifier at the position
+// p points to.
+func (s *Server) variableAt(p TextDocumentPositionParams) (*document, *ast.Identifier, *resolver.Variable, error) {
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	ident := d.identifierAt(d.offset(p.Position))
+	if ident == nil {
+		return d, nil, nil, nil
+	}
+
+	return d, ident, d.bindings.Lookup(ident), nil
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	d, _, v, err := s.variableAt(p)
+	if err != nil || v == nil {
+		return nil, err
+	}
+
+	locations := []Location{}
+	for _, decl := range v.Declarations {
+		locations = append(locations, Location{URI: d.uri, Range: d.identifierRange(decl)})
+	}
+
+	return locations, nil
+}
+
+func (s *Server) references(params json.RawMessage) (interface{}, error) {
+	var p ReferenceParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	d, _, v, err := s.variableAt(p.TextDocumentPositionParams)
+	if err != nil || v == nil {
+		return nil, err
+	}
+
+	idents := v.Uses
+	if p.Context.IncludeDeclaration {
+		idents = append(append([]*ast.Identifier{}, v.Declarations...), v.Uses...)
+		sort.Slice(idents, func(i, j int) bool { return idents[i].Token.Offset < idents[j].Token.Offset })
+	}
+
+	locations := []Location{}
+	for _, ident := range idents {
+		locations = append(locations, Location{URI: d.uri, Range: d.identifierRange(ident)})
+	}
+
+	return locations, nil
+}
+
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	d, ident, v, err := s.variableAt(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var text string
+	var r Range
+	switch {
+	case v != nil:
+		text, r = describe(v), d.identifierRange(ident)
+	default:
+		// the fn keyword of a function literal
+		fl := d.functionAt(d.offset(p.Position))
+		if fl == nil {
+			return nil, nil
+		}
+		text, r = signature(fl), d.span(fl.Token.Pos(), fl.Token.End())
+	}
+
+	return Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```monkey\n" + text + "\n```"},
+		Range:    r,
+	}, nil
+}
+
+// describe returns how v is declared: the signature of the function bound
+// to it, the value of the literal bound to it or the function it is a
+// parameter of.
+func describe(v *resolver.Variable) string {
+	if v.IsParameter() {
+		return "parameter " + v.Name + " of " + signature(v.Function)
+	}
+
+	switch value := v.Lets[0].Value.(type) {
+	case *ast.FunctionLiteral:
+		return signature(value)
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.BooleanLiteral:
+		return "let " + v.Name + " = " + value.String()
+	case *ast.StringLiteral:
+		return "let " + v.Name + ` = "` + value.Value + `"`
+	}
+
+	return "let " + v.Name
+}
+
+// signature returns the name, if any, and the parameters of fl.
+func signature(fl *ast.FunctionLiteral) string {
+	params := make([]string, len(fl.Parameters))
+	for i, p := range fl.Parameters {
+		params[i] = p.Value
+	}
+
+	name := ""
+	if fl.Name != "" {
+		name = " " + fl.Name
+	}
+
+	return "fn" + name + "(" + strings.Join(params, ", ") + ")"
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p DocumentSymbolParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.symbols(d.program), nil
+}
+
+// symbols returns the let statements of node, those in the bodies of the
+// functions they bind as their children.
+func (d *document) symbols(node ast.Node) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		let, ok := n.(*ast.LetStatement)
+		if !ok || let.Name == nil {
+			return true
+		}
+
+		symbol := DocumentSymbol{
+			Name:           let.Name.Value,
+			Kind:           SymbolKindVariable,
+			Range:          d.rangeOf(let),
+			SelectionRange: d.identifierRange(let.Name),
+		}
+		if fl, ok := let.Value.(*ast.FunctionLiteral); ok {
+			symbol.Kind = SymbolKindFunction
+			symbol.Detail = signature(fl)
+		}
+		if let.Value != nil {
+			if children := d.symbols(let.Value); len(children) > 0 {
+				symbol.Children = children
+			}
+		}
+
+		symbols = append(symbols, symbol)
+		return false
+	})
+
+	return symbols
+}
+
+func (s *Server) completion(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := d.offset(p.Position)
+	prefix := d.wordBefore(offset)
+
+	items := []CompletionItem{}
+	for _, v := range d.bindings.Visible(offset) {
+		if !strings.HasPrefix(v.Name, prefix) {
+			continue
+		}
+
+		item := CompletionItem{Label: v.Name, Kind: CompletionKindVariable, Detail: describe(v)}
+		if !v.IsParameter() {
+			if _, ok := v.Lets[0].Value.(*ast.FunctionLiteral); ok {
+				item.Kind = CompletionKindFunction
+			}
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+
+	for _, k := range keywords {
+		if strings.HasPrefix(k, prefix) {
+			items = append(items, CompletionItem{Label: k, Kind: CompletionKindKeyword})
+		}
+	}
+
+	return items, nil
+}
+
+// wordBefore returns the part of an identifier that ends at offset.
+func (d *document) wordBefore(offset int) string {
+	start := offset
+	for start > 0 && isIdentifierByte(d.text[start-1]) {
+		start--
+	}
+
+	return d.text[start:offset]
+}
+
+func isIdentifierByte(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+}
+
+func (s *Server) formatting(params json.RawMessage) (interface{}, error) {
+	var p DocumentFormattingParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	formatted, err := format.Source([]byte(d.text))
+	if err != nil {
+		return nil, err
+	}
+
+	edits := []TextEdit{}
+	if string(formatted) != d.text {
+		edits = append(edits, TextEdit{
+			Range:   Range{Start: Position{}, End: d.position(len(d.text))},
+			NewText: string(formatted),
+		})
+	}
+
+	return edits, nil
+}
@@ -0,0 +1,230 @@
+// Package lsp implements a Language Server Protocol server for Monkey,
+// speaking JSON-RPC over a pair of streams such as stdin and stdout. It
+// reports the errors of the parser as diagnostics and offers go to
+// definition, references, hover, document symbols, completion and
+// formatting. Documents are synchronized as a whole on every change.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cupsadarius/monkey_interpreter/internal/framing"
+)
+
+// ErrExitWithoutShutdown is returned by Serve when the client asks the
+// server to exit without shutting it down first.
+var ErrExitWithoutShutdown = errors.New("lsp: exit without shutdown")
+
+// Server answers the requests of a single client.
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	documents map[string]*document
+	shutdown  bool
+}
+
+// NewServer returns a server reading messages from in and writing them to
+// out.
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: map[string]*document{},
+	}
+}
+
+// handler answers a request, or handles a notification, with params
+// decoded into a value of its own.
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+var handlers = map[string]handler{
+	"initialize":  (*Server).initialize,
+	"initialized": ignore,
+	"shutdown": func(s *Server, params json.RawMessage) (interface{}, error) {
+		s.shutdown = true
+		return nil, nil
+	},
+	"textDocument/didOpen":        (*Server).didOpen,
+	"textDocument/didChange":      (*Server).didChange,
+	"textDocument/didClose":       (*Server).didClose,
+	"textDocument/definition":     (*Server).definition,
+	"textDocument/references":     (*Server).references,
+	"textDocument/hover":          (*Server).hover,
+	"textDocument/documentSymbol": (*Server).documentSymbol,
+	"textDocument/completion":     (*Server).completion,
+	"textDocument/formatting":     (*Server).formatting,
+}
+
+func ignore(s *Server, params json.RawMessage) (interface{}, error) {
+	return nil, nil
+}
+
+// Serve handles messages until the client asks the server to exit or
+// closes the input. Messages are handled one at a time, in order.
+func (s *Server) Serve() error {
+	for {
+		body, err := framing.Read(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("lsp: %w", err)
+		}
+
+		m := &message{}
+		if err := json.Unmarshal(body, m); err != nil {
+			// answered with a parse error, as the ID cannot be known
+			re := &ResponseError{Code: codeParseError, Message: err.Error()}
+			if err := s.replyError(json.RawMessage("null"), re); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if m.Method == "exit" {
+			if !s.shutdown {
+				return ErrExitWithoutShutdown
+			}
+			return nil
+		}
+
+		if err := s.handle(m); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(m *message) error {
+	h, ok := handlers[m.Method]
+	switch {
+	case !m.isRequest() && !ok:
+		// notifications the server does not know are dropped
+		return nil
+	case !m.isRequest():
+		_, err := h(s, m.Params)
+		return s.notifyError(err)
+	case s.shutdown:
+		return s.replyError(m.ID, &ResponseError{Code: codeInvalidRequest, Message: "the server is shut down"})
+	case !ok:
+		return s.replyError(m.ID, &ResponseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", m.Method)})
+	}
+
+	result, err := h(s, m.Params)
+	if err != nil {
+		return s.replyError(m.ID, err)
+	}
+
+	return framing.Write(s.out, response{JSONRPC: "2.0", ID: m.ID, Result: result})
+}
+
+func (s *Server) replyError(id json.RawMessage, err error) error {
+	var re *ResponseError
+	if !errors.As(err, &re) {
+		re = &ResponseError{Code: codeRequestFailed, Message: err.Error()}
+	}
+
+	return framing.Write(s.out, errorResponse{JSONRPC: "2.0", ID: id, Error: re})
+}
+
+// notifyError shows the error a notification failed with, as there is
+// nobody to reply to. Other errors, of the connection, are returned.
+func (s *Server) notifyError(err error) error {
+	var re *ResponseError
+	if !errors.As(err, &re) {
+		return err
+	}
+
+	return s.notify("window/showMessage", map[string]interface{}{"type": 1, "message": re.Message})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return framing.Write(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// decode unmarshals the params of a message into v.
+func decode(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &ResponseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+
+	return nil
+}
+
+// document returns the open document uri.
+func (s *Server) document(uri string) (*document, error) {
+	d, ok := s.documents[uri]
+	if !ok {
+		return nil, &ResponseError{Code: codeInvalidParams, Message: fmt.Sprintf("document not open: %s", uri)}
+	}
+
+	return d, nil
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	return InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:           TextDocumentSyncFull,
+			DefinitionProvider:         true,
+			ReferencesProvider:         true,
+			HoverProvider:              true,
+			DocumentSymbolProvider:     true,
+			CompletionProvider:         CompletionOptions{},
+			DocumentFormattingProvider: true,
+		},
+		ServerInfo: ServerInfo{Name: "monkey"},
+	}, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) (interface{}, error) {
+	var p DidOpenTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	return nil, s.update(newDocument(p.TextDocument.URI, p.TextDocument.Version, p.TextDocument.Text))
+}
+
+func (s *Server) didChange(params json.RawMessage) (interface{}, error) {
+	var p DidChangeTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if len(p.ContentChanges) == 0 {
+		return nil, nil
+	}
+
+	// with full synchronization the last change holds the whole text
+	text := p.ContentChanges[len(p.ContentChanges)-1].Text
+	return nil, s.update(newDocument(p.TextDocument.URI, p.TextDocument.Version, text))
+}
+
+func (s *Server) didClose(params json.RawMessage) (interface{}, error) {
+	var p DidCloseTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	delete(s.documents, p.TextDocument.URI)
+
+	// clear the diagnostics of the closed document
+	return nil, s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         p.TextDocument.URI,
+		Diagnostics: []Diagnostic{},
+	})
+}
+
+// update stores d and publishes its diagnostics.
+func (s *Server) update(d *document) error {
+	s.documents[d.uri] = d
+
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         d.uri,
+		Version:     d.version,
+		Diagnostics: d.diagnostics(),
+	})
+}
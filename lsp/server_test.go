@@ -0,0 +1,405 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/internal/framing"
+)
+
+const uri = "file:///test.mk"
+
+const source = `let add = fn(a, b) { a + b };
+let x = 5;
+let f = fn(n) {
+  let y = add(n, x);
+  y
+};
+f(1)
+`
+
+// client talks to a server running in another goroutine, collecting the
+// notifications it sends between the responses.
+type client struct {
+	t        *testing.T
+	in       io.WriteCloser
+	messages chan *message
+	done     chan error
+
+	id            int
+	notifications []*message
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &client{t: t, in: clientOut, messages: make(chan *message, 16), done: make(chan error, 1)}
+
+	go func() {
+		err := NewServer(serverIn, serverOut).Serve()
+		serverOut.Close()
+		c.done <- err
+	}()
+	go func() {
+		r := bufio.NewReader(clientIn)
+		for {
+			body, err := framing.Read(r)
+			m := &message{}
+			if err == nil {
+				err = json.Unmarshal(body, m)
+			}
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			c.messages <- m
+		}
+	}()
+
+	return c
+}
+
+// call sends a request and returns the response to it.
+func (c *client) call(method string, params interface{}) *message {
+	c.t.Helper()
+
+	c.id++
+	id, _ := json.Marshal(c.id)
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "id": c.id, "method": method, "params": params})
+
+	for m := range c.messages {
+		if m.Method != "" {
+			c.notifications = append(c.notifications, m)
+			continue
+		}
+		if string(m.ID) != string(id) {
+			c.t.Fatalf("wrong response id. expected=%s, got=%s", id, m.ID)
+		}
+		return m
+	}
+
+	c.t.Fatalf("no response to %s", method)
+	return nil
+}
+
+// result sends a request and returns its result as JSON.
+func (c *client) result(method string, params interface{}) string {
+	c.t.Helper()
+
+	m := c.call(method, params)
+	if m.Error != nil {
+		c.t.Fatalf("%s failed: %s", method, m.Error)
+	}
+
+	return string(m.Result)
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (c *client) send(v interface{}) {
+	c.t.Helper()
+
+	if err := framing.Write(c.in, v); err != nil {
+		c.t.Fatalf("writing message: %s", err)
+	}
+}
+
+// next returns the next notification, waiting for it with a request to a
+// method the server does not know.
+func (c *client) next() *message {
+	c.t.Helper()
+
+	if len(c.notifications) == 0 {
+		c.call("$/sync", nil)
+	}
+	if len(c.notifications) == 0 {
+		c.t.Fatalf("no notification")
+	}
+
+	m := c.notifications[0]
+	c.notifications = c.notifications[1:]
+	return m
+}
+
+func (c *client) open(text string) {
+	c.t.Helper()
+
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, LanguageID: "monkey", Version: 1, Text: text}})
+}
+
+func at(line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{Line: line, Character: character}}
+}
+
+func TestInitialize(t *testing.T) {
+	c := newClient(t)
+
+	got := c.result("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	expected := `{"capabilities":{"textDocumentSync":1,"definitionProvider":true,"referencesProvider":true,"hoverProvider":true,"documentSymbolProvider":true,"completionProvider":{},"documentFormattingProvider":true},"serverInfo":{"name":"monkey"}}`
+	if got != expected {
+		t.Errorf("wrong result.\nexpected=%s\ngot=     %s", expected, got)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := newClient(t)
+
+	c.open(source)
+	if got := string(c.next().Params); got != `{"uri":"file:///test.mk","version":1,"diagnostics":[]}` {
+		t.Errorf("wrong diagnostics of a valid document. got=%s", got)
+	}
+
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 2},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "let x = 1;\nlet 5;"}},
+	})
+	m := c.next()
+	if m.Method != "textDocument/publishDiagnostics" {
+		t.Fatalf("wrong method. expected=textDocument/publishDiagnostics, got=%s", m.Method)
+	}
+	expected := `{"uri":"file:///test.mk","version":2,"diagnostics":[` +
+		`{"range":{"start":{"line":1,"character":4},"end":{"line":1,"character":5}},"severity":1,"source":"monkey",` +
+		`"message":"expected next token to be IDENT, got INT instead at line 2, column 5"}]}`
+	if got := string(m.Params); got != expected {
+		t.Errorf("wrong diagnostics.\nexpected=%s\ngot=     %s", expected, got)
+	}
+
+	c.notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+	if got := string(c.next().Params); got != `{"uri":"file:///test.mk","version":0,"diagnostics":[]}` {
+		t.Errorf("wrong diagnostics of a closed document. got=%s", got)
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	c := newClient(t)
+	c.open(source)
+
+	tests := []struct {
+		method   string
+		params   interface{}
+		expected string
+	}{
+		// x used in f
+		{"textDocument/definition", at(3, 17), `[{"uri":"file:///test.mk","range":{"start":{"line":1,"character":4},"end":{"line":1,"character":5}}}]`},
+		// the parameter b, from the end of its use
+		{"textDocument/definition", at(0, 26), `[{"uri":"file:///test.mk","range":{"start":{"line":0,"character":16},"end":{"line":0,"character":17}}}]`},
+		// not an identifier
+		{"textDocument/definition", at(1, 8), `null`},
+		{
+			"textDocument/references",
+			ReferenceParams{TextDocumentPositionParams: at(2, 11)},
+			`[{"uri":"file:///test.mk","range":{"start":{"line":3,"character":14},"end":{"line":3,"character":15}}}]`,
+		},
+		{
+			"textDocument/references",
+			func() ReferenceParams {
+				p := ReferenceParams{TextDocumentPositionParams: at(6, 0)}
+				p.Context.IncludeDeclaration = true
+				return p
+			}(),
+			`[{"uri":"file:///test.mk","range":{"start":{"line":2,"character":4},"end":{"line":2,"character":5}}},` +
+				`{"uri":"file:///test.mk","range":{"start":{"line":6,"character":0},"end":{"line":6,"character":1}}}]`,
+		},
+	}
+
+	for i, tt := range tests {
+		if got := c.result(tt.method, tt.params); got != tt.expected {
+			t.Errorf("test[%d] %s: wrong result.\nexpected=%s\ngot=     %s", i, tt.method, tt.expected, got)
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	c := newClient(t)
+	c.open(source)
+
+	tests := []struct {
+		position TextDocumentPositionParams
+		expected string
+	}{
+		{at(3, 11), "```monkey\nfn add(a, b)\n```"},
+		{at(3, 14), "```monkey\nparameter n of fn f(n)\n```"},
+		{at(1, 4), "```monkey\nlet x = 5\n```"},
+		{at(0, 11), "```monkey\nfn add(a, b)\n```"},
+	}
+
+	for i, tt := range tests {
+		var hover Hover
+		if err := json.Unmarshal([]byte(c.result("textDocument/hover", tt.position)), &hover); err != nil {
+			t.Fatalf("test[%d]: %s", i, err)
+		}
+		if hover.Contents.Value != tt.expected {
+			t.Errorf("test[%d]: wrong hover. expected=%q, got=%q", i, tt.expected, hover.Contents.Value)
+		}
+	}
+
+	if got := c.result("textDocument/hover", at(5, 0)); got != "null" {
+		t.Errorf("wrong hover outside of identifiers. expected=null, got=%s", got)
+	}
+}
+
+func TestDocumentSymbol(t *testing.T) {
+	c := newClient(t)
+	c.open(source)
+
+	var symbols []DocumentSymbol
+	got := c.result("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+	if err := json.Unmarshal([]byte(got), &symbols); err != nil {
+		t.Fatal(err)
+	}
+
+	var describe func(symbols []DocumentSymbol) string
+	describe = func(symbols []DocumentSymbol) string {
+		s := ""
+		for _, symbol := range symbols {
+			s += symbol.Name + "(" + symbol.Detail + ")"
+			if symbol.Children != nil {
+				s += "{" + describe(symbol.Children) + "}"
+			}
+			s += ";"
+		}
+		return s
+	}
+	if got, expected := describe(symbols), "add(fn add(a, b));x();f(fn f(n)){y();};"; got != expected {
+		t.Errorf("wrong symbols. expected=%q, got=%q", expected, got)
+	}
+
+	f := symbols[2]
+	if f.Kind != SymbolKindFunction || symbols[1].Kind != SymbolKindVariable {
+		t.Errorf("wrong symbol kinds. got=%d, %d", f.Kind, symbols[1].Kind)
+	}
+	if f.Range != (Range{Start: Position{2, 0}, End: Position{5, 1}}) {
+		t.Errorf("wrong range of f. got=%+v", f.Range)
+	}
+	if f.SelectionRange != (Range{Start: Position{2, 4}, End: Position{2, 5}}) {
+		t.Errorf("wrong selection range of f. got=%+v", f.SelectionRange)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	c := newClient(t)
+	c.open(source)
+
+	tests := []struct {
+		position TextDocumentPositionParams
+		expected []string
+	}{
+		// the start of the body of f
+		{at(3, 2), []string{"add", "f", "n", "x", "y", "else", "false", "fn", "if", "let", "return", "true"}},
+		{at(3, 12), []string{"add"}},
+		// parameters and lets of f are not visible outside of it
+		{at(6, 1), []string{"f", "false", "fn"}},
+	}
+
+	for i, tt := range tests {
+		var items []CompletionItem
+		if err := json.Unmarshal([]byte(c.result("textDocument/completion", tt.position)), &items); err != nil {
+			t.Fatalf("test[%d]: %s", i, err)
+		}
+
+		var got []string
+		for _, item := range items {
+			got = append(got, item.Label)
+		}
+		if len(got) != len(tt.expected) {
+			t.Errorf("test[%d]: wrong items. expected=%v, got=%v", i, tt.expected, got)
+			continue
+		}
+		for j := range got {
+			if got[j] != tt.expected[j] {
+				t.Errorf("test[%d]: wrong items. expected=%v, got=%v", i, tt.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	c := newClient(t)
+	params := DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: uri}}
+
+	c.open("let x=1;\nx")
+	expected := `[{"range":{"start":{"line":0,"character":0},"end":{"line":1,"character":1}},"newText":"let x = 1;\nx;\n"}]`
+	if got := c.result("textDocument/formatting", params); got != expected {
+		t.Errorf("wrong edits.\nexpected=%s\ngot=     %s", expected, got)
+	}
+
+	c.open("let x = 1;\nx;\n")
+	if got := c.result("textDocument/formatting", params); got != "[]" {
+		t.Errorf("wrong edits of a formatted document. expected=[], got=%s", got)
+	}
+
+	c.open("let = 1;")
+	if m := c.call("textDocument/formatting", params); m.Error == nil || m.Error.Code != codeRequestFailed {
+		t.Errorf("expected the formatting of an invalid document to fail. got=%+v", m.Error)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c := newClient(t)
+
+	tests := []struct {
+		method string
+		params interface{}
+		code   int
+	}{
+		{"textDocument/rename", at(0, 0), codeMethodNotFound},
+		{"textDocument/hover", at(0, 0), codeInvalidParams},
+		{"textDocument/hover", []int{1}, codeInvalidParams},
+	}
+
+	for i, tt := range tests {
+		m := c.call(tt.method, tt.params)
+		if m.Error == nil || m.Error.Code != tt.code {
+			t.Errorf("test[%d]: wrong error. expected code %d, got=%+v", i, tt.code, m.Error)
+		}
+	}
+
+	// a notification that fails is reported with a message
+	c.notify("textDocument/didOpen", []int{1})
+	if m := c.next(); m.Method != "window/showMessage" {
+		t.Errorf("wrong method. expected=window/showMessage, got=%s", m.Method)
+	}
+
+	// a message that is not JSON is answered with a parse error
+	if _, err := io.WriteString(c.in, "Content-Length: 1\r\n\r\n{"); err != nil {
+		t.Fatalf("writing message: %s", err)
+	}
+	if m := <-c.messages; m == nil || m.Error == nil || m.Error.Code != codeParseError || string(m.ID) != "null" {
+		t.Errorf("wrong response to a malformed message. got=%+v", m)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	c := newClient(t)
+
+	if got := c.result("shutdown", nil); got != "null" {
+		t.Errorf("wrong result. expected=null, got=%s", got)
+	}
+	if m := c.call("textDocument/hover", at(0, 0)); m.Error == nil || m.Error.Code != codeInvalidRequest {
+		t.Errorf("expected requests after shutdown to be invalid. got=%+v", m.Error)
+	}
+
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	c := newClient(t)
+
+	c.notify("exit", nil)
+	if err := <-c.done; err != ErrExitWithoutShutdown {
+		t.Errorf("wrong error. expected=%v, got=%v", ErrExitWithoutShutdown, err)
+	}
+}
@@ -0,0 +1,130 @@
+package mkc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cupsadarius/monkey_interpreter/compiler"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+)
+
+// CachePath returns the path of the compiled file for the source at path.
+func CachePath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".mkc"
+}
+
+type loader struct {
+	warnings io.Writer
+	readOnly bool
+}
+
+type Option func(*loader)
+
+// WithWarnings makes Load report to w why it could not use a compiled file,
+// before it compiles the source instead.
+func WithWarnings(w io.Writer) Option {
+	return func(l *loader) {
+		l.warnings = w
+	}
+}
+
+// ReadOnly keeps Load from writing compiled files.
+func ReadOnly() Option {
+	return func(l *loader) {
+		l.readOnly = true
+	}
+}
+
+// Load returns the compiled program for the source file at path. It uses
+// the file at CachePath(path) if it was compiled from the current source,
+// and otherwise compiles the source and tries to write that file for the
+// next time. Failing to read or write it is not an error.
+func Load(path string, opts ...Option) (*compiler.Bytecode, error) {
+	l := &loader{}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := Hash(source)
+	cachePath := CachePath(path)
+
+	f, err := readFile(cachePath)
+	switch {
+	case err == nil && f.SourceHash == hash:
+		return f.Bytecode, nil
+	case err != nil && !errors.Is(err, fs.ErrNotExist) && l.warnings != nil:
+		fmt.Fprintf(l.warnings, "%s: %s; compiling %s instead\n", cachePath, err, path)
+	}
+
+	bytecode, err := compile(path, source)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.readOnly {
+		return bytecode, nil
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, &File{SourceHash: hash, Bytecode: bytecode}); err == nil {
+		writeFile(cachePath, buf.Bytes())
+	}
+
+	return bytecode, nil
+}
+
+func readFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Read(data)
+}
+
+func compile(path string, source []byte) (*compiler.Bytecode, error) {
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s: parse error: %s", path, strings.Join(p.Errors(), "; "))
+	}
+
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return c.Bytecode(), nil
+}
+
+// writeFile replaces the file at path with data without ever leaving a
+// partially written file behind.
+func writeFile(path string, data []byte) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return
+	}
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
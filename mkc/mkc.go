@@ -0,0 +1,347 @@
+// Package mkc reads and writes compiled Monkey programs. A .mkc file is
+// written next to the .mk file it was compiled from and carries the hash of
+// that source, so that it is only used as long as the source is unchanged.
+//
+// A file starts with the magic "MKC", a format version and the SHA-256
+// hash of the source, followed by the global names, the constant pool and
+// the top-level instructions with their source map. Integers are encoded as
+// varints, strings and byte slices are prefixed by their length.
+package mkc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/cupsadarius/monkey_interpreter/code"
+	"github.com/cupsadarius/monkey_interpreter/compiler"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+// Version is the version of the format written by this package. It has to
+// be increased whenever the format or the instruction set changes.
+const Version = 1
+
+var magic = []byte("MKC")
+
+const (
+	tagInteger byte = iota + 1
+	tagFloat
+	tagString
+	tagFunction
+)
+
+var ErrNotCompiled = errors.New("mkc: not a compiled Monkey program")
+
+// VersionError is returned when a file has been written by a different
+// version of the format.
+type VersionError struct {
+	Version uint64
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("mkc: unsupported format version %d, this build reads version %d", e.Version, Version)
+}
+
+// File is the content of a .mkc file.
+type File struct {
+	SourceHash [sha256.Size]byte
+	Bytecode   *compiler.Bytecode
+}
+
+// Hash returns the hash identifying source.
+func Hash(source []byte) [sha256.Size]byte {
+	return sha256.Sum256(source)
+}
+
+// Write encodes f to w.
+func Write(w io.Writer, f *File) error {
+	e := &encoder{}
+
+	e.buf.Write(magic)
+	e.uint(Version)
+	e.buf.Write(f.SourceHash[:])
+
+	e.uint(uint64(len(f.Bytecode.GlobalNames)))
+	for _, name := range f.Bytecode.GlobalNames {
+		e.string(name)
+	}
+
+	e.uint(uint64(len(f.Bytecode.Constants)))
+	for i, constant := range f.Bytecode.Constants {
+		if err := e.constant(constant); err != nil {
+			return fmt.Errorf("mkc: constant %d: %w", i, err)
+		}
+	}
+
+	e.bytes(f.Bytecode.Instructions)
+	e.sourceMap(f.Bytecode.SourceMap)
+
+	_, err := w.Write(e.buf.Bytes())
+	return err
+}
+
+// Read decodes a file. Files that are corrupt or truncated result in an
+// error; they never make Read, or a VM running the bytecode read, panic.
+func Read(data []byte) (*File, error) {
+	d := &decoder{data: data}
+
+	if !bytes.HasPrefix(data, magic) {
+		return nil, ErrNotCompiled
+	}
+	d.pos = len(magic)
+
+	if version := d.uint(); d.err == nil && version != Version {
+		return nil, &VersionError{Version: version}
+	}
+
+	f := &File{Bytecode: &compiler.Bytecode{}}
+	copy(f.SourceHash[:], d.take(sha256.Size))
+
+	names := d.count()
+	for i := 0; i < names && d.err == nil; i++ {
+		f.Bytecode.GlobalNames = append(f.Bytecode.GlobalNames, d.string())
+	}
+
+	constants := d.count()
+	for i := 0; i < constants && d.err == nil; i++ {
+		f.Bytecode.Constants = append(f.Bytecode.Constants, d.constant())
+	}
+
+	f.Bytecode.Instructions = d.bytes()
+	f.Bytecode.SourceMap = d.sourceMap()
+
+	if d.err == nil && d.pos != len(d.data) {
+		d.fail("trailing data")
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	if err := verify(f.Bytecode); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) uint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (e *encoder) int(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint(uint64(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *encoder) string(s string) {
+	e.bytes([]byte(s))
+}
+
+func (e *encoder) sourceMap(sm code.SourceMap) {
+	e.uint(uint64(len(sm)))
+	for _, pos := range sm {
+		e.uint(uint64(pos.Offset))
+		e.int(int64(pos.Line))
+		e.int(int64(pos.Column))
+	}
+}
+
+func (e *encoder) constant(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.buf.WriteByte(tagInteger)
+		e.int(obj.Value)
+	case *object.Float:
+		e.buf.WriteByte(tagFloat)
+		e.uint(math.Float64bits(obj.Value))
+	case *object.String:
+		e.buf.WriteByte(tagString)
+		e.string(obj.Value)
+	case *object.CompiledFunction:
+		e.buf.WriteByte(tagFunction)
+		e.uint(uint64(obj.NumLocals))
+		e.uint(uint64(obj.NumParameters))
+		e.uint(uint64(len(obj.LocalNames)))
+		for _, name := range obj.LocalNames {
+			e.string(name)
+		}
+		e.bytes(obj.Instructions)
+		e.sourceMap(obj.SourceMap)
+	default:
+		return fmt.Errorf("cannot encode %s", obj.Type())
+	}
+
+	return nil
+}
+
+// decoder reads values from data until the first error, after which every
+// read returns a zero value.
+type decoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("mkc: corrupt file at byte %d: %s", d.pos, fmt.Sprintf(format, a...))
+	}
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data)-d.pos {
+		d.fail("unexpected end of file")
+		return nil
+	}
+
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+
+	return b
+}
+
+func (d *decoder) byte() byte {
+	b := d.take(1)
+	if b == nil {
+		return 0
+	}
+
+	return b[0]
+}
+
+func (d *decoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("invalid varint")
+		return 0
+	}
+	d.pos += n
+
+	return v
+}
+
+func (d *decoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Varint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("invalid varint")
+		return 0
+	}
+	d.pos += n
+
+	return v
+}
+
+// count reads the length of a sequence. Every element takes at least one
+// byte, so lengths beyond the rest of the file are rejected before anything
+// is allocated for them.
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > uint64(len(d.data)-d.pos) {
+		d.fail("length %d exceeds file size", n)
+		return 0
+	}
+
+	return int(n)
+}
+
+// small reads a non-negative number that has to fit an int comfortably.
+func (d *decoder) small() int {
+	n := d.uint()
+	if n > math.MaxInt32 {
+		d.fail("number %d out of range", n)
+		return 0
+	}
+
+	return int(n)
+}
+
+// position reads a line or column, which may be negative for tokens the
+// lexer could not place.
+func (d *decoder) position() int {
+	n := d.int()
+	if n < math.MinInt32 || n > math.MaxInt32 {
+		d.fail("position %d out of range", n)
+		return 0
+	}
+
+	return int(n)
+}
+
+func (d *decoder) bytes() []byte {
+	b := d.take(d.count())
+	if b == nil {
+		return nil
+	}
+
+	out := make([]byte, len(b))
+	copy(out, b)
+
+	return out
+}
+
+func (d *decoder) string() string {
+	return string(d.take(d.count()))
+}
+
+func (d *decoder) sourceMap() code.SourceMap {
+	n := d.count()
+	if n == 0 {
+		return nil
+	}
+
+	sm := make(code.SourceMap, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		sm = append(sm, code.SourcePosition{Offset: d.small(), Line: d.position(), Column: d.position()})
+	}
+
+	return sm
+}
+
+func (d *decoder) constant() object.Object {
+	switch tag := d.byte(); tag {
+	case tagInteger:
+		return object.NewInteger(d.int())
+	case tagFloat:
+		return &object.Float{Value: math.Float64frombits(d.uint())}
+	case tagString:
+		return &object.String{Value: d.string()}
+	case tagFunction:
+		fn := &object.CompiledFunction{NumLocals: d.small(), NumParameters: d.small()}
+		names := d.count()
+		for i := 0; i < names && d.err == nil; i++ {
+			fn.LocalNames = append(fn.LocalNames, d.string())
+		}
+		fn.Instructions = d.bytes()
+		fn.SourceMap = d.sourceMap()
+		return fn
+	default:
+		d.fail("unknown constant tag %d", tag)
+		return nil
+	}
+}
@@ -0,0 +1,319 @@
+package mkc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/code"
+	"github.com/cupsadarius/monkey_interpreter/compiler"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/internal/enginetest"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+	"github.com/cupsadarius/monkey_interpreter/vm"
+)
+
+func compileSource(t testing.TB, source string) *compiler.Bytecode {
+	t.Helper()
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return c.Bytecode()
+}
+
+func encode(t testing.TB, source string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	f := &File{SourceHash: Hash([]byte(source)), Bytecode: compileSource(t, source)}
+	if err := Write(&buf, f); err != nil {
+		t.Fatalf("write failed: %s", err)
+	}
+
+	return buf.Bytes()
+}
+
+func run(bytecode *compiler.Bytecode) (object.Object, error) {
+	machine := vm.New(bytecode)
+	if err := machine.Run(); err != nil {
+		return nil, err
+	}
+
+	return machine.Result(), nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, input := range enginetest.Inputs {
+		f, err := Read(encode(t, input))
+		if err != nil {
+			t.Errorf("%q: read failed: %s", input, err)
+			continue
+		}
+
+		if f.SourceHash != Hash([]byte(input)) {
+			t.Errorf("%q: wrong source hash", input)
+		}
+
+		expected, _ := run(compileSource(t, input))
+		got, err := run(f.Bytecode)
+		if err != nil {
+			t.Errorf("%q: vm error: %s", input, err)
+			continue
+		}
+		if !enginetest.Equal(expected, got) {
+			t.Errorf("%q: results differ. expected=%v, got=%v", input, expected, got)
+		}
+	}
+}
+
+func TestSourceMapsSurvive(t *testing.T) {
+	source := "let f = fn(x) {\n  x + 1;\n};\nf(1);"
+	original := compileSource(t, source)
+
+	f, err := Read(encode(t, source))
+	if err != nil {
+		t.Fatalf("read failed: %s", err)
+	}
+
+	if len(f.Bytecode.SourceMap) == 0 || len(f.Bytecode.SourceMap) != len(original.SourceMap) {
+		t.Fatalf("wrong source map. expected=%v, got=%v", original.SourceMap, f.Bytecode.SourceMap)
+	}
+	for i := range original.SourceMap {
+		if original.SourceMap[i] != f.Bytecode.SourceMap[i] {
+			t.Errorf("wrong position %d. expected=%v, got=%v", i, original.SourceMap[i], f.Bytecode.SourceMap[i])
+		}
+	}
+
+	fn := f.Bytecode.Constants[1].(*object.CompiledFunction)
+	if pos, ok := fn.SourceMap.Lookup(0); !ok || pos.Line != 2 {
+		t.Errorf("wrong position of function body. got=%+v", pos)
+	}
+}
+
+func TestVersionMismatch(t *testing.T) {
+	data := encode(t, "1 + 2")
+	data[len(magic)] = Version + 1
+
+	_, err := Read(data)
+	var versionErr *VersionError
+	if !errors.As(err, &versionErr) {
+		t.Fatalf("expected a *VersionError. got=%T (%v)", err, err)
+	}
+	if versionErr.Version != Version+1 {
+		t.Errorf("wrong version. got=%d", versionErr.Version)
+	}
+	if !strings.Contains(err.Error(), "unsupported format version") {
+		t.Errorf("unclear error message: %q", err)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	valid := encode(t, "let a = fn(x) { x }; a(1);")
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"empty", nil, "not a compiled Monkey program"},
+		{"source", []byte("let a = 1;"), "not a compiled Monkey program"},
+		{"truncated", valid[:len(valid)-3], "corrupt file"},
+		{"trailing", append(append([]byte{}, valid...), 0), "trailing data"},
+	}
+
+	for _, tt := range tests {
+		_, err := Read(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: wrong error. expected=%q, got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	function := &object.CompiledFunction{
+		Instructions: concat(code.Make(code.OpGetLocal, 0), code.Make(code.OpReturnValue)),
+		NumLocals:    1,
+	}
+
+	tests := []struct {
+		name         string
+		instructions code.Instructions
+		expected     string
+	}{
+		{"valid", concat(code.Make(code.OpClosure, 1), code.Make(code.OpConstant, 0), code.Make(code.OpCall, 1), code.Make(code.OpPop)), ""},
+		{"underflow", concat(code.Make(code.OpPop)), "stack underflow"},
+		{"call underflow", concat(code.Make(code.OpConstant, 0), code.Make(code.OpCall, 1)), "stack underflow"},
+		{"constant", concat(code.Make(code.OpConstant, 7)), "constant 7 out of range"},
+		{"closure", concat(code.Make(code.OpClosure, 0)), "not a function"},
+		{"local in main", concat(code.Make(code.OpGetLocal, 0)), "local 0 out of range"},
+		{"backwards", concat(code.Make(code.OpTrue), code.Make(code.OpJump, 0)), "jump backwards"},
+		{"mid instruction", concat(code.Make(code.OpJump, 4), code.Make(code.OpConstant, 0)), "middle of an instruction"},
+		{"truncated", code.Make(code.OpConstant, 0)[:2], "truncated"},
+		{"unknown opcode", code.Instructions{255}, "undefined"},
+		{"heights", concat(
+			code.Make(code.OpTrue),
+			code.Make(code.OpJumpNotTruthy, 6),
+			code.Make(code.OpTrue),
+			code.Make(code.OpTrue),
+			code.Make(code.OpPop),
+		), "inconsistent stack height"},
+	}
+
+	for _, tt := range tests {
+		err := verify(&compiler.Bytecode{
+			Instructions: tt.instructions,
+			Constants:    []object.Object{object.NewInteger(1), function},
+		})
+
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: wrong error. expected=%q, got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "script.mk")
+
+	write := func(source string) {
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	load := func() string {
+		bytecode, err := Load(path)
+		if err != nil {
+			t.Fatalf("load failed: %s", err)
+		}
+		result, err := run(bytecode)
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		return result.Inspect()
+	}
+
+	write("let a = 20; a + 1;")
+	if got := load(); got != "21" {
+		t.Errorf("wrong result. got=%s", got)
+	}
+
+	cached, err := os.ReadFile(CachePath(path))
+	if err != nil {
+		t.Fatalf("no cache file written: %s", err)
+	}
+	if f, err := Read(cached); err != nil || f.SourceHash != Hash([]byte("let a = 20; a + 1;")) {
+		t.Fatalf("wrong cache file: %v", err)
+	}
+
+	// the cache is used as long as the source is unchanged
+	var buf bytes.Buffer
+	Write(&buf, &File{SourceHash: Hash([]byte("let a = 20; a + 1;")), Bytecode: compileSource(t, "99")})
+	os.WriteFile(CachePath(path), buf.Bytes(), 0o644)
+	if got := load(); got != "99" {
+		t.Errorf("cache not used. got=%s", got)
+	}
+
+	// and recompiled once it changes
+	write("let a = 20; a + 2;")
+	if got := load(); got != "22" {
+		t.Errorf("stale cache used. got=%s", got)
+	}
+
+	os.WriteFile(CachePath(path), []byte("MKC garbage"), 0o644)
+	if got := load(); got != "22" {
+		t.Errorf("corrupt cache not replaced. got=%s", got)
+	}
+
+	// files that cannot be used are reported before compiling the source
+	data, _ := os.ReadFile(CachePath(path))
+	data[len(magic)]++
+	os.WriteFile(CachePath(path), data, 0o644)
+	var warnings bytes.Buffer
+	if _, err := Load(path, WithWarnings(&warnings), ReadOnly()); err != nil {
+		t.Fatalf("load failed: %s", err)
+	}
+	if !strings.Contains(warnings.String(), "unsupported format version") {
+		t.Errorf("version error not reported. got=%q", warnings.String())
+	}
+
+	// without replacing them when read-only
+	if cached, _ := os.ReadFile(CachePath(path)); !bytes.Equal(cached, data) {
+		t.Errorf("cache written by a read-only load")
+	}
+	os.Remove(CachePath(path))
+	if _, err := Load(path, ReadOnly()); err != nil {
+		t.Fatalf("load failed: %s", err)
+	}
+	if _, err := os.Stat(CachePath(path)); !os.IsNotExist(err) {
+		t.Errorf("cache written by a read-only load. stat=%v", err)
+	}
+	warnings.Reset()
+	Load(path, WithWarnings(&warnings))
+	if warnings.Len() != 0 {
+		t.Errorf("missing cache reported. got=%q", warnings.String())
+	}
+
+	write("let a = ;")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "parse error") {
+		t.Errorf("expected a parse error. got=%v", err)
+	}
+}
+
+func FuzzRead(f *testing.F) {
+	for _, input := range enginetest.Inputs {
+		f.Add(encode(f, input))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		file, err := Read(data)
+		if err != nil {
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := Write(&buf, file); err != nil {
+			t.Fatalf("cannot write what was read: %s", err)
+		}
+		if _, err := Read(buf.Bytes()); err != nil {
+			t.Fatalf("cannot read what was written: %s", err)
+		}
+
+		runBounded(file.Bytecode, 10000)
+	})
+}
+
+// runBounded runs bytecode for at most steps instructions; bytecode read
+// from a file may well recurse without end.
+func runBounded(bytecode *compiler.Bytecode, steps int64) {
+	vm.New(bytecode).RunContext(context.Background(), evaluator.Limits{MaxSteps: steps})
+}
+
+func concat(instructions ...code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+
+	return out
+}
@@ -0,0 +1,188 @@
+package mkc
+
+import (
+	"fmt"
+
+	"github.com/cupsadarius/monkey_interpreter/code"
+	"github.com/cupsadarius/monkey_interpreter/compiler"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+// verify checks that bytecode read from a file is something the compiler
+// could have produced, as far as the VM relies on it: every instruction is
+// complete, operands refer to existing constants and locals, jumps land on
+// instructions further down, and no instruction takes more values from
+// the stack than the code before it has pushed.
+func verify(bytecode *compiler.Bytecode) error {
+	if err := verifyInstructions(bytecode.Instructions, 0, bytecode.Constants); err != nil {
+		return fmt.Errorf("mkc: invalid main program: %w", err)
+	}
+
+	for i, constant := range bytecode.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		if fn.NumParameters > fn.NumLocals || fn.NumLocals > 256 {
+			return fmt.Errorf("mkc: invalid function %d: %d parameters, %d locals", i, fn.NumParameters, fn.NumLocals)
+		}
+		if err := verifyInstructions(fn.Instructions, fn.NumLocals, bytecode.Constants); err != nil {
+			return fmt.Errorf("mkc: invalid function %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// stackEffect returns how many values an instruction pops and pushes.
+func stackEffect(op code.Opcode, operands []int) (pops, pushes int) {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull,
+		code.OpGetGlobal, code.OpGetLocal, code.OpGetFree, code.OpClosure, code.OpUndefined:
+		return 0, 1
+	case code.OpPop, code.OpJumpNotTruthy, code.OpSetGlobal, code.OpSetLocal, code.OpReturnValue:
+		return 1, 0
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+		code.OpEqual, code.OpNotEqual,
+		code.OpGreaterThan, code.OpGreaterEqual, code.OpLessThan, code.OpLessEqual:
+		return 2, 1
+	case code.OpMinus, code.OpBang, code.OpGetMember:
+		return 1, 1
+	case code.OpCall:
+		return operands[0] + 1, 1
+	}
+
+	return 0, 0
+}
+
+func verifyInstructions(ins code.Instructions, numLocals int, constants []object.Object) error {
+	type instruction struct {
+		op       code.Opcode
+		operands []int
+		next     int
+	}
+
+	decoded := map[int]instruction{}
+	for offset := 0; offset < len(ins); {
+		def, err := code.Lookup(ins[offset])
+		if err != nil {
+			return fmt.Errorf("offset %d: %w", offset, err)
+		}
+
+		width := 1
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if offset+width > len(ins) {
+			return fmt.Errorf("offset %d: truncated %s", offset, def.Name)
+		}
+
+		operands, _ := code.ReadOperands(def, ins[offset+1:])
+		op := code.Opcode(ins[offset])
+		if err := verifyOperands(op, operands, numLocals, constants); err != nil {
+			return fmt.Errorf("offset %d: %s: %w", offset, def.Name, err)
+		}
+
+		decoded[offset] = instruction{op: op, operands: operands, next: offset + width}
+		offset += width
+	}
+
+	// follow every path through the code, tracking the height of the stack
+	heights := map[int]int{}
+	work := []int{0}
+	heights[0] = 0
+
+	for len(work) > 0 {
+		offset := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		for offset < len(ins) {
+			in := decoded[offset]
+			height := heights[offset]
+
+			pops, pushes := stackEffect(in.op, in.operands)
+			if height < pops {
+				return fmt.Errorf("offset %d: stack underflow", offset)
+			}
+			height += pushes - pops
+
+			if in.op == code.OpReturnValue || in.op == code.OpReturn {
+				break
+			}
+
+			var targets []int
+			switch in.op {
+			case code.OpJump:
+				targets = []int{in.operands[0]}
+			case code.OpJumpNotTruthy:
+				targets = []int{in.next, in.operands[0]}
+			default:
+				targets = []int{in.next}
+			}
+
+			next := -1
+			for _, target := range targets {
+				if target <= offset {
+					return fmt.Errorf("offset %d: jump backwards to %d", offset, target)
+				}
+				if _, ok := decoded[target]; !ok && target != len(ins) {
+					return fmt.Errorf("offset %d: jump into the middle of an instruction", offset)
+				}
+
+				if known, ok := heights[target]; ok {
+					if known != height {
+						return fmt.Errorf("offset %d: inconsistent stack height", target)
+					}
+					continue
+				}
+
+				heights[target] = height
+				if next == -1 {
+					next = target
+				} else {
+					work = append(work, target)
+				}
+			}
+
+			if next == -1 {
+				break
+			}
+			offset = next
+		}
+	}
+
+	return nil
+}
+
+func verifyOperands(op code.Opcode, operands []int, numLocals int, constants []object.Object) error {
+	constant := func(index int) error {
+		if index >= len(constants) {
+			return fmt.Errorf("constant %d out of range", index)
+		}
+		return nil
+	}
+
+	switch op {
+	case code.OpConstant, code.OpGetMember, code.OpUndefined:
+		return constant(operands[0])
+	case code.OpClosure:
+		if err := constant(operands[0]); err != nil {
+			return err
+		}
+		if _, ok := constants[operands[0]].(*object.CompiledFunction); !ok {
+			return fmt.Errorf("constant %d is not a function", operands[0])
+		}
+	case code.OpGetLocal, code.OpSetLocal:
+		if operands[0] >= numLocals {
+			return fmt.Errorf("local %d out of range", operands[0])
+		}
+	case code.OpGetFree:
+		if operands[0] == 0 {
+			return fmt.Errorf("free variable at depth 0")
+		}
+		return constant(operands[2])
+	}
+
+	return nil
+}
@@ -0,0 +1,394 @@
+package object
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+var (
+	objectType  = reflect.TypeOf((*Object)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
+// FromGo converts a Go value into its Monkey representation.
+//
+// Booleans, integers, floats and strings map onto the matching primitive
+// objects, slices and arrays onto *Array, maps onto *Hash, functions onto
+// *Builtin and structs, or pointers to them, onto *GoValue. Values that
+// already are an Object are returned unchanged. Functions whose first
+// parameter is a context.Context are handed the context of the evaluation
+// calling them.
+func FromGo(value interface{}) (Object, error) {
+	if value == nil {
+		return NULL, nil
+	}
+
+	if obj, ok := value.(Object); ok {
+		return obj, nil
+	}
+
+	switch value := value.(type) {
+	case bool:
+		return NativeBoolToBoolean(value), nil
+	case int:
+		return NewInteger(int64(value)), nil
+	case int64:
+		return NewInteger(value), nil
+	case float64:
+		return &Float{Value: value}, nil
+	case string:
+		return &String{Value: value}, nil
+	case BuiltinFunction:
+		return &Builtin{Fn: value}, nil
+	case func(args ...Object) Object:
+		return &Builtin{Fn: value}, nil
+	}
+
+	return fromValue(reflect.ValueOf(value))
+}
+
+func fromValue(v reflect.Value) (Object, error) {
+	if !v.IsValid() {
+		return NULL, nil
+	}
+
+	if v.Type().Implements(objectType) {
+		if v.Kind() == reflect.Interface && v.IsNil() {
+			return NULL, nil
+		}
+		return v.Interface().(Object), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return NativeBoolToBoolean(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewInteger(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows INTEGER", v.Uint())
+		}
+		return NewInteger(int64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return fromValue(v.Elem())
+	case reflect.Ptr:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		if v.Elem().Kind() == reflect.Struct {
+			return &GoValue{Value: v}, nil
+		}
+		return fromValue(v.Elem())
+	case reflect.Struct:
+		return &GoValue{Value: v}, nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return arrayFromValue(v)
+	case reflect.Array:
+		return arrayFromValue(v)
+	case reflect.Map:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return hashFromValue(v)
+	case reflect.Func:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return builtinFromValue("", v), nil
+	}
+
+	return nil, fmt.Errorf("cannot convert Go value of type %s", v.Type())
+}
+
+func arrayFromValue(v reflect.Value) (Object, error) {
+	elements := make([]Object, v.Len())
+
+	for i := range elements {
+		element, err := fromValue(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		elements[i] = element
+	}
+
+	return &Array{Elements: elements}, nil
+}
+
+func hashFromValue(v reflect.Value) (Object, error) {
+	pairs := make(map[HashKey]HashPair, v.Len())
+
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := fromValue(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+
+		hashable, ok := key.(Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		value, err := fromValue(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+
+		pairs[hashable.HashKey()] = HashPair{Key: key, Value: value}
+	}
+
+	return &Hash{Pairs: pairs}, nil
+}
+
+// builtinFromValue wraps an arbitrary Go function into a builtin. Arguments
+// are converted to the parameter types of fn and its results back into
+// objects. A non-nil error returned as the last result becomes an *Error.
+func builtinFromValue(name string, fn reflect.Value) *Builtin {
+	fnType := fn.Type()
+
+	if fnType.NumIn() > 0 && fnType.In(0) == contextType {
+		call := func(ctx context.Context, args ...Object) Object {
+			in, err := convertArguments(fnType, 1, args)
+			if err != nil {
+				return &Error{Message: err.Error()}
+			}
+
+			return convertResults(fnType, fn.Call(append([]reflect.Value{reflect.ValueOf(&ctx).Elem()}, in...)))
+		}
+
+		return &Builtin{Name: name, FnContext: call, Fn: func(args ...Object) Object {
+			return call(context.Background(), args...)
+		}}
+	}
+
+	return &Builtin{Name: name, Fn: func(args ...Object) Object {
+		in, err := convertArguments(fnType, 0, args)
+		if err != nil {
+			return &Error{Message: err.Error()}
+		}
+
+		return convertResults(fnType, fn.Call(in))
+	}}
+}
+
+// convertArguments converts args to the parameters of fnType following the
+// first skip ones.
+func convertArguments(fnType reflect.Type, skip int, args []Object) ([]reflect.Value, error) {
+	numIn := fnType.NumIn() - skip
+
+	if fnType.IsVariadic() {
+		if len(args) < numIn-1 {
+			return nil, fmt.Errorf("wrong number of arguments. got=%d, want at least %d", len(args), numIn-1)
+		}
+	} else if len(args) != numIn {
+		return nil, fmt.Errorf("wrong number of arguments. got=%d, want=%d", len(args), numIn)
+	}
+
+	in := make([]reflect.Value, len(args))
+
+	for i, arg := range args {
+		var paramType reflect.Type
+
+		if fnType.IsVariadic() && i >= numIn-1 {
+			paramType = fnType.In(skip + numIn - 1).Elem()
+		} else {
+			paramType = fnType.In(skip + i)
+		}
+
+		value, err := ToGoType(arg, paramType)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %s", i+1, err)
+		}
+		in[i] = value
+	}
+
+	return in, nil
+}
+
+func convertResults(fnType reflect.Type, out []reflect.Value) Object {
+	if len(out) > 0 && fnType.Out(len(out)-1) == errorType {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			// the error of a call back into Monkey is raised again as is
+			var errObj *Error
+			if errors.As(err, &errObj) {
+				return errObj
+			}
+			return &Error{Message: err.Error()}
+		}
+		out = out[:len(out)-1]
+	}
+
+	switch len(out) {
+	case 0:
+		return NULL
+	case 1:
+		return resultObject(out[0])
+	}
+
+	elements := make([]Object, len(out))
+	for i, value := range out {
+		elements[i] = resultObject(value)
+	}
+
+	return &Array{Elements: elements}
+}
+
+func resultObject(value reflect.Value) Object {
+	obj, err := fromValue(value)
+	if err != nil {
+		return &Error{Message: err.Error()}
+	}
+
+	return obj
+}
+
+// ToGo converts obj into a plain Go value: *Integer becomes int64, *Float
+// float64, *String string, *Boolean bool, *Null nil, *Array []interface{}
+// and *Hash map[interface{}]interface{}, while a *GoValue is unwrapped again.
+// Objects without a Go counterpart, such as functions, are returned unchanged.
+func ToGo(obj Object) interface{} {
+	switch obj := obj.(type) {
+	case nil, *Null:
+		return nil
+	case *Integer:
+		return obj.Value
+	case *Float:
+		return obj.Value
+	case *String:
+		return obj.Value
+	case *Boolean:
+		return obj.Value
+	case *Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, e := range obj.Elements {
+			elements[i] = ToGo(e)
+		}
+		return elements
+	case *Hash:
+		pairs := make(map[interface{}]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			pairs[ToGo(pair.Key)] = ToGo(pair.Value)
+		}
+		return pairs
+	case *GoValue:
+		if obj.Value.CanInterface() {
+			return obj.Value.Interface()
+		}
+	}
+
+	return obj
+}
+
+// ToGoType converts obj into a Go value of type t.
+func ToGoType(obj Object, t reflect.Type) (reflect.Value, error) {
+	if obj == nil {
+		return reflect.Zero(t), nil
+	}
+
+	if t.Implements(objectType) {
+		if !reflect.TypeOf(obj).AssignableTo(t) {
+			return reflect.Value{}, fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+		}
+		return reflect.ValueOf(obj), nil
+	}
+
+	if g, ok := obj.(*GoValue); ok && g.Value.Type().AssignableTo(t) {
+		return g.Value, nil
+	}
+
+	if obj == NULL {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Slice, reflect.Map, reflect.Func:
+			return reflect.Zero(t), nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		value := ToGo(obj)
+		if value == nil {
+			return reflect.Zero(t), nil
+		}
+		if !reflect.TypeOf(value).AssignableTo(t) {
+			return reflect.Value{}, fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+		}
+		return reflect.ValueOf(value).Convert(t), nil
+	case reflect.Bool:
+		if b, ok := obj.(*Boolean); ok {
+			return reflect.ValueOf(b.Value).Convert(t), nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := obj.(*Integer); ok {
+			v := reflect.New(t).Elem()
+			if v.OverflowInt(i.Value) {
+				return reflect.Value{}, fmt.Errorf("%d overflows %s", i.Value, t)
+			}
+			v.SetInt(i.Value)
+			return v, nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if i, ok := obj.(*Integer); ok {
+			v := reflect.New(t).Elem()
+			if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+				return reflect.Value{}, fmt.Errorf("%d overflows %s", i.Value, t)
+			}
+			v.SetUint(uint64(i.Value))
+			return v, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		switch n := obj.(type) {
+		case *Float:
+			return reflect.ValueOf(n.Value).Convert(t), nil
+		case *Integer:
+			return reflect.ValueOf(float64(n.Value)).Convert(t), nil
+		}
+	case reflect.String:
+		if s, ok := obj.(*String); ok {
+			return reflect.ValueOf(s.Value).Convert(t), nil
+		}
+	case reflect.Slice:
+		if a, ok := obj.(*Array); ok {
+			v := reflect.MakeSlice(t, len(a.Elements), len(a.Elements))
+			for i, e := range a.Elements {
+				element, err := ToGoType(e, t.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				v.Index(i).Set(element)
+			}
+			return v, nil
+		}
+	case reflect.Map:
+		if h, ok := obj.(*Hash); ok {
+			v := reflect.MakeMapWithSize(t, len(h.Pairs))
+			for _, pair := range h.Pairs {
+				key, err := ToGoType(pair.Key, t.Key())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				value, err := ToGoType(pair.Value, t.Elem())
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				v.SetMapIndex(key, value)
+			}
+			return v, nil
+		}
+	}
+
+	return reflect.Value{}, fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+}
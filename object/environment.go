@@ -1,6 +1,12 @@
 package object
 
+import (
+	"sort"
+	"sync"
+)
+
 type Environment struct {
+	mu    sync.RWMutex
 	store map[string]Object
 	outer *Environment
 }
@@ -19,15 +25,40 @@ func NewEnvironment() *Environment {
 }
 
 func (e *Environment) Set(key string, val Object) Object {
+	e.mu.Lock()
 	e.store[key] = val
+	e.mu.Unlock()
 
 	return val
 }
 
 func (e *Environment) Get(key string) (Object, bool) {
+	e.mu.RLock()
 	obj, ok := e.store[key]
+	e.mu.RUnlock()
+
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(key)
 	}
 	return obj, ok
 }
+
+// Outer returns the environment e is enclosed in, or nil.
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// Names returns the sorted names of the variables defined in e itself,
+// leaving out those of the environments it is enclosed in.
+func (e *Environment) Names() []string {
+	e.mu.RLock()
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	e.mu.RUnlock()
+
+	sort.Strings(names)
+
+	return names
+}
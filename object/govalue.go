@@ -0,0 +1,61 @@
+package object
+
+import (
+	"fmt"
+	"reflect"
+)
+
+const GO_VALUE_OBJ = "GO_VALUE"
+
+// MemberGetter is implemented by objects whose members scripts can read with
+// the member access syntax, obj.name.
+type MemberGetter interface {
+	GetMember(name string) Object
+}
+
+// GoValue exposes a Go struct, or a pointer to one, to scripts. Exported
+// fields can be read and exported methods called by name; arguments and
+// results are converted like they are for builtins.
+type GoValue struct {
+	Value reflect.Value
+}
+
+func NewGoValue(value interface{}) *GoValue {
+	return &GoValue{Value: reflect.ValueOf(value)}
+}
+
+func (g *GoValue) Inspect() string {
+	if !g.Value.CanInterface() {
+		return g.Value.Type().String()
+	}
+
+	return fmt.Sprintf("%+v", g.Value.Interface())
+}
+func (g *GoValue) Type() ObjectType { return GO_VALUE_OBJ }
+
+func (g *GoValue) GetMember(name string) Object {
+	if method := g.Value.MethodByName(name); method.IsValid() {
+		return builtinFromValue(name, method)
+	}
+
+	value := g.Value
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return &Error{Message: fmt.Sprintf("nil %s has no member %s", g.Value.Type(), name)}
+		}
+		value = value.Elem()
+	}
+
+	if value.Kind() == reflect.Struct {
+		if field, ok := value.Type().FieldByName(name); ok && field.IsExported() {
+			// fields promoted from embedded pointers may be out of reach
+			fieldValue, err := value.FieldByIndexErr(field.Index)
+			if err != nil {
+				return &Error{Message: fmt.Sprintf("member %s of %s is in a nil embedded struct", name, g.Value.Type())}
+			}
+			return resultObject(fieldValue)
+		}
+	}
+
+	return &Error{Message: fmt.Sprintf("unknown member %s on %s", name, g.Value.Type())}
+}
@@ -2,10 +2,14 @@ package object
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"hash/fnv"
+	"sort"
 	"strings"
 
 	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/code"
 )
 
 type ObjectType string
@@ -24,8 +28,25 @@ const (
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	STRING_OBJ       = "STRING"
+	BUILTIN_OBJ      = "BUILTIN"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
 )
 
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+func NativeBoolToBoolean(input bool) *Boolean {
+	if input {
+		return TRUE
+	}
+
+	return FALSE
+}
+
 type Integer struct {
 	Value int64
 }
@@ -33,6 +54,46 @@ type Integer struct {
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 
+// Integers in [minSmallInteger, maxSmallInteger] are interned, so that the
+// most common values are never allocated.
+const (
+	minSmallInteger = -128
+	maxSmallInteger = 1023
+)
+
+var smallIntegers = func() []Integer {
+	integers := make([]Integer, maxSmallInteger-minSmallInteger+1)
+	for i := range integers {
+		integers[i].Value = int64(i + minSmallInteger)
+	}
+
+	return integers
+}()
+
+// NewInteger returns an Integer holding value, which is shared for small
+// values. Integers are immutable, so sharing them is safe.
+func NewInteger(value int64) *Integer {
+	if value >= minSmallInteger && value <= maxSmallInteger {
+		return &smallIntegers[value-minSmallInteger]
+	}
+
+	return &Integer{Value: value}
+}
+
+// Interned reports whether obj is one of the shared objects that are never
+// allocated: null, the booleans and the small integers.
+func Interned(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Null, *Boolean:
+		return obj == NULL || obj == TRUE || obj == FALSE
+	case *Integer:
+		return obj.Value >= minSmallInteger && obj.Value <= maxSmallInteger &&
+			obj == &smallIntegers[obj.Value-minSmallInteger]
+	}
+
+	return false
+}
+
 type Float struct {
 	Value float64
 }
@@ -78,10 +139,19 @@ type Error struct {
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 
+// Error makes a Monkey error a Go error, so that it can travel through Go
+// code calling back into Monkey and be raised again unchanged.
+func (e *Error) Error() string { return e.Message }
+
+// Function is a closure of the tree-walking evaluator. Env holds the globals
+// it sees, Free the cells of the variables it captured when it was created.
 type Function struct {
+	Literal    *ast.FunctionLiteral
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Layout     *ast.FrameLayout
+	Free       []*Cell
 }
 
 func (f *Function) Inspect() string {
@@ -104,3 +174,146 @@ func (f *Function) Inspect() string {
 
 }
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+
+// Cell holds a local variable that is captured by a closure, so that the
+// function defining it and the closure share it.
+type Cell struct {
+	Value Object
+}
+
+type BuiltinFunction func(args ...Object) Object
+
+// BuiltinContextFunction is a builtin that is handed the context of the
+// evaluation calling it, to pass on when it calls back into Monkey.
+type BuiltinContextFunction func(ctx context.Context, args ...Object) Object
+
+type Builtin struct {
+	Name string
+	Fn   BuiltinFunction
+	// FnContext, if set, is called instead of Fn by the engines that have
+	// a context to hand over.
+	FnContext BuiltinContextFunction
+}
+
+// Call calls the builtin with args on behalf of the evaluation ctx belongs
+// to.
+func (b *Builtin) Call(ctx context.Context, args ...Object) Object {
+	if b.FnContext != nil {
+		return b.FnContext(ctx, args...)
+	}
+
+	return b.Fn(args...)
+}
+
+func (b *Builtin) Inspect() string  { return "builtin function " + b.Name }
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+
+	if b.Value {
+		value = 1
+	}
+
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+type Hash struct {
+	Pairs map[HashKey]HashPair
+}
+
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+	sort.Strings(pairs)
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+
+const (
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+)
+
+// CompiledFunction is the bytecode of a function literal.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	LocalNames    []string
+	SourceMap     code.SourceMap
+}
+
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+
+// Closure is a compiled function together with the locals of the functions
+// it was created in. Outer[0] holds the locals of the enclosing function,
+// Outer[1] those of the function enclosing that one, and so on.
+type Closure struct {
+	Fn    *CompiledFunction
+	Outer [][]Object
+}
+
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// Closures report themselves as functions, so that scripts see the same
+// types whether they are evaluated or compiled.
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
@@ -0,0 +1,293 @@
+// Package optimizer rewrites programs into equivalent ones that are cheaper
+// to run.
+package optimizer
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/resolver"
+	"github.com/cupsadarius/monkey_interpreter/token"
+)
+
+// Pass selects one of the rewrites of the optimizer.
+type Pass int
+
+const (
+	// FoldConstants replaces operators applied to literals by their result.
+	FoldConstants Pass = 1 << iota
+	// PruneBranches drops the branch of an if expression with a constant
+	// condition that can never run.
+	PruneBranches
+	// RemoveUnusedLets drops let statements of functions that bind a
+	// literal to a name nothing refers to.
+	RemoveUnusedLets
+
+	AllPasses = FoldConstants | PruneBranches | RemoveUnusedLets
+)
+
+// Optimize rewrites program in place with the selected passes and returns
+// it. It has to run before the program is resolved. Operators whose result
+// would be an error are never folded, so the error still happens when, and
+// only if, the expression is evaluated.
+func Optimize(program *ast.Program, passes Pass) *ast.Program {
+	o := &optimizer{passes: passes}
+	program.Statements = o.statements(program.Statements)
+
+	if o.enabled(RemoveUnusedLets) {
+		removeUnusedLets(program, resolver.Bind(program))
+	}
+
+	return program
+}
+
+type optimizer struct {
+	passes Pass
+}
+
+func (o *optimizer) enabled(pass Pass) bool {
+	return o.passes&pass != 0
+}
+
+// statements optimizes a list of statements.
+func (o *optimizer) statements(statements []ast.Statement) []ast.Statement {
+	result := make([]ast.Statement, 0, len(statements))
+
+	for i, s := range statements {
+		last := i == len(statements)-1
+		s = o.statement(s)
+
+		if es, ok := s.(*ast.ExpressionStatement); ok && o.enabled(PruneBranches) {
+			if ie, ok := es.Expression.(*ast.IfExpression); ok {
+				if block, ok := o.liveBranch(ie); ok {
+					// blocks don't open a scope, so the statements of
+					// the branch can take the place of the if
+					if block != nil && len(block.Statements) > 0 {
+						result = append(result, block.Statements...)
+						continue
+					}
+					if !last {
+						continue
+					}
+				}
+			}
+		}
+
+		result = append(result, s)
+	}
+
+	return result
+}
+
+func (o *optimizer) statement(s ast.Statement) ast.Statement {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		s.Value = o.expression(s.Value)
+	case *ast.ReturnStatement:
+		s.ReturnValue = o.expression(s.ReturnValue)
+	case *ast.ExpressionStatement:
+		s.Expression = o.expression(s.Expression)
+	case *ast.BlockStatement:
+		s.Statements = o.statements(s.Statements)
+	}
+
+	return s
+}
+
+func (o *optimizer) expression(e ast.Expression) ast.Expression {
+	switch e := e.(type) {
+	case *ast.PrefixExpression:
+		e.Right = o.expression(e.Right)
+
+		if o.enabled(FoldConstants) {
+			if right, ok := constant(e.Right); ok {
+				if folded, ok := literal(evaluator.EvalPrefix(e.Operator, right), e.Token); ok {
+					return folded
+				}
+			}
+		}
+
+	case *ast.InfixExpression:
+		e.Left = o.expression(e.Left)
+		e.Right = o.expression(e.Right)
+
+		if o.enabled(FoldConstants) {
+			left, leftOk := constant(e.Left)
+			right, rightOk := constant(e.Right)
+			if leftOk && rightOk {
+				if folded, ok := literal(evaluator.EvalInfix(e.Operator, left, right), e.Token); ok {
+					return folded
+				}
+			}
+		}
+
+	case *ast.IfExpression:
+		return o.ifExpression(e)
+
+	case *ast.CallExpression:
+		e.Function = o.expression(e.Function)
+		for i, a := range e.Arguments {
+			e.Arguments[i] = o.expression(a)
+		}
+
+	case *ast.MemberExpression:
+		e.Object = o.expression(e.Object)
+
+	case *ast.FunctionLiteral:
+		e.Body.Statements = o.statements(e.Body.Statements)
+	}
+
+	return e
+}
+
+func (o *optimizer) ifExpression(ie *ast.IfExpression) ast.Expression {
+	ie.Condition = o.expression(ie.Condition)
+	ie.Consequence.Statements = o.statements(ie.Consequence.Statements)
+	if ie.Alternative != nil {
+		ie.Alternative.Statements = o.statements(ie.Alternative.Statements)
+	}
+
+	if !o.enabled(PruneBranches) {
+		return ie
+	}
+
+	block, ok := o.liveBranch(ie)
+	if !ok || block == nil {
+		return ie
+	}
+
+	if len(block.Statements) == 1 {
+		if es, ok := block.Statements[0].(*ast.ExpressionStatement); ok {
+			return es.Expression
+		}
+	}
+
+	ie.Condition = &ast.BooleanLiteral{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true}
+	ie.Consequence = block
+	ie.Alternative = nil
+
+	return ie
+}
+
+// liveBranch returns the branch of ie that runs when its condition is
+// constant, or nil when no branch runs.
+func (o *optimizer) liveBranch(ie *ast.IfExpression) (*ast.BlockStatement, bool) {
+	condition, ok := constant(ie.Condition)
+	if !ok {
+		return nil, false
+	}
+
+	if evaluator.IsTruthy(condition) {
+		return ie.Consequence, true
+	}
+
+	return ie.Alternative, true
+}
+
+// removeUnusedLets drops the let statements of function bodies that bind a
+// literal to a variable nothing reads. Globals are kept, since the host or
+// later programs may still read them. So is a let that ends a body, since
+// removing it would change the value of the function.
+func removeUnusedLets(program *ast.Program, bindings *resolver.Bindings) {
+	unused := map[*resolver.Variable]bool{}
+	for _, v := range bindings.Variables {
+		if v.Function != nil && len(v.Uses) == 0 {
+			unused[v] = true
+		}
+	}
+
+	// reading a variable before its let runs reads the ones it hides
+	for _, v := range bindings.Variables {
+		if len(v.Uses) == 0 || v.IsParameter() {
+			continue
+		}
+		for hidden := v.Shadows; hidden != nil; hidden = hidden.Shadows {
+			delete(unused, hidden)
+		}
+	}
+
+	ast.Inspect(program, func(n ast.Node) bool {
+		fl, ok := n.(*ast.FunctionLiteral)
+		if !ok || fl.Body == nil {
+			return true
+		}
+
+		statements := fl.Body.Statements
+		result := statements[:0]
+		for i, s := range statements {
+			if let, ok := s.(*ast.LetStatement); ok && i != len(statements)-1 {
+				if unused[bindings.Lookup(let.Name)] && isPure(let.Value) {
+					continue
+				}
+			}
+
+			result = append(result, s)
+		}
+		fl.Body.Statements = result
+
+		return true
+	})
+}
+
+func isPure(e ast.Expression) bool {
+	switch e.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.BooleanLiteral, *ast.FunctionLiteral:
+		return true
+	}
+
+	return false
+}
+
+// constant returns the value of a literal.
+func constant(e ast.Expression) (object.Object, bool) {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: e.Value}, true
+	case *ast.FloatLiteral:
+		return &object.Float{Value: e.Value}, true
+	case *ast.StringLiteral:
+		return &object.String{Value: e.Value}, true
+	case *ast.BooleanLiteral:
+		return object.NativeBoolToBoolean(e.Value), true
+	}
+
+	return nil, false
+}
+
+// literal turns a folded value back into a literal, positioned at tok. It
+// fails for errors and for values no literal can express.
+func literal(obj object.Object, tok token.Token) (ast.Expression, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		tok.Type = token.INT
+		tok.Literal = strconv.FormatInt(obj.Value, 10)
+		return &ast.IntegerLiteral{Token: tok, Value: obj.Value}, true
+	case *object.Float:
+		if math.IsInf(obj.Value, 0) || math.IsNaN(obj.Value) {
+			return nil, false
+		}
+		tok.Type = token.FLOAT
+		tok.Literal = strconv.FormatFloat(obj.Value, 'f', -1, 64)
+		if !strings.Contains(tok.Literal, ".") {
+			tok.Literal += ".0"
+		}
+		return &ast.FloatLiteral{Token: tok, Value: obj.Value}, true
+	case *object.String:
+		tok.Type = token.STRING
+		tok.Literal = obj.Value
+		return &ast.StringLiteral{Token: tok, Value: obj.Value}, true
+	case *object.Boolean:
+		tok.Type = token.FALSE
+		if obj.Value {
+			tok.Type = token.TRUE
+		}
+		tok.Literal = strconv.FormatBool(obj.Value)
+		return &ast.BooleanLiteral{Token: tok, Value: obj.Value}, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,114 @@
+package optimizer
+
+import (
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/internal/enginetest"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+	"github.com/cupsadarius/monkey_interpreter/resolver"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	return program
+}
+
+// resolve resolves program again once it has been optimized.
+func resolve(program *ast.Program) *ast.Program {
+	resolver.Resolve(program, nil)
+	return program
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		passes   Pass
+		expected string
+	}{
+		{"2 * 60 * 60", FoldConstants, "7200"},
+		{"x * (2 * 3)", FoldConstants, "(x * 6)"},
+		{"-(1 + 2)", FoldConstants, "-3"},
+		{"1.5 * 2", FoldConstants, "3.0"},
+		{"0.1 + 0.2", FoldConstants, "0.30000000000000004"},
+		{`"mon" + "key"`, FoldConstants, "monkey"},
+		{"!(1 < 2)", FoldConstants, "false"},
+		{"true == (1 == 1)", FoldConstants, "true"},
+		{"10 / 0", FoldConstants, "(10 / 0)"},
+		{"5 + true", FoldConstants, "(5 + true)"},
+		{`"a" - "b"`, FoldConstants, "(a - b)"},
+		{"2 * 60", PruneBranches, "(2 * 60)"},
+
+		{"if (true) { a } else { b }", PruneBranches, "a"},
+		{"if (false) { a } else { b }", PruneBranches, "b"},
+		{"if (false) { a }; b", PruneBranches, "b"},
+		{"if (false) { a }", PruneBranches, "iffalse a"},
+		{"if (1) { let x = 1; x }", PruneBranches, "let x = 1;x"},
+		{"let y = if (true) { let x = 1; x } else { b };", PruneBranches, "let y = iftrue let x = 1;x;"},
+		{"if (1 > 2) { a } else { b }", PruneBranches, "if(1 > 2) aelse b"},
+		{"if (1 > 2) { a } else { b }", AllPasses, "b"},
+
+		{"fn() { let a = 1; let b = 2; b }", RemoveUnusedLets, "fn()let b = 2;b"},
+		{"fn() { let a = x; 1 }", RemoveUnusedLets, "fn()let a = x;1"},
+		{"fn() { let f = fn() { a }; let a = 1; f() }", RemoveUnusedLets, "fn()let f = fn()a;let a = 1;f()"},
+		{"fn() { 1; let a = 1; }", RemoveUnusedLets, "fn()1let a = 1;"},
+		{"let a = 1; 2", RemoveUnusedLets, "let a = 1;2"},
+		{"fn() { let a = 1 + 1; 2 }", RemoveUnusedLets, "fn()let a = (1 + 1);2"},
+		{"fn() { let a = 1 + 1; 2 }", AllPasses, "fn()2"},
+		// a's of other scopes are not reads of it
+		{"fn() { let a = 1; let g = fn(a) { a }; g(2) }", RemoveUnusedLets, "fn()let g = fn(a)a;g(2)"},
+		{"fn() { let a = 1; let g = fn(a) { 2 }; b.a + g(a.b) }", RemoveUnusedLets, "fn()let a = 1;let g = fn(a)2;(b.a + g(a.b))"},
+		{"fn() { let a = 1; b.a }", RemoveUnusedLets, "fn()b.a"},
+		// unless they may be read before their let, which reads the hidden a
+		{"fn() { let a = 1; let g = fn() { let b = a; let a = 2; b }; g() }", RemoveUnusedLets, "fn()let a = 1;let g = fn()let b = a;let a = 2;b;g()"},
+	}
+
+	for _, tt := range tests {
+		program := Optimize(parse(t, tt.input), tt.passes)
+
+		if program.String() != tt.expected {
+			t.Errorf("%q: wrong program. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestFoldingKeepsErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"10 / (5 - 5)", "division by zero"},
+		{"if (false) { 10 / 0 } else { 1 }; 5 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		program := resolve(Optimize(parse(t, tt.input), AllPasses))
+		evaluated := evaluator.Eval(program, object.NewEnvironment())
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestMatchesEvaluator(t *testing.T) {
+	enginetest.Run(t, func(program *ast.Program) (object.Object, error) {
+		return evaluator.Eval(resolve(Optimize(program, AllPasses)), object.NewEnvironment()), nil
+	})
+}
@@ -6,7 +6,6 @@ import (
 
 	"github.com/cupsadarius/monkey_interpreter/ast"
 	"github.com/cupsadarius/monkey_interpreter/token"
-	"github.com/cupsadarius/monkey_interpreter/utils"
 )
 
 type (
@@ -37,6 +36,7 @@ var precedences = map[token.TokenType]int{
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
 	token.LPAREN:   CALL,
+	token.DOT:      CALL,
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -56,20 +56,20 @@ func (p *Parser) curPrecedence() int {
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
-	defer utils.UnTrace(utils.Trace("parseIdentifier"))
+	defer p.untrace(p.trace("parseIdentifier"))
 
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
-	defer utils.UnTrace(utils.Trace("parseIntegerLiteral"))
+	defer p.untrace(p.trace("parseIntegerLiteral"))
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer at %d: %d", p.curToken.Literal, p.curToken.Line, p.curToken.Column)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.curToken, msg)
 		return nil
 	}
 
@@ -79,7 +79,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 }
 
 func (p *Parser) parseFloatLiteral() ast.Expression {
-	defer utils.UnTrace(utils.Trace("parseFloatLiteral"))
+	defer p.untrace(p.trace("parseFloatLiteral"))
 
 	lit := &ast.FloatLiteral{Token: p.curToken}
 
@@ -87,7 +87,7 @@ func (p *Parser) parseFloatLiteral() ast.Expression {
 
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as float at %d: %d", p.curToken.Literal, p.curToken.Line, p.curToken.Column)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.curToken, msg)
 		return nil
 	}
 
@@ -97,12 +97,12 @@ func (p *Parser) parseFloatLiteral() ast.Expression {
 }
 
 func (p *Parser) parseBooleanLiteral() ast.Expression {
-	defer utils.UnTrace(utils.Trace("parseBooleanLiteral"))
+	defer p.untrace(p.trace("parseBooleanLiteral"))
 	return &ast.BooleanLiteral{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
 
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	defer utils.UnTrace(utils.Trace("parseFunctionParameters"))
+	defer p.untrace(p.trace("parseFunctionParameters"))
 
 	identifiers := []*ast.Identifier{}
 
@@ -132,7 +132,7 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 }
 
 func (p *Parser) parseFunctionLiteral() ast.Expression {
-	defer utils.UnTrace(utils.Trace("parseFunctionLiteral"))
+	defer p.untrace(p.trace("parseFunctionLiteral"))
 
 	lit := &ast.FunctionLiteral{Token: p.curToken}
 
@@ -152,7 +152,7 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
-	defer utils.UnTrace(utils.Trace("parseBlockStatement"))
+	defer p.untrace(p.trace("parseBlockStatement"))
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
 
@@ -165,11 +165,15 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+	if p.curTokenIs(token.RBRACE) {
+		block.Rbrace = p.curToken
+	}
+
 	return block
 }
 
 func (p *Parser) parseCallArguments() []ast.Expression {
-	defer utils.UnTrace(utils.Trace("parseCallArguments"))
+	defer p.untrace(p.trace("parseCallArguments"))
 
 	args := []ast.Expression{}
 
@@ -194,16 +198,33 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
-	defer utils.UnTrace(utils.Trace("parseCallExpression"))
+	defer p.untrace(p.trace("parseCallExpression"))
 
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseCallArguments()
+	if exp.Arguments != nil {
+		exp.Rparen = p.curToken
+	}
+
+	return exp
+}
+
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseMemberExpression"))
+
+	exp := &ast.MemberExpression{Token: p.curToken, Object: object}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	exp.Property = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
 	return exp
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
-	defer utils.UnTrace(utils.Trace("parseExpression"))
+	defer p.untrace(p.trace("parseExpression"))
 
 	prefix := p.prefixParseFns[p.curToken.Type]
 
@@ -213,6 +234,9 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	}
 
 	leftExp := prefix()
+	if leftExp == nil {
+		return nil
+	}
 
 	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
@@ -223,13 +247,18 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 		p.nextToken()
 
-		leftExp = infix(leftExp)
+		// an operand that failed to parse must not become the operand of
+		// the next operator
+		if leftExp = infix(leftExp); leftExp == nil {
+			return nil
+		}
 	}
 
 	return leftExp
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	lparen := p.curToken
 	p.nextToken()
 
 	exp := p.parseExpression(LOWEST)
@@ -237,11 +266,16 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
+
+	// the parentheses are part of the source span of the expression
+	if e, ok := exp.(interface{ Enclose(open, close token.Token) }); ok {
+		e.Enclose(lparen, p.curToken)
+	}
 	return exp
 }
 
 func (p *Parser) parseIfExpression() ast.Expression {
-	defer utils.UnTrace(utils.Trace("parseIfExpression"))
+	defer p.untrace(p.trace("parseIfExpression"))
 
 	expression := &ast.IfExpression{Token: p.curToken}
 
@@ -279,19 +313,21 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
-	defer utils.UnTrace(utils.Trace("parsePrefixExpression"))
+	defer p.untrace(p.trace("parsePrefixExpression"))
 
 	expression := &ast.PrefixExpression{Token: p.curToken, Operator: p.curToken.Literal}
 
 	p.nextToken()
 
-	expression.Right = p.parseExpression(PREFIX)
+	if expression.Right = p.parseExpression(PREFIX); expression.Right == nil {
+		return nil
+	}
 
 	return expression
 }
 
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
-	defer utils.UnTrace(utils.Trace("parseInfixExpression"))
+	defer p.untrace(p.trace("parseInfixExpression"))
 
 	expression := &ast.InfixExpression{
 		Token:    p.curToken,
@@ -462,6 +462,14 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"-a.b * c.d(e)",
+			"((-a.b) * c.d(e))",
+		},
+		{
+			"a.b.c(d).e",
+			"a.b.c(d).e",
+		},
 	}
 
 	for _, tt := range tests {
@@ -753,3 +761,78 @@ func TestCallExpressionParameterParsing(t *testing.T) {
 		}
 	}
 }
+
+func TestMemberExpressionParsing(t *testing.T) {
+	input := "user.Greet(1 + 2);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	call, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T",
+			stmt.Expression)
+	}
+
+	member, ok := call.Function.(*ast.MemberExpression)
+	if !ok {
+		t.Fatalf("call.Function is not ast.MemberExpression. got=%T",
+			call.Function)
+	}
+
+	if !testIdentifier(t, member.Object, "user") {
+		return
+	}
+	if !testIdentifier(t, member.Property, "Greet") {
+		return
+	}
+
+	if len(call.Arguments) != 1 {
+		t.Fatalf("wrong length of arguments. got=%d", len(call.Arguments))
+	}
+	testInfixExpression(t, call.Arguments[0], 1, "+", 2)
+}
+
+func TestMemberExpressionErrors(t *testing.T) {
+	inputs := []string{"user.(name)", "user.(name)(1)", "user.(name) + 1", "-user.(name)", "(user.(name)) + 1", "-(user.(name))(1)"}
+
+	for _, input := range inputs {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors for a non identifier member", input)
+		}
+
+		ast.Inspect(program, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CallExpression:
+				if n.Function == nil {
+					t.Errorf("%q: call of a nil function", input)
+				}
+			case *ast.InfixExpression:
+				if n.Left == nil {
+					t.Errorf("%q: nil left operand of %s", input, n.Operator)
+				}
+			case *ast.PrefixExpression:
+				if n.Right == nil {
+					t.Errorf("%q: nil operand of %s", input, n.Operator)
+				}
+			}
+			return true
+		})
+	}
+}
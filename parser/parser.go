@@ -11,7 +11,8 @@ import (
 
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
+	errors []Error
+	tracer *utils.Tracer
 
 	curToken  token.Token
 	peekToken token.Token
@@ -20,8 +21,22 @@ type Parser struct {
 	infixParseFns  map[token.TokenType]infixParserFn
 }
 
-func New(l *lexer.Lexer) *Parser {
+// Option configures a parser.
+type Option func(*Parser)
+
+// WithTracer makes the parser report the parse functions it enters and
+// leaves to a fork of t, so that t may be handed to several parsers.
+func WithTracer(t *utils.Tracer) Option {
+	return func(p *Parser) {
+		p.tracer = t.Fork()
+	}
+}
+
+func New(l *lexer.Lexer, opts ...Option) *Parser {
 	p := &Parser{l: l}
+	for _, opt := range opts {
+		opt(p)
+	}
 
 	// read two tokens so curToken and peekToken are populated
 	p.nextToken()
@@ -53,24 +68,63 @@ func New(l *lexer.Lexer) *Parser {
   p.registerInfix(token.GT, p.parseInfixExpression)
   p.registerInfix(token.GT_EQ, p.parseInfixExpression)
   p.registerInfix(token.LPAREN, p.parseCallExpression)
+  p.registerInfix(token.DOT, p.parseMemberExpression)
 
 	return p
 }
 
+func (p *Parser) trace(msg string) string {
+	if p.tracer != nil {
+		p.tracer.Trace(msg, p.curToken)
+	}
+	return msg
+}
+
+func (p *Parser) untrace(msg string) {
+	if p.tracer != nil {
+		p.tracer.UnTrace(msg, p.curToken)
+	}
+}
+
+// Error is a problem found while parsing.
+type Error struct {
+	Token token.Token // the token the problem was found at
+	Msg   string
+}
+
+func (e Error) Error() string {
+	return e.Msg
+}
+
 func (p *Parser) Errors() []string {
+	var msgs []string
+	for _, e := range p.errors {
+		msgs = append(msgs, e.Msg)
+	}
+
+	return msgs
+}
+
+// ErrorList returns the errors Errors describes together with the tokens
+// they were found at.
+func (p *Parser) ErrorList() []Error {
 	return p.errors
 }
 
+func (p *Parser) errorAt(tok token.Token, msg string) {
+	p.errors = append(p.errors, Error{Token: tok, Msg: msg})
+}
+
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead at line %d, column %d", t, p.peekToken.Type, p.peekToken.Line, p.peekToken.Column)
 
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.peekToken, msg)
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
   msg := fmt.Sprintf("no prefix parse function for %s found", t)
 
-  p.errors = append(p.errors, msg)
+  p.errorAt(p.curToken, msg)
 }
 
 func (p *Parser) nextToken() {
@@ -97,7 +151,7 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
-  defer utils.UnTrace(utils.Trace("parseLetStatement"))
+  defer p.untrace(p.trace("parseLetStatement"))
 
 	stmt := &ast.LetStatement{Token: p.curToken}
 
@@ -115,8 +169,11 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
   stmt.Value = p.parseExpression(LOWEST)
 
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
 
-	for !p.curTokenIs(token.SEMICOLON) {
+	for !p.curTokenIs(token.SEMICOLON) && !p.curTokenIs(token.EOF) {
 		p.nextToken()
 	}
 
@@ -124,7 +181,7 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 }
 
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
-  defer utils.UnTrace(utils.Trace("parseReturnStatement"))
+  defer p.untrace(p.trace("parseReturnStatement"))
 
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
@@ -132,7 +189,7 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
   stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	for !p.curTokenIs(token.SEMICOLON) {
+	for !p.curTokenIs(token.SEMICOLON) && !p.curTokenIs(token.EOF) {
 		p.nextToken()
 	}
 
@@ -160,14 +217,22 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) parseStatement() ast.Statement {
+	// a nil pointer would make a statement that is not nil, so statements
+	// that failed to parse are returned as nil and left out
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
 	case token.RETURN:
-		return p.parseReturnStatement()
+		if stmt := p.parseReturnStatement(); stmt != nil {
+			return stmt
+		}
 	default:
 		return p.parseExpressionStatement()
 	}
+
+	return nil
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
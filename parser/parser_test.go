@@ -1,10 +1,16 @@
 package parser
 
 import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/cupsadarius/monkey_interpreter/ast"
 	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/token"
+	"github.com/cupsadarius/monkey_interpreter/utils"
 )
 
 func checkParserErrors(t *testing.T, p *Parser) {
@@ -54,6 +60,7 @@ func TestLetStatements(t *testing.T) {
 		{"let x = 5;", "x", 5},
 		{"let y = true;", "y", true},
 		{"let foobar = y;", "foobar", "y"},
+		{"let z = 10", "z", 10},
 	}
 
 	for _, tt := range tests {
@@ -130,3 +137,375 @@ func TestReturnStatements(t *testing.T) {
 }
 
 
+
+func TestLetNamesFunctionLiterals(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedName string
+	}{
+		{"let add = fn(x, y) { x + y; };", "add"},
+		{"let add = fn(x) { fn(y) { x + y } };", "add"},
+		{"fn(x) { x };", ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		var function *ast.FunctionLiteral
+		switch stmt := program.Statements[0].(type) {
+		case *ast.LetStatement:
+			function = stmt.Value.(*ast.FunctionLiteral)
+		case *ast.ExpressionStatement:
+			function = stmt.Expression.(*ast.FunctionLiteral)
+		}
+
+		if function.Name != tt.expectedName {
+			t.Errorf("wrong name. expected=%q, got=%q", tt.expectedName, function.Name)
+		}
+
+		inner, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+		if ok {
+			if fl, ok := inner.Expression.(*ast.FunctionLiteral); ok && fl.Name != "" {
+				t.Errorf("inner function named %q", fl.Name)
+			}
+		}
+	}
+}
+
+func TestTracer(t *testing.T) {
+	var out bytes.Buffer
+	p := New(lexer.New("let x = -a;"), WithTracer(utils.NewTracer(&out)))
+	p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := `BEGIN parseLetStatement (LET "let" at 1:1)
+	BEGIN parseExpression (- "-" at 1:9)
+		BEGIN parsePrefixExpression (- "-" at 1:9)
+			BEGIN parseExpression (IDENT "a" at 1:10)
+				BEGIN parseIdentifier (IDENT "a" at 1:10)
+				END parseIdentifier (IDENT "a" at 1:10)
+			END parseExpression (IDENT "a" at 1:10)
+		END parsePrefixExpression (IDENT "a" at 1:10)
+	END parseExpression (IDENT "a" at 1:10)
+END parseLetStatement (; ";" at 1:11)
+`
+	if out.String() != expected {
+		t.Errorf("wrong trace.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestJSONTracer(t *testing.T) {
+	var out bytes.Buffer
+	p := New(lexer.New("add(1, 2 * 3);"), WithTracer(utils.NewJSONTracer(&out)))
+	p.ParseProgram()
+	checkParserErrors(t, p)
+
+	var open []string
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var event utils.Event
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatalf("invalid event: %s", err)
+		}
+
+		switch event.Event {
+		case "begin":
+			open = append(open, event.Name)
+			if event.Depth != len(open) {
+				t.Errorf("wrong depth of %s. expected=%d, got=%d", event.Name, len(open), event.Depth)
+			}
+		case "end":
+			if len(open) == 0 || open[len(open)-1] != event.Name {
+				t.Fatalf("unbalanced end of %s", event.Name)
+			}
+			open = open[:len(open)-1]
+		default:
+			t.Fatalf("unknown event %q", event.Event)
+		}
+
+		if event.Line != 1 || event.Token == "" {
+			t.Errorf("event without position: %+v", event)
+		}
+	}
+
+	if len(open) != 0 {
+		t.Errorf("unterminated events: %v", open)
+	}
+}
+
+func TestTracersOfParallelParsers(t *testing.T) {
+	input := "let f = fn(x, y) { if (x < y) { x } else { y.length } }; f(1, 2);"
+
+	trace := func() string {
+		var out bytes.Buffer
+		p := New(lexer.New(input), WithTracer(utils.NewTracer(&out)))
+		p.ParseProgram()
+		return out.String()
+	}
+	expected := trace()
+
+	var wg sync.WaitGroup
+	traces := make([]string, 8)
+	for i := range traces {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			traces[i] = trace()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, got := range traces {
+		if got != expected {
+			t.Errorf("trace %d differs from a sequential one:\n%s", i, got)
+		}
+	}
+	if !strings.Contains(expected, "BEGIN parseFunctionLiteral") {
+		t.Errorf("incomplete trace:\n%s", expected)
+	}
+}
+
+func TestTracerSharedByParallelParsers(t *testing.T) {
+	input := "let f = fn(x) { x.length }; f(-1);"
+
+	var sequential bytes.Buffer
+	p := New(lexer.New(input), WithTracer(utils.NewTracer(&sequential)))
+	p.ParseProgram()
+
+	var out bytes.Buffer
+	tracer := utils.NewTracer(&out)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			New(lexer.New(input), WithTracer(tracer)).ParseProgram()
+		}()
+	}
+	wg.Wait()
+
+	// the lines of the parsers interleave, but each is written whole and
+	// indented as in a trace of its own
+	expected := map[string]int{}
+	for _, line := range strings.SplitAfter(sequential.String(), "\n") {
+		expected[line] += 8
+	}
+	got := map[string]int{}
+	for _, line := range strings.SplitAfter(out.String(), "\n") {
+		got[line]++
+	}
+	for line, count := range expected {
+		if line != "" && got[line] != count {
+			t.Errorf("wrong number of lines %q. expected=%d, got=%d", line, count, got[line])
+		}
+	}
+	if len(got) != len(expected) {
+		t.Errorf("wrong number of distinct lines. expected=%d, got=%d", len(expected), len(got))
+	}
+}
+
+func TestNodeSpans(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string // source of every node, in the order ast.Inspect visits them
+	}{
+		{
+			"let x = (1 + y) * 2;",
+			[]string{"let x = (1 + y) * 2", "let x = (1 + y) * 2", "x", "(1 + y) * 2", "(1 + y)", "1", "y", "2"},
+		},
+		{
+			"-((a));",
+			[]string{"-((a))", "-((a))", "-((a))", "((a))"},
+		},
+		{
+			"add(1, (2))\n.len",
+			[]string{"add(1, (2))\n.len", "add(1, (2))\n.len", "add(1, (2))\n.len", "add(1, (2))", "add", "1", "(2)", "len"},
+		},
+		{
+			"if (x) {\n  return \"a\nb\";\n} else { fn(a) {} }",
+			[]string{
+				"if (x) {\n  return \"a\nb\";\n} else { fn(a) {} }",
+				"if (x) {\n  return \"a\nb\";\n} else { fn(a) {} }",
+				"if (x) {\n  return \"a\nb\";\n} else { fn(a) {} }",
+				"x",
+				"{\n  return \"a\nb\";\n}",
+				"return \"a\nb\"",
+				"\"a\nb\"",
+				"{ fn(a) {} }",
+				"fn(a) {}",
+				"fn(a) {}",
+				"a",
+				"{}",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		var spans []string
+		ast.Inspect(program, func(node ast.Node) bool {
+			if node == nil {
+				return false
+			}
+
+			pos, end := node.Pos(), node.End()
+			spans = append(spans, tt.input[pos.Offset:end.Offset])
+
+			// lines and columns have to agree with the offsets
+			for _, position := range []token.Position{pos, end} {
+				before := tt.input[:position.Offset]
+				line := strings.Count(before, "\n") + 1
+				column := len(before) - strings.LastIndex(before, "\n")
+				if position.Line != line || position.Column != column {
+					t.Errorf("%T: position %s does not match offset %d of %q", node, position, position.Offset, tt.input)
+				}
+			}
+			return true
+		})
+
+		if strings.Join(spans, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("wrong spans for %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, spans)
+		}
+	}
+}
+
+func TestErrorList(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1;", nil},
+		{"let = 1;", []string{"1:5 =", "1:5 ="}},
+		{"let x = 1;\nlet 5;", []string{"2:5 5"}},
+		{"let x = 99999999999999999999;", []string{"1:9 99999999999999999999"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		var got []string
+		for _, e := range p.ErrorList() {
+			got = append(got, e.Token.Pos().String()+" "+e.Token.Literal)
+		}
+
+		if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("wrong errors for %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+		if len(p.ErrorList()) != len(p.Errors()) {
+			t.Errorf("wrong number of errors. expected=%d, got=%d", len(p.Errors()), len(p.ErrorList()))
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	tests := []string{
+		"let x = (1 + y) * 2; x",
+		"let f = fn(a, b) { if (a < b) { return a; } else { b.len } }; f(1, 2.5)",
+		"-(!true); \"a\nb\"; (fn() {})()",
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		data, err := json.Marshal(program)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		decoded, err := ast.DecodeJSON(data)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if decoded.String() != program.String() {
+			t.Errorf("wrong program.\nexpected=%s\ngot=%s", program.String(), decoded.String())
+		}
+
+		// the spans are encoded too, so they have to be the same
+		again, err := json.Marshal(decoded)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(again) != string(data) {
+			t.Errorf("wrong JSON after decoding %q.\nexpected=%s\ngot=%s", input, data, again)
+		}
+	}
+}
+
+func TestSpansOfMalformedPrograms(t *testing.T) {
+	inputs := []string{
+		"let = 1;",
+		"let x = 1;\nlet 5;",
+		"let x = 99999999999999999999;",
+		"let x = ;",
+		"return ;",
+		"user.(name)(1) + 1",
+		"-user.(name)",
+		"if (x { 1 } else",
+		"fn(a, { a }",
+		"add(1, 2",
+		"(1 + ",
+		"a.b.",
+		"}",
+	}
+
+	for _, input := range inputs {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors", input)
+		}
+
+		ast.Inspect(program, func(node ast.Node) bool {
+			if node == nil {
+				return false
+			}
+
+			if pos, end := node.Pos(), node.End(); pos.Offset > end.Offset || end.Offset > len(input) {
+				t.Errorf("%q: wrong span of %T. got=%s-%s", input, node, pos, end)
+			}
+			return true
+		})
+	}
+}
+
+func TestJSONOfMalformedPrograms(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // member holding a missing child
+	}{
+		{"let x = ;", `"value":null`},
+		{"return ;", `"returnValue":null`},
+		{"let = 1;", `"expression":null`},
+		{"if (x) { let x = ; }", `"value":null`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors", tt.input)
+		}
+
+		data, err := json.Marshal(program)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %s", tt.input, err)
+		}
+		if !strings.Contains(string(data), tt.expected) {
+			t.Errorf("%q: %s missing from %s", tt.input, tt.expected, data)
+		}
+
+		// the missing children keep the program from being decoded
+		if _, err := ast.DecodeJSON(data); err == nil || !strings.Contains(err.Error(), " without ") {
+			t.Errorf("%q: expected an error for the missing child. got=%v", tt.input, err)
+		}
+	}
+}
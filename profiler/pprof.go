@@ -0,0 +1,161 @@
+package profiler
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+)
+
+// WritePprof writes the recorded call stacks as a gzipped profile in the
+// protocol buffer format read by go tool pprof. Every sample is a call
+// stack with the number of calls of its innermost function, the time spent
+// in it and the objects it allocated; when sampling, the number of samples
+// taken comes first.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	strings := newStringTable()
+	profile := &protobuf{}
+
+	valueType := func(typ, unit string) *protobuf {
+		vt := &protobuf{}
+		vt.int(1, strings.index(typ))
+		vt.int(2, strings.index(unit))
+		return vt
+	}
+
+	if p.interval > 0 {
+		profile.message(1, valueType("samples", "count"))
+	}
+	profile.message(1, valueType("calls", "count"))
+	profile.message(1, valueType("time", "nanoseconds"))
+	profile.message(1, valueType("allocations", "count"))
+
+	p.walk(func(n *node) {
+		if n.calls == 0 && n.elapsed == 0 && n.allocs == 0 {
+			return
+		}
+
+		var locations, values []uint64
+		for _, fn := range n.stack() {
+			locations = append(locations, fn.id)
+		}
+		if p.interval > 0 {
+			values = append(values, uint64(n.samples))
+		}
+		values = append(values, uint64(n.calls), uint64(n.elapsed), uint64(n.allocs))
+
+		sample := &protobuf{}
+		sample.packed(1, locations)
+		sample.packed(2, values)
+		profile.message(2, sample)
+	})
+
+	// every function has a single location, at its first line
+	for _, fn := range p.order {
+		line := &protobuf{}
+		line.uint(1, fn.id)
+		line.int(2, int64(fn.line))
+
+		location := &protobuf{}
+		location.uint(1, fn.id)
+		location.message(4, line)
+		profile.message(4, location)
+	}
+
+	for _, fn := range p.order {
+		function := &protobuf{}
+		function.uint(1, fn.id)
+		function.int(2, strings.index(fn.name))
+		function.int(3, strings.index(fn.name))
+		function.int(4, strings.index(p.filename))
+		function.int(5, int64(fn.line))
+		profile.message(5, function)
+	}
+
+	if p.interval > 0 {
+		profile.message(11, valueType("time", "nanoseconds"))
+		profile.int(12, int64(p.interval))
+	}
+	profile.int(14, strings.index("time"))
+
+	// the string table has to be written last, once every string is in it
+	for _, s := range strings.strings {
+		profile.bytes(6, []byte(s))
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(profile.buf); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+type stringTable struct {
+	strings []string
+	indexes map[string]int64
+}
+
+func newStringTable() *stringTable {
+	// the first string of a profile has to be the empty one
+	return &stringTable{strings: []string{""}, indexes: map[string]int64{"": 0}}
+}
+
+func (t *stringTable) index(s string) int64 {
+	i, ok := t.indexes[s]
+	if !ok {
+		i = int64(len(t.strings))
+		t.strings = append(t.strings, s)
+		t.indexes[s] = i
+	}
+
+	return i
+}
+
+// protobuf encodes a protocol buffer message. Fields holding their zero
+// value are left out, like the protocol buffer encoders do.
+type protobuf struct {
+	buf []byte
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (pb *protobuf) varint(v uint64) {
+	pb.buf = binary.AppendUvarint(pb.buf, v)
+}
+
+func (pb *protobuf) key(field int, wireType int) {
+	pb.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (pb *protobuf) uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	pb.key(field, wireVarint)
+	pb.varint(v)
+}
+
+func (pb *protobuf) int(field int, v int64) {
+	pb.uint(field, uint64(v))
+}
+
+func (pb *protobuf) bytes(field int, b []byte) {
+	pb.key(field, wireBytes)
+	pb.varint(uint64(len(b)))
+	pb.buf = append(pb.buf, b...)
+}
+
+func (pb *protobuf) packed(field int, values []uint64) {
+	var packed protobuf
+	for _, v := range values {
+		packed.varint(v)
+	}
+	pb.bytes(field, packed.buf)
+}
+
+func (pb *protobuf) message(field int, m *protobuf) {
+	pb.bytes(field, m.buf)
+}
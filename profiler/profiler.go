@@ -0,0 +1,315 @@
+// Package profiler measures where Monkey programs spend their time. A
+// Profiler is installed as an evaluator hook and records, for every call
+// stack, how often it was entered, how much time was spent in its innermost
+// function and how many objects that function allocated. From these it
+// reports per function statistics and writes profiles that go tool pprof
+// can read.
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+// how many nodes are evaluated between two looks at the clock when sampling
+const sampleCheckInterval = 64
+
+// Profiler records the calls of the evaluations it is installed in. It
+// follows a single evaluation at a time.
+type Profiler struct {
+	filename string
+	interval time.Duration // zero when every call is timed
+
+	functions map[interface{}]*function
+	order     []*function
+	root      *node
+	current   *node
+
+	last       time.Time
+	lastAllocs int64
+	nodes      int
+}
+
+type Option func(*Profiler)
+
+// WithFilename sets the name of the file the profiled program was read
+// from, which pprof shows next to line numbers.
+func WithFilename(filename string) Option {
+	return func(p *Profiler) {
+		p.filename = filename
+	}
+}
+
+// WithSampling makes the profiler look at the clock only now and then and
+// charge the time elapsed since, in multiples of interval, to the call
+// stack it finds, instead of timing every call. This is less precise but
+// slows the program down much less.
+func WithSampling(interval time.Duration) Option {
+	return func(p *Profiler) {
+		p.interval = interval
+	}
+}
+
+func New(opts ...Option) *Profiler {
+	p := &Profiler{functions: map[interface{}]*function{}}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	p.root = &node{children: map[*function]*node{}}
+	p.current = p.root
+
+	return p
+}
+
+// function is a Monkey function, a builtin or the top level of a program.
+type function struct {
+	id     uint64
+	name   string
+	line   int
+	column int
+}
+
+// node is a call stack, made of its parent and fn.
+type node struct {
+	fn       *function
+	parent   *node
+	children map[*function]*node
+
+	calls   int64
+	samples int64
+	elapsed time.Duration
+	allocs  int64
+}
+
+func (n *node) child(fn *function) *node {
+	c, ok := n.children[fn]
+	if !ok {
+		c = &node{fn: fn, parent: n, children: map[*function]*node{}}
+		n.children[fn] = c
+	}
+
+	return c
+}
+
+// stack returns the functions of the call stack, innermost first.
+func (n *node) stack() []*function {
+	var stack []*function
+	for ; n.fn != nil; n = n.parent {
+		stack = append(stack, n.fn)
+	}
+
+	return stack
+}
+
+func (p *Profiler) function(key interface{}, name string, line, column int) *function {
+	fn, ok := p.functions[key]
+	if !ok {
+		fn = &function{id: uint64(len(p.order) + 1), name: name, line: line, column: column}
+		p.functions[key] = fn
+		p.order = append(p.order, fn)
+	}
+
+	return fn
+}
+
+// functionOf returns the function called when fn is.
+func (p *Profiler) functionOf(fn object.Object) *function {
+	switch fn := fn.(type) {
+	case *object.Function:
+		if fl := fn.Literal; fl != nil {
+			name := fl.Name
+			if name == "" {
+				name = fmt.Sprintf("anonymous@%d:%d", fl.Token.Line, fl.Token.Column)
+			}
+			return p.function(fl, name, fl.Token.Line, fl.Token.Column)
+		}
+	case *object.Builtin:
+		name := fn.Name
+		if name == "" {
+			name = "builtin"
+		}
+		return p.function("builtin "+name, name, 0, 0)
+	}
+
+	return p.function(fn.Type(), string(fn.Type()), 0, 0)
+}
+
+// tick charges the time elapsed since the last event to the current call
+// stack.
+func (p *Profiler) tick() {
+	now := time.Now()
+	if !p.last.IsZero() && p.current != p.root {
+		p.current.elapsed += now.Sub(p.last)
+	}
+	p.last = now
+}
+
+func (p *Profiler) enter(fn *function) {
+	switch {
+	case p.interval == 0:
+		p.tick()
+	case p.current == p.root:
+		// time between two evaluations is not sampled
+		p.last = time.Now()
+	}
+
+	p.current = p.current.child(fn)
+	p.current.calls++
+}
+
+func (p *Profiler) leave() {
+	if p.interval == 0 {
+		p.tick()
+	}
+
+	if p.current != p.root {
+		p.current = p.current.parent
+	}
+}
+
+func (p *Profiler) OnNodeEnter(n ast.Node, scope evaluator.Scope) {
+	if _, ok := n.(*ast.Program); ok {
+		p.lastAllocs = 0
+		p.enter(p.function("main", "main", 1, 1))
+	}
+
+	// objects are charged to the function evaluating the node that
+	// follows their allocation, which is where they have been allocated
+	// unless that function just returned
+	allocs := scope.Allocations()
+	if allocs >= p.lastAllocs {
+		p.current.allocs += allocs - p.lastAllocs
+	} else {
+		p.current.allocs += allocs
+	}
+	p.lastAllocs = allocs
+
+	if p.interval > 0 {
+		p.nodes++
+		if p.nodes%sampleCheckInterval == 0 {
+			p.sample()
+		}
+	}
+}
+
+func (p *Profiler) sample() {
+	now := time.Now()
+	if p.last.IsZero() {
+		p.last = now
+		return
+	}
+
+	if n := int64(now.Sub(p.last) / p.interval); n > 0 {
+		p.current.samples += n
+		p.current.elapsed += time.Duration(n) * p.interval
+		p.last = p.last.Add(time.Duration(n) * p.interval)
+	}
+}
+
+func (p *Profiler) OnNodeExit(n ast.Node, result object.Object) {
+	if _, ok := n.(*ast.Program); ok {
+		p.leave()
+	}
+}
+
+func (p *Profiler) OnCall(fn object.Object, args []object.Object) {
+	p.enter(p.functionOf(fn))
+}
+
+func (p *Profiler) OnReturn(fn object.Object, result object.Object) {
+	p.leave()
+}
+
+// FunctionStats are the statistics of a single function.
+type FunctionStats struct {
+	Name         string
+	Line, Column int
+	Calls        int64
+	// Inclusive is the time spent in the function and the functions it
+	// called, Exclusive the time spent in the function itself.
+	Inclusive, Exclusive time.Duration
+	// Allocations is the number of objects the function itself
+	// allocated.
+	Allocations int64
+}
+
+// Functions returns the statistics of every function called so far, the
+// ones that took the most time first.
+func (p *Profiler) Functions() []FunctionStats {
+	stats := make([]FunctionStats, len(p.order))
+	for i, fn := range p.order {
+		stats[i] = FunctionStats{Name: fn.name, Line: fn.line, Column: fn.column}
+	}
+
+	p.walk(func(n *node) {
+		s := &stats[n.fn.id-1]
+		s.Calls += n.calls
+		s.Exclusive += n.elapsed
+		s.Allocations += n.allocs
+
+		// time of recursive calls is counted once for each function
+		seen := map[*function]bool{}
+		for _, fn := range n.stack() {
+			if !seen[fn] {
+				seen[fn] = true
+				stats[fn.id-1].Inclusive += n.elapsed
+			}
+		}
+	})
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].Exclusive != stats[j].Exclusive {
+			return stats[i].Exclusive > stats[j].Exclusive
+		}
+		return stats[i].Inclusive > stats[j].Inclusive
+	})
+
+	return stats
+}
+
+// walk calls visit for every call stack recorded, callers before callees.
+func (p *Profiler) walk(visit func(n *node)) {
+	var walk func(n *node)
+	walk = func(n *node) {
+		if n != p.root {
+			visit(n)
+		}
+
+		children := make([]*node, 0, len(n.children))
+		for _, c := range n.children {
+			children = append(children, c)
+		}
+		sort.Slice(children, func(i, j int) bool { return children[i].fn.id < children[j].fn.id })
+
+		for _, c := range children {
+			walk(c)
+		}
+	}
+
+	walk(p.root)
+}
+
+// WriteText writes the statistics of all functions as a table.
+func (p *Profiler) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "calls\tinclusive\texclusive\tallocs\tfunction")
+	for _, s := range p.Functions() {
+		location := ""
+		if s.Line > 0 {
+			location = fmt.Sprintf(" (%s:%d)", p.filename, s.Line)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s%s\n", s.Calls, s.Inclusive, s.Exclusive, s.Allocations, s.Name, location)
+	}
+
+	return tw.Flush()
+}
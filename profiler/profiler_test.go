@@ -0,0 +1,258 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cupsadarius/monkey_interpreter/interpreter"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+const program = `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let twice = fn(f, x) { f(f(x)) };
+fib(10) + twice(fn(x) { x * 2 }, 1) + double(1);
+`
+
+func profile(t *testing.T, opts ...Option) *Profiler {
+	t.Helper()
+
+	p := New(opts...)
+	i := interpreter.New(interpreter.WithHook(p))
+	i.Set("double", func(x int64) int64 { return x * 2 })
+
+	result, err := i.Run(program)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "61" {
+		t.Fatalf("wrong result. got=%s", result.Inspect())
+	}
+
+	return p
+}
+
+func stats(p *Profiler) map[string]FunctionStats {
+	byName := map[string]FunctionStats{}
+	for _, s := range p.Functions() {
+		byName[s.Name] = s
+	}
+
+	return byName
+}
+
+func TestFunctions(t *testing.T) {
+	functions := stats(profile(t))
+
+	tests := []struct {
+		name  string
+		calls int64
+		line  int
+	}{
+		{"main", 1, 1},
+		{"fib", 177, 2},
+		{"twice", 1, 3},
+		{"anonymous@4:17", 2, 4},
+		{"double", 1, 0},
+	}
+
+	if len(functions) != len(tests) {
+		t.Errorf("wrong number of functions. expected=%d, got=%v", len(tests), functions)
+	}
+
+	for _, tt := range tests {
+		s, ok := functions[tt.name]
+		if !ok {
+			t.Errorf("no statistics for %s", tt.name)
+			continue
+		}
+		if s.Calls != tt.calls {
+			t.Errorf("%s: wrong number of calls. expected=%d, got=%d", tt.name, tt.calls, s.Calls)
+		}
+		if s.Line != tt.line {
+			t.Errorf("%s: wrong line. expected=%d, got=%d", tt.name, tt.line, s.Line)
+		}
+		if s.Inclusive < s.Exclusive {
+			t.Errorf("%s: inclusive time %s below exclusive time %s", tt.name, s.Inclusive, s.Exclusive)
+		}
+	}
+
+	var exclusive time.Duration
+	for _, s := range functions {
+		exclusive += s.Exclusive
+	}
+	if functions["main"].Inclusive != exclusive {
+		t.Errorf("main does not include everything. expected=%s, got=%s", exclusive, functions["main"].Inclusive)
+	}
+	if functions["fib"].Inclusive > functions["main"].Inclusive {
+		t.Errorf("recursive calls counted more than once. fib=%s, main=%s", functions["fib"].Inclusive, functions["main"].Inclusive)
+	}
+
+	// every call of fib allocates at least its frame
+	if allocs := functions["fib"].Allocations; allocs < 177 {
+		t.Errorf("too few allocations for fib. got=%d", allocs)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	p := profile(t, WithFilename("fib.mk"))
+
+	var out bytes.Buffer
+	if err := p.WriteText(&out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 6 || !strings.HasPrefix(lines[0], "calls") {
+		t.Fatalf("wrong table:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "fib (fib.mk:2)") {
+		t.Errorf("no location for fib:\n%s", out.String())
+	}
+}
+
+func TestSampling(t *testing.T) {
+	p := profile(t, WithSampling(time.Nanosecond))
+	functions := stats(p)
+
+	if functions["fib"].Calls != 177 {
+		t.Errorf("wrong number of calls. got=%d", functions["fib"].Calls)
+	}
+
+	var samples int64
+	p.walk(func(n *node) { samples += n.samples })
+	if samples == 0 {
+		t.Errorf("no samples taken")
+	}
+	if functions["main"].Inclusive != time.Duration(samples) {
+		t.Errorf("time does not match the samples. expected=%d, got=%s", samples, functions["main"].Inclusive)
+	}
+}
+
+// field is a field of an encoded protocol buffer message.
+type field struct {
+	number int
+	value  uint64
+	bytes  []byte
+}
+
+func decode(t *testing.T, buf []byte) []field {
+	t.Helper()
+
+	var fields []field
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		buf = buf[n:]
+
+		f := field{number: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			f.value, n = binary.Uvarint(buf)
+			buf = buf[n:]
+		case wireBytes:
+			length, n := binary.Uvarint(buf)
+			f.bytes = buf[n : n+int(length)]
+			buf = buf[n+int(length):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+func TestWritePprof(t *testing.T) {
+	p := profile(t, WithFilename("fib.mk"))
+
+	var out bytes.Buffer
+	if err := p.WritePprof(&out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	gz, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("not gzipped: %s", err)
+	}
+	raw, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("not gzipped: %s", err)
+	}
+
+	var stringTable []string
+	counts := map[int]int{}
+	var calls uint64
+	for _, f := range decode(t, raw) {
+		counts[f.number]++
+		switch f.number {
+		case 6:
+			stringTable = append(stringTable, string(f.bytes))
+		case 2:
+			for _, sf := range decode(t, f.bytes) {
+				if sf.number == 2 {
+					// the first value is the number of calls
+					v, _ := binary.Uvarint(sf.bytes)
+					calls += v
+				}
+			}
+		}
+	}
+
+	if len(stringTable) == 0 || stringTable[0] != "" {
+		t.Fatalf("string table has to start with the empty string. got=%q", stringTable)
+	}
+	for _, s := range []string{"calls", "time", "nanoseconds", "allocations", "main", "fib", "twice", "double", "fib.mk"} {
+		found := false
+		for _, entry := range stringTable {
+			found = found || entry == s
+		}
+		if !found {
+			t.Errorf("%q missing from the string table %q", s, stringTable)
+		}
+	}
+
+	if counts[1] != 3 {
+		t.Errorf("wrong number of sample types. got=%d", counts[1])
+	}
+	if counts[4] != 5 || counts[5] != 5 {
+		t.Errorf("wrong number of locations and functions. got=%d, %d", counts[4], counts[5])
+	}
+	if calls != 1+177+1+2+1 {
+		t.Errorf("wrong number of calls in samples. got=%d", calls)
+	}
+}
+
+func TestCallsFromGo(t *testing.T) {
+	p := New()
+	i := interpreter.New(interpreter.WithHook(p))
+
+	if _, err := i.Run("let inc = fn(x) { x + 1 };"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for n := 0; n < 3; n++ {
+		if _, err := i.CallObject(mustGet(t, i, "inc"), object.NewInteger(1)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	functions := stats(p)
+	if functions["inc"].Calls != 3 || functions["main"].Calls != 1 {
+		t.Errorf("wrong calls. got=%v", functions)
+	}
+}
+
+func mustGet(t *testing.T, i *interpreter.Interpreter, name string) object.Object {
+	t.Helper()
+
+	obj, ok := i.Environment().Get(name)
+	if !ok {
+		t.Fatalf("%s is not defined", name)
+	}
+
+	return obj
+}
@@ -0,0 +1,258 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/debugger"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+)
+
+const DEBUG_PROMPT = "(debug) "
+
+const debugHelp = `break line [if condition]  stop at line, when condition is true
+run                        start the script, or start it again
+step                       run to the next line, stepping into calls
+next                       run to the next line, stepping over calls
+finish                     run until the current function returns
+continue                   run to the next breakpoint
+print expr                 evaluate expr in the paused function
+locals                     print the variables of the paused function
+backtrace                  print the call stack
+quit                       leave the debugger
+`
+
+// debugSession debugs a script with gdb-like commands. The script runs in
+// the environment of the REPL, so it sees the globals defined there and
+// leaves its own behind.
+type debugSession struct {
+	out  io.Writer
+	env  *object.Environment
+	path string
+
+	source      []string // the lines of the script
+	program     *ast.Program
+	breakpoints []debugger.Breakpoint
+
+	debugger *debugger.Debugger
+	stop     *debugger.Stop // where the script is paused, if it is
+}
+
+// debug runs the debugger on the script at path until the user quits it
+// or the input ends.
+func debug(scanner *bufio.Scanner, out io.Writer, env *object.Environment, path string) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Errors())
+		return
+	}
+
+	s := &debugSession{
+		out:     out,
+		env:     env,
+		path:    path,
+		source:  strings.Split(string(source), "\n"),
+		program: program,
+	}
+	defer s.terminate()
+
+	fmt.Fprintf(out, "debugging %s, type help for the commands\n", path)
+	for {
+		fmt.Fprint(out, DEBUG_PROMPT)
+		if !scanner.Scan() {
+			return
+		}
+
+		command, arg, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if command == "quit" || command == "q" {
+			return
+		}
+		s.run(command, strings.TrimSpace(arg))
+	}
+}
+
+func (s *debugSession) run(command, arg string) {
+	switch command {
+	case "":
+	case "help", "h":
+		io.WriteString(s.out, debugHelp)
+	case "break", "b":
+		s.setBreakpoint(arg)
+	case "run", "r":
+		s.terminate()
+		s.debugger = debugger.New(s.program)
+		s.debugger.SetBreakpoints(s.breakpoints)
+		s.debugger.Start(s.env)
+		s.wait()
+	case "step", "s":
+		s.resume((*debugger.Debugger).StepIn)
+	case "next", "n":
+		s.resume((*debugger.Debugger).StepOver)
+	case "finish":
+		s.resume((*debugger.Debugger).StepOut)
+	case "continue", "c":
+		s.resume((*debugger.Debugger).Continue)
+	case "print", "p":
+		s.print(arg)
+	case "locals":
+		s.locals()
+	case "backtrace", "bt":
+		s.backtrace()
+	default:
+		fmt.Fprintf(s.out, "unknown command %q, type help for the commands\n", command)
+	}
+}
+
+// setBreakpoint adds the breakpoint arg describes, as "line [if condition]".
+func (s *debugSession) setBreakpoint(arg string) {
+	lineArg, condition, _ := strings.Cut(arg, " ")
+	condition = strings.TrimSpace(condition)
+	if condition != "" {
+		var ok bool
+		if condition, ok = cutPrefix(condition, "if "); !ok {
+			fmt.Fprintln(s.out, "usage: break line [if condition]")
+			return
+		}
+	}
+
+	line, err := strconv.Atoi(lineArg)
+	if err != nil {
+		fmt.Fprintln(s.out, "usage: break line [if condition]")
+		return
+	}
+
+	// set on a debugger of its own, to check it before the script runs
+	bp := debugger.New(s.program).SetBreakpoints([]debugger.Breakpoint{{Line: line, Condition: condition}})[0]
+	if !bp.Verified {
+		fmt.Fprintf(s.out, "cannot break at line %d: %s\n", line, bp.Message)
+		return
+	}
+
+	s.breakpoints = append(s.breakpoints, debugger.Breakpoint{Line: bp.Line, Condition: condition})
+	if s.debugger != nil {
+		s.debugger.SetBreakpoints(s.breakpoints)
+	}
+	fmt.Fprintf(s.out, "breakpoint %d at %s:%d\n", len(s.breakpoints), s.path, bp.Line)
+}
+
+func cutPrefix(s, prefix string) (string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+
+	return strings.TrimSpace(s[len(prefix):]), true
+}
+
+func (s *debugSession) resume(step func(*debugger.Debugger) error) {
+	if s.stop == nil {
+		fmt.Fprintln(s.out, "the script is not paused, type run to start it")
+		return
+	}
+
+	s.stop = nil
+	step(s.debugger)
+	s.wait()
+}
+
+// wait waits for the script to stop and tells where, or how it ended.
+func (s *debugSession) wait() {
+	s.stop = s.debugger.Wait()
+	if s.stop == nil {
+		result, err := s.debugger.Result()
+		switch {
+		case err != nil:
+			fmt.Fprintf(s.out, "evaluation aborted: %s\n", err)
+		case result != nil:
+			fmt.Fprintln(s.out, result.Inspect())
+		}
+		fmt.Fprintln(s.out, "script finished")
+		return
+	}
+
+	f := s.stop.Frames[0]
+	fmt.Fprintf(s.out, "%s in %s at %s:%d\n", s.stop.Reason, f.Name, s.path, f.Pos.Line)
+	if line := f.Pos.Line; line >= 1 && line <= len(s.source) {
+		fmt.Fprintf(s.out, "%d\t%s\n", line, s.source[line-1])
+	}
+}
+
+// paused returns the innermost frame of the paused script, or nil after
+// telling the user it is not paused.
+func (s *debugSession) paused() *debugger.Frame {
+	if s.stop == nil {
+		fmt.Fprintln(s.out, "the script is not paused")
+		return nil
+	}
+
+	return s.stop.Frames[0]
+}
+
+func (s *debugSession) print(expr string) {
+	f := s.paused()
+	if f == nil {
+		return
+	}
+
+	result, err := f.Evaluate(expr)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+
+	fmt.Fprintln(s.out, result.Inspect())
+}
+
+// locals prints the variables of the paused function, which are the
+// globals at the top level of the script.
+func (s *debugSession) locals() {
+	f := s.paused()
+	if f == nil {
+		return
+	}
+
+	if f.Function != nil {
+		for _, v := range f.Locals() {
+			fmt.Fprintf(s.out, "%s = %s\n", v.Name, v.Value.Inspect())
+		}
+		return
+	}
+
+	env := f.Globals()
+	for _, name := range env.Names() {
+		if value, ok := env.Get(name); ok {
+			fmt.Fprintf(s.out, "%s = %s\n", name, value.Inspect())
+		}
+	}
+}
+
+func (s *debugSession) backtrace() {
+	if s.paused() == nil {
+		return
+	}
+
+	for i, f := range s.stop.Frames {
+		fmt.Fprintf(s.out, "#%d %s at %s:%s\n", i, f.Name, s.path, f.Pos)
+	}
+}
+
+// terminate ends the script, if it runs.
+func (s *debugSession) terminate() {
+	if s.debugger != nil {
+		s.debugger.Terminate()
+		s.debugger, s.stop = nil, nil
+	}
+}
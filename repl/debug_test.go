@@ -0,0 +1,94 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const script = `let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+let twice = fn(n) {
+  let once = add(n, n);
+  add(once, once)
+};
+let x = twice(2);
+x + 1`
+
+func TestDebug(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := []string{
+		"let base = 10;",
+		":debug " + path,
+		"step",
+		"break 3 if sum > 5",
+		"break 6",
+		"break 20",
+		"break x",
+		"run",
+		"locals",
+		"next",
+		"step",
+		"print a * b + base",
+		"print let",
+		"continue",
+		"backtrace",
+		"locals",
+		"finish",
+		"next",
+		"locals",
+		"continue",
+		"frobnicate",
+		"quit",
+		"x",
+	}
+
+	var out bytes.Buffer
+	Start(strings.NewReader(strings.Join(input, "\n")+"\n"), &out)
+
+	expected := `>> >> debugging {path}, type help for the commands
+(debug) the script is not paused, type run to start it
+(debug) breakpoint 1 at {path}:3
+(debug) breakpoint 2 at {path}:6
+(debug) cannot break at line 20: no statement on or after line 20
+(debug) usage: break line [if condition]
+(debug) breakpoint in twice at {path}:6
+6	  let once = add(n, n);
+(debug) n = 2
+(debug) step in twice at {path}:7
+7	  add(once, once)
+(debug) step in add at {path}:2
+2	  let sum = a + b;
+(debug) 26
+(debug) expected next token to be IDENT, got EOF instead at line 1, column 4
+(debug) breakpoint in add at {path}:3
+3	  sum
+(debug) #0 add at {path}:3:3
+#1 twice at {path}:7:3
+#2 main at {path}:9:9
+(debug) a = 4
+b = 4
+sum = 8
+(debug) step in main at {path}:10
+10	x + 1
+(debug) 9
+script finished
+(debug) the script is not paused
+(debug) the script is not paused, type run to start it
+(debug) unknown command "frobnicate", type help for the commands
+(debug) >> 8
+>> `
+	expected = strings.ReplaceAll(expected, "{path}", path)
+
+	if got := out.String(); got != expected {
+		t.Errorf("wrong output.\nexpected=%q\ngot=     %q", expected, got)
+	}
+}
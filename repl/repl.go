@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/cupsadarius/monkey_interpreter/evaluator"
 	"github.com/cupsadarius/monkey_interpreter/lexer"
@@ -25,6 +26,17 @@ func Start(in io.Reader, out io.Writer) {
 		}
 
 		line := scanner.Text()
+		if strings.HasPrefix(line, ":debug") {
+			path := strings.TrimSpace(strings.TrimPrefix(line, ":debug"))
+			if path == "" {
+				io.WriteString(out, "usage: :debug file\n")
+				continue
+			}
+
+			debug(scanner, out, env, path)
+			continue
+		}
+
 		l := lexer.New(line)
 		p := parser.New(l)
 
@@ -0,0 +1,159 @@
+package resolver
+
+import "github.com/cupsadarius/monkey_interpreter/ast"
+
+// Variable is a name bound by let statements or by a parameter, in the
+// scope of a function or at the top level of a program.
+type Variable struct {
+	Name         string
+	Function     *ast.FunctionLiteral // whose scope holds it, nil for globals
+	Declarations []*ast.Identifier    // the parameter and let names binding it, in source order
+	Lets         []*ast.LetStatement  // the let statements binding it
+	Uses         []*ast.Identifier    // the identifiers reading it, in source order
+	Shadows      *Variable            // of an enclosing scope hidden by it, if any
+}
+
+// IsParameter tells whether v is a parameter of its function.
+func (v *Variable) IsParameter() bool {
+	return len(v.Declarations) > len(v.Lets)
+}
+
+// Bindings tells which variable every identifier of a program names.
+// Unlike Resolve it leaves the program alone, and it copes with programs
+// that failed to parse.
+type Bindings struct {
+	Variables []*Variable // in the order they are declared first
+	names     map[*ast.Identifier]*Variable
+}
+
+// Lookup returns the variable ident declares or reads, or nil for names
+// the program does not bind and for member names.
+func (b *Bindings) Lookup(ident *ast.Identifier) *Variable {
+	return b.names[ident]
+}
+
+// Visible returns the variables in scope at offset, the innermost first.
+func (b *Bindings) Visible(offset int) []*Variable {
+	var visible []*Variable
+	shadowed := map[string]bool{}
+
+	// functions are declared after the ones enclosing them, so going
+	// backwards finds the innermost scopes first
+	for i := len(b.Variables) - 1; i >= 0; i-- {
+		v := b.Variables[i]
+		if v.Function != nil && !(v.Function.Pos().Offset <= offset && offset < v.Function.End().Offset) {
+			continue
+		}
+		if shadowed[v.Name] {
+			continue
+		}
+
+		shadowed[v.Name] = true
+		visible = append(visible, v)
+	}
+
+	return visible
+}
+
+// Bind works out the bindings of program with the scoping rules Resolve
+// follows: a function has a scope of its own, holding its parameters and
+// the names of all its let statements, blocks included.
+func Bind(program *ast.Program) *Bindings {
+	b := &Bindings{names: map[*ast.Identifier]*Variable{}}
+
+	top := &bindingScope{variables: map[string]*Variable{}}
+	b.declareLets(program, top)
+	b.walk(program, top)
+
+	return b
+}
+
+type bindingScope struct {
+	outer     *bindingScope
+	function  *ast.FunctionLiteral
+	variables map[string]*Variable
+}
+
+func (sc *bindingScope) lookup(name string) *Variable {
+	for ; sc != nil; sc = sc.outer {
+		if v, ok := sc.variables[name]; ok {
+			return v
+		}
+	}
+
+	return nil
+}
+
+func (b *Bindings) declare(sc *bindingScope, ident *ast.Identifier) *Variable {
+	v, ok := sc.variables[ident.Value]
+	if !ok {
+		v = &Variable{Name: ident.Value, Function: sc.function, Shadows: sc.outer.lookup(ident.Value)}
+		sc.variables[ident.Value] = v
+		b.Variables = append(b.Variables, v)
+	}
+
+	v.Declarations = append(v.Declarations, ident)
+	b.names[ident] = v
+
+	return v
+}
+
+// declareLets declares the names bound by the let statements of node,
+// leaving alone those of nested functions.
+func (b *Bindings) declareLets(node ast.Node, sc *bindingScope) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			if n.Name != nil {
+				v := b.declare(sc, n.Name)
+				v.Lets = append(v.Lets, n)
+			}
+		case *ast.FunctionLiteral:
+			return false
+		}
+		return true
+	})
+}
+
+// walk records the variables read in node.
+func (b *Bindings) walk(node ast.Node, sc *bindingScope) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Identifier:
+			if v := sc.lookup(n.Value); v != nil {
+				v.Uses = append(v.Uses, n)
+				b.names[n] = v
+			}
+		case *ast.LetStatement:
+			// the name bound is not read
+			if n.Value != nil {
+				b.walk(n.Value, sc)
+			}
+			return false
+		case *ast.MemberExpression:
+			// neither is the property
+			if n.Object != nil {
+				b.walk(n.Object, sc)
+			}
+			return false
+		case *ast.FunctionLiteral:
+			b.function(n, sc)
+			return false
+		}
+		return true
+	})
+}
+
+func (b *Bindings) function(fl *ast.FunctionLiteral, outer *bindingScope) {
+	sc := &bindingScope{outer: outer, function: fl, variables: map[string]*Variable{}}
+
+	// parameters come first, so that a let rebinding one is counted as a
+	// declaration of the parameter
+	for _, p := range fl.Parameters {
+		b.declare(sc, p)
+	}
+	if fl.Body != nil {
+		b.declareLets(fl.Body, sc)
+		b.walk(fl.Body, sc)
+	}
+}
@@ -0,0 +1,339 @@
+// Package resolver works out statically where the variable behind every
+// identifier of a program lives, so that evaluation does not have to look
+// names up at run time.
+package resolver
+
+import (
+	"fmt"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/token"
+)
+
+// Resolve annotates every identifier of program with its scope, depth and
+// slot index and every function literal with the layout of its frame.
+// Names bound neither in a function nor by a let statement of the program
+// are globals; those for which defined returns false are reported as
+// errors. A nil defined reports every such name.
+//
+// Resolving modifies the program, so it must happen before the program is
+// shared between goroutines.
+func Resolve(program *ast.Program, defined func(name string) bool) []string {
+	r := &resolver{
+		globals:   map[string]bool{},
+		defined:   defined,
+		undefined: map[string]bool{},
+	}
+
+	r.declareGlobals(program.Statements)
+	for _, s := range program.Statements {
+		r.resolve(s, nil)
+	}
+
+	program.Resolved = true
+
+	return r.errors
+}
+
+type resolver struct {
+	globals   map[string]bool
+	defined   func(name string) bool
+	undefined map[string]bool
+	errors    []string
+}
+
+// binding is a variable of a function. Its slot is only known once the
+// whole function has been resolved, since that is when it is known whether
+// a closure captures it, so the identifiers referring to it are collected
+// until then.
+type binding struct {
+	name     string
+	captured bool
+	refs     []*ast.Identifier
+
+	// bound tells whether the variable is bound on every path to the
+	// point reached by the resolver: parameters always are, lets only
+	// once they ran outside of any branch.
+	bound bool
+}
+
+type scope struct {
+	outer    *scope
+	bindings map[string]*binding
+	order    []*binding
+
+	free      []*ast.Identifier
+	freeIndex map[*binding]int
+	freeDepth []int
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{
+		outer:     outer,
+		bindings:  map[string]*binding{},
+		freeIndex: map[*binding]int{},
+	}
+}
+
+func (sc *scope) declare(name string) *binding {
+	if b, ok := sc.bindings[name]; ok {
+		return b
+	}
+
+	b := &binding{name: name}
+	sc.bindings[name] = b
+	sc.order = append(sc.order, b)
+
+	return b
+}
+
+// lookup returns the binding of name in sc or the closest function
+// enclosing it, and the scope it belongs to. It fails when name is global.
+func (sc *scope) lookup(name string) (*binding, *scope) {
+	for ; sc != nil; sc = sc.outer {
+		if b, ok := sc.bindings[name]; ok {
+			return b, sc
+		}
+	}
+
+	return nil, nil
+}
+
+// capture returns the position of b, a binding of the enclosing function
+// owner, in the free variables of sc and how many functions up it is
+// bound, capturing it from the functions in between on the way.
+func (sc *scope) capture(b *binding, owner *scope, tok token.Token) (index int, depth int) {
+	if i, ok := sc.freeIndex[b]; ok {
+		return i, sc.freeDepth[i]
+	}
+
+	source := &ast.Identifier{Token: tok, Value: b.name}
+	if sc.outer == owner {
+		b.captured = true
+		b.refs = append(b.refs, source)
+		depth = 1
+	} else {
+		i, d := sc.outer.capture(b, owner, tok)
+		source.Scope = ast.Free
+		source.Index = i
+		source.Depth = d
+		depth = d + 1
+	}
+
+	index = len(sc.free)
+	sc.free = append(sc.free, source)
+	sc.freeIndex[b] = index
+	sc.freeDepth = append(sc.freeDepth, depth)
+
+	return index, depth
+}
+
+// unbound returns the variables of sc that are not bound yet.
+func (sc *scope) unbound() []*binding {
+	var unbound []*binding
+	for _, b := range sc.order {
+		if !b.bound {
+			unbound = append(unbound, b)
+		}
+	}
+
+	return unbound
+}
+
+func (r *resolver) resolve(node ast.Node, sc *scope) {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		r.resolve(node.Expression, sc)
+	case *ast.LetStatement:
+		r.resolve(node.Value, sc)
+		r.bind(node.Name, sc)
+	case *ast.ReturnStatement:
+		r.resolve(node.ReturnValue, sc)
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			r.resolve(s, sc)
+		}
+	case *ast.IfExpression:
+		r.resolve(node.Condition, sc)
+		r.branch(node.Consequence, sc)
+		if node.Alternative != nil {
+			r.branch(node.Alternative, sc)
+		}
+	case *ast.PrefixExpression:
+		r.resolve(node.Right, sc)
+	case *ast.InfixExpression:
+		r.resolve(node.Left, sc)
+		r.resolve(node.Right, sc)
+	case *ast.CallExpression:
+		r.resolve(node.Function, sc)
+		for _, a := range node.Arguments {
+			r.resolve(a, sc)
+		}
+	case *ast.MemberExpression:
+		r.resolve(node.Object, sc)
+	case *ast.FunctionLiteral:
+		r.resolveFunction(node, sc)
+	case *ast.Identifier:
+		r.resolveIdentifier(node, sc)
+	}
+}
+
+// branch resolves a block that may not run. The lets it runs leave their
+// variables unbound after it.
+func (r *resolver) branch(block *ast.BlockStatement, sc *scope) {
+	if sc == nil {
+		r.resolve(block, sc)
+		return
+	}
+
+	unbound := sc.unbound()
+	r.resolve(block, sc)
+	for _, b := range unbound {
+		b.bound = false
+	}
+}
+
+// bind resolves the name a let statement binds.
+func (r *resolver) bind(ident *ast.Identifier, sc *scope) {
+	if sc == nil {
+		r.global(ident)
+		return
+	}
+
+	b := sc.bindings[ident.Value]
+	b.refs = append(b.refs, ident)
+	ident.Shadowed = nil
+	b.bound = true
+}
+
+func (r *resolver) resolveIdentifier(ident *ast.Identifier, sc *scope) {
+	b, owner := sc.lookup(ident.Value)
+	if b == nil {
+		r.global(ident)
+		return
+	}
+
+	refer(ident, sc, b, owner)
+}
+
+// refer resolves ident, read in sc, to b, a binding of owner. Until a let
+// binds its variable, reading the variable reads the one it shadows, as if
+// every function had an environment of its own falling back on the one of
+// the enclosing function, so an identifier that may be read before that
+// is given the identifier to fall back on.
+func refer(ident *ast.Identifier, sc *scope, b *binding, owner *scope) {
+	ident.Shadowed = nil
+	if owner == sc {
+		b.refs = append(b.refs, ident)
+	} else {
+		ident.Scope = ast.Free
+		ident.Index, ident.Depth = sc.capture(b, owner, ident.Token)
+	}
+
+	if b.bound {
+		return
+	}
+
+	shadowed := &ast.Identifier{Token: ident.Token, Value: ident.Value, Scope: ast.Global}
+	if b, outer := owner.outer.lookup(ident.Value); b != nil {
+		refer(shadowed, sc, b, outer)
+	}
+	ident.Shadowed = shadowed
+}
+
+func (r *resolver) global(ident *ast.Identifier) {
+	ident.Scope = ast.Global
+	ident.Index = 0
+	ident.Depth = 0
+	ident.Shadowed = nil
+
+	if r.globals == nil || r.globals[ident.Value] || r.undefined[ident.Value] {
+		return
+	}
+	if r.defined != nil && r.defined(ident.Value) {
+		return
+	}
+
+	r.undefined[ident.Value] = true
+	r.errors = append(r.errors, fmt.Sprintf("identifier not found: %s", ident.Value))
+}
+
+func (r *resolver) resolveFunction(fl *ast.FunctionLiteral, outer *scope) {
+	sc := newScope(outer)
+
+	for _, p := range fl.Parameters {
+		b := sc.declare(p.Value)
+		b.refs = append(b.refs, p)
+		b.bound = true
+	}
+	declare(fl.Body.Statements, func(name string) { sc.declare(name) })
+
+	r.resolve(fl.Body, sc)
+
+	layout := &ast.FrameLayout{Free: sc.free}
+	for _, b := range sc.order {
+		scope, index := ast.Local, len(layout.Locals)
+		if b.captured {
+			scope, index = ast.Cell, len(layout.Cells)
+		}
+
+		for _, ref := range b.refs {
+			ref.Scope = scope
+			ref.Index = index
+			ref.Depth = 0
+		}
+
+		if b.captured {
+			layout.Cells = append(layout.Cells, b.name)
+		} else {
+			layout.Locals = append(layout.Locals, b.name)
+		}
+	}
+
+	fl.Layout = layout
+}
+
+func (r *resolver) declareGlobals(statements []ast.Statement) {
+	declare(statements, func(name string) { r.globals[name] = true })
+}
+
+// declare calls define for every name bound by a let statement in
+// statements. Blocks don't open a new scope, so lets nested in if
+// expressions count as well, while function literals are left alone.
+func declare(statements []ast.Statement, define func(name string)) {
+	for _, s := range statements {
+		declareNode(s, define)
+	}
+}
+
+func declareNode(node ast.Node, define func(name string)) {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		define(node.Name.Value)
+		declareNode(node.Value, define)
+	case *ast.ReturnStatement:
+		declareNode(node.ReturnValue, define)
+	case *ast.ExpressionStatement:
+		declareNode(node.Expression, define)
+	case *ast.BlockStatement:
+		declare(node.Statements, define)
+	case *ast.IfExpression:
+		declareNode(node.Condition, define)
+		declareNode(node.Consequence, define)
+		if node.Alternative != nil {
+			declareNode(node.Alternative, define)
+		}
+	case *ast.PrefixExpression:
+		declareNode(node.Right, define)
+	case *ast.InfixExpression:
+		declareNode(node.Left, define)
+		declareNode(node.Right, define)
+	case *ast.CallExpression:
+		declareNode(node.Function, define)
+		for _, a := range node.Arguments {
+			declareNode(a, define)
+		}
+	case *ast.MemberExpression:
+		declareNode(node.Object, define)
+	}
+}
@@ -0,0 +1,228 @@
+package resolver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	return program
+}
+
+func TestResolveScopes(t *testing.T) {
+	input := `
+    let g = 1;
+    let outer = fn(a, b) {
+      let middle = fn() {
+        let inner = fn(c) { a + c + g };
+        inner
+      };
+      b
+    };
+  `
+	program := parse(t, input)
+
+	if errors := Resolve(program, nil); len(errors) != 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+
+	if !program.Resolved {
+		t.Errorf("program not marked as resolved")
+	}
+
+	outer := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	assertLayout(t, "outer", outer.Layout, []string{"b", "middle"}, []string{"a"}, 0)
+
+	middleLet := outer.Body.Statements[0].(*ast.LetStatement)
+	middle := middleLet.Value.(*ast.FunctionLiteral)
+	assertLayout(t, "middle", middle.Layout, []string{"inner"}, nil, 1)
+	assertIdentifier(t, middleLet.Name, ast.Local, 0, 1)
+	assertIdentifier(t, middle.Layout.Free[0], ast.Cell, 0, 0)
+
+	inner := middle.Body.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	assertLayout(t, "inner", inner.Layout, []string{"c"}, nil, 1)
+	assertIdentifier(t, inner.Layout.Free[0], ast.Free, 1, 0)
+
+	sum := inner.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	left := sum.Left.(*ast.InfixExpression)
+	assertIdentifier(t, left.Left.(*ast.Identifier), ast.Free, 2, 0)
+	assertIdentifier(t, left.Right.(*ast.Identifier), ast.Local, 0, 0)
+	assertIdentifier(t, sum.Right.(*ast.Identifier), ast.Global, 0, 0)
+
+	returned := middle.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.Identifier)
+	assertIdentifier(t, returned, ast.Local, 0, 0)
+}
+
+func TestResolveHoistsLets(t *testing.T) {
+	program := parse(t, "fn() { let f = fn() { later }; let later = 1; f() }")
+	Resolve(program, nil)
+
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	assertLayout(t, "fn", fn.Layout, []string{"f"}, []string{"later"}, 0)
+}
+
+func TestResolveShadowed(t *testing.T) {
+	program := parse(t, "let x = 1; fn(b) { let y = x; if (b) { let z = 1; } let x = 2; x + z }")
+	Resolve(program, nil)
+
+	fn := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	assertLayout(t, "fn", fn.Layout, []string{"b", "y", "z", "x"}, nil, 0)
+
+	before := fn.Body.Statements[0].(*ast.LetStatement).Value.(*ast.Identifier)
+	assertIdentifier(t, before, ast.Local, 0, 3)
+	if before.Shadowed == nil {
+		t.Fatalf("x read before its let does not fall back on the global")
+	}
+	assertIdentifier(t, before.Shadowed, ast.Global, 0, 0)
+
+	sum := fn.Body.Statements[3].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	if sum.Left.(*ast.Identifier).Shadowed != nil {
+		t.Errorf("x read after its let falls back on the global")
+	}
+	if sum.Right.(*ast.Identifier).Shadowed == nil {
+		t.Errorf("z bound in a branch does not fall back on the global")
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	input := `
+    let defined = 1;
+    let f = fn(x) { x + defined + missing + builtin };
+    missing;
+    if (true) { let nested = 1; }
+    nested;
+  `
+	errors := Resolve(parse(t, input), func(name string) bool { return name == "builtin" })
+
+	expected := []string{"identifier not found: missing"}
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. want=%v, got=%v", expected, errors)
+	}
+	for i, msg := range expected {
+		if errors[i] != msg {
+			t.Errorf("wrong error %d. want=%q, got=%q", i, msg, errors[i])
+		}
+	}
+}
+
+func assertLayout(t *testing.T, name string, layout *ast.FrameLayout, locals, cells []string, free int) {
+	t.Helper()
+
+	if layout == nil {
+		t.Fatalf("%s: layout not set", name)
+	}
+	if !equal(layout.Locals, locals) {
+		t.Errorf("%s: wrong locals. want=%v, got=%v", name, locals, layout.Locals)
+	}
+	if !equal(layout.Cells, cells) {
+		t.Errorf("%s: wrong cells. want=%v, got=%v", name, cells, layout.Cells)
+	}
+	if len(layout.Free) != free {
+		t.Errorf("%s: wrong number of free variables. want=%d, got=%d", name, free, len(layout.Free))
+	}
+}
+
+func assertIdentifier(t *testing.T, ident *ast.Identifier, scope ast.Scope, depth, index int) {
+	t.Helper()
+
+	if ident.Scope != scope || ident.Depth != depth || ident.Index != index {
+		t.Errorf("%s: wrong resolution. want=%s depth=%d index=%d, got=%s depth=%d index=%d",
+			ident.Value, scope, depth, index, ident.Scope, ident.Depth, ident.Index)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestBind(t *testing.T) {
+	input := `let g = 1;
+let f = fn(a, b) {
+  if (a) { let g = a.b; g } else { b(f) }
+};
+f(g, h);`
+	program := parse(t, input)
+	bindings := Bind(program)
+
+	// variable: function holding it, declarations, uses, shadowed one
+	describe := func(v *Variable) string {
+		where := "global"
+		if v.Function != nil {
+			where = "in " + v.Function.Name
+		}
+		out := v.Name + " " + where + ":"
+		for _, d := range v.Declarations {
+			out += " " + d.Pos().String()
+		}
+		out += " uses"
+		for _, u := range v.Uses {
+			out += " " + u.Pos().String()
+		}
+		if v.Shadows != nil {
+			out += " shadows " + v.Shadows.Declarations[0].Pos().String()
+		}
+		return out
+	}
+
+	expected := []string{
+		"g global: 1:5 uses 5:3",
+		"f global: 2:5 uses 3:38 5:1",
+		"a in f: 2:12 uses 3:7 3:20",
+		"b in f: 2:15 uses 3:36",
+		"g in f: 3:16 uses 3:25 shadows 1:5",
+	}
+
+	if len(bindings.Variables) != len(expected) {
+		t.Fatalf("wrong number of variables. expected=%d, got=%d", len(expected), len(bindings.Variables))
+	}
+	for i, v := range bindings.Variables {
+		if got := describe(v); got != expected[i] {
+			t.Errorf("variables[%d] wrong. expected=%q, got=%q", i, expected[i], got)
+		}
+		for _, ident := range append(append([]*ast.Identifier{}, v.Declarations...), v.Uses...) {
+			if bindings.Lookup(ident) != v {
+				t.Errorf("identifier at %s not bound to %s", ident.Pos(), v.Name)
+			}
+		}
+	}
+	if !bindings.Variables[2].IsParameter() || bindings.Variables[4].IsParameter() {
+		t.Errorf("wrong parameters")
+	}
+
+	visible := func(offset int) string {
+		var names []string
+		for _, v := range bindings.Visible(offset) {
+			d := describe(v)
+			names = append(names, d[:strings.Index(d, ":")])
+		}
+		return strings.Join(names, ",")
+	}
+	// inside f, where its g hides the global one
+	if got := visible(30); got != "g in f,b in f,a in f,f global" {
+		t.Errorf("wrong variables visible in f. got=%q", got)
+	}
+	if got := visible(len(input) - 1); got != "f global,g global" {
+		t.Errorf("wrong variables visible at the top level. got=%q", got)
+	}
+}
@@ -0,0 +1,213 @@
+package testrunner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cupsadarius/monkey_interpreter/interpreter"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+// assertionPrefix starts the message of every failed assertion, which
+// tells failures apart from other errors of a test.
+const assertionPrefix = "assertion failed: "
+
+func failure(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: assertionPrefix + fmt.Sprintf(format, a...)}
+}
+
+// assertions returns the assertion builtins for tests run by i.
+func assertions(i *interpreter.Interpreter) []*object.Builtin {
+	return []*object.Builtin{
+		{Name: "assert", Fn: assert},
+		{Name: "assertEqual", Fn: assertEqual},
+		{
+			Name: "assertError",
+			Fn: func(args ...object.Object) object.Object {
+				return assertError(context.Background(), i, args...)
+			},
+			FnContext: func(ctx context.Context, args ...object.Object) object.Object {
+				return assertError(ctx, i, args...)
+			},
+		},
+	}
+}
+
+// assert(condition) and assert(condition, message) fail unless condition is
+// truthy.
+func assert(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return failure("assert takes a condition and an optional message, got %d arguments", len(args))
+	}
+
+	if truthy(args[0]) {
+		return object.NULL
+	}
+
+	if len(args) == 2 {
+		return failure("%s", message(args[1]))
+	}
+	return failure("expected a truthy value, got %s", describe(args[0]))
+}
+
+// assertEqual(expected, actual) and assertEqual(expected, actual, message)
+// fail unless both values are of the same type and equal.
+func assertEqual(args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return failure("assertEqual takes the expected and the actual value and an optional message, got %d arguments", len(args))
+	}
+
+	expected, actual := args[0], args[1]
+	if equal(expected, actual) {
+		return object.NULL
+	}
+
+	var out strings.Builder
+	if len(args) == 3 {
+		out.WriteString(message(args[2]))
+	} else {
+		out.WriteString("values differ")
+	}
+	out.WriteString("\n")
+	out.WriteString(diff(expected, actual))
+
+	return failure("%s", out.String())
+}
+
+// assertError(fn) and assertError(fn, substring) call fn without arguments
+// and fail unless it results in an error, whose message has to contain
+// substring if given. The call is charged to the evaluation ctx belongs to.
+func assertError(ctx context.Context, i *interpreter.Interpreter, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return failure("assertError takes a function and an optional message, got %d arguments", len(args))
+	}
+
+	switch args[0].(type) {
+	case *object.Function, *object.Builtin:
+	default:
+		return failure("assertError takes a function, got %s", describe(args[0]))
+	}
+
+	result, err := i.CallObjectContext(ctx, args[0])
+	if err == nil {
+		return failure("expected an error, got %s", describe(result))
+	}
+
+	runtimeErr, ok := err.(*interpreter.RuntimeError)
+	if !ok {
+		// limits and cancellation are not what a test can expect
+		return &object.Error{Message: err.Error()}
+	}
+	if strings.HasPrefix(runtimeErr.Message, assertionPrefix) {
+		return &object.Error{Message: runtimeErr.Message}
+	}
+
+	if len(args) == 2 {
+		want := message(args[1])
+		if !strings.Contains(runtimeErr.Message, want) {
+			return failure("expected an error containing %q, got %q", want, runtimeErr.Message)
+		}
+	}
+
+	return object.NULL
+}
+
+// orNull returns obj, or NULL for the nothing a function with an empty
+// body evaluates to.
+func orNull(obj object.Object) object.Object {
+	if obj == nil {
+		return object.NULL
+	}
+
+	return obj
+}
+
+func truthy(obj object.Object) bool {
+	switch orNull(obj) {
+	case object.NULL, object.FALSE:
+		return false
+	}
+
+	return true
+}
+
+func equal(expected, actual object.Object) bool {
+	expected, actual = orNull(expected), orNull(actual)
+	if expected.Type() != actual.Type() {
+		return false
+	}
+
+	switch expected.(type) {
+	case *object.Function, *object.Builtin:
+		return expected == actual
+	}
+
+	return expected.Inspect() == actual.Inspect()
+}
+
+// message returns the text of a message argument.
+func message(obj object.Object) string {
+	if str, ok := obj.(*object.String); ok {
+		return str.Value
+	}
+
+	return orNull(obj).Inspect()
+}
+
+// describe returns obj the way it would be written in Monkey, with its type.
+func describe(obj object.Object) string {
+	obj = orNull(obj)
+	if str, ok := obj.(*object.String); ok {
+		return fmt.Sprintf("%q (STRING)", str.Value)
+	}
+
+	return fmt.Sprintf("%s (%s)", obj.Inspect(), obj.Type())
+}
+
+// diff shows how actual differs from expected. Strings of a single line
+// get a marker under the first character that differs, strings of several
+// lines a line by line comparison.
+func diff(expected, actual object.Object) string {
+	want, wantOk := expected.(*object.String)
+	got, gotOk := actual.(*object.String)
+
+	if wantOk && gotOk && (strings.Contains(want.Value, "\n") || strings.Contains(got.Value, "\n")) {
+		return lineDiff(want.Value, got.Value)
+	}
+
+	out := fmt.Sprintf("expected: %s\nactual:   %s", describe(expected), describe(actual))
+
+	if wantOk && gotOk {
+		w, g := fmt.Sprintf("%q", want.Value), fmt.Sprintf("%q", got.Value)
+		i := 0
+		for i < len(w) && i < len(g) && w[i] == g[i] {
+			i++
+		}
+		out += "\n          " + strings.Repeat(" ", i) + "^"
+	}
+
+	return out
+}
+
+func lineDiff(expected, actual string) string {
+	want := strings.Split(expected, "\n")
+	got := strings.Split(actual, "\n")
+
+	var out []string
+	out = append(out, "--- expected", "+++ actual")
+	for i := 0; i < len(want) || i < len(got); i++ {
+		switch {
+		case i >= len(got):
+			out = append(out, "- "+want[i])
+		case i >= len(want):
+			out = append(out, "+ "+got[i])
+		case want[i] == got[i]:
+			out = append(out, "  "+want[i])
+		default:
+			out = append(out, "- "+want[i], "+ "+got[i])
+		}
+	}
+
+	return strings.Join(out, "\n")
+}
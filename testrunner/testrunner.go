@@ -0,0 +1,328 @@
+// Package testrunner runs unit tests written in Monkey. Tests live in files
+// named *_test.mk; every top-level function bound by a let statement whose
+// name starts with "test" is a test. Each test runs in a fresh global
+// environment, in which the file is evaluated first and the test function
+// called afterwards with no arguments. A test fails when it results in an
+// error, which is what the assertion builtins return when they fail.
+package testrunner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/interpreter"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+// DefaultTimeout bounds the time a single test may take.
+const DefaultTimeout = 10 * time.Second
+
+// Find returns the test files among paths, searching directories
+// recursively, sorted by name.
+func Find(paths ...string) ([]string, error) {
+	var files []string
+
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), "_test.mk") {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// Result is the outcome of a single test.
+type Result struct {
+	File     string
+	Name     string
+	Passed   bool
+	Line     int    // of the statement that failed
+	Message  string // why the test failed
+	Duration time.Duration
+}
+
+// Summary counts the tests run.
+type Summary struct {
+	Passed, Failed int
+	Duration       time.Duration
+}
+
+// Runner runs test files and reports their results.
+type Runner struct {
+	out     io.Writer
+	verbose bool
+	filter  *regexp.Regexp
+	timeout time.Duration
+}
+
+type Option func(*Runner)
+
+// WithVerbose makes the runner report every test rather than only those
+// that failed.
+func WithVerbose() Option {
+	return func(r *Runner) {
+		r.verbose = true
+	}
+}
+
+// WithFilter restricts the tests run to those whose names match filter.
+func WithFilter(filter *regexp.Regexp) Option {
+	return func(r *Runner) {
+		r.filter = filter
+	}
+}
+
+// WithTimeout sets the time a single test may take.
+func WithTimeout(timeout time.Duration) Option {
+	return func(r *Runner) {
+		r.timeout = timeout
+	}
+}
+
+// New returns a runner reporting to out.
+func New(out io.Writer, opts ...Option) *Runner {
+	r := &Runner{out: out, timeout: DefaultTimeout}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Run runs the tests of files and reports their results and a summary.
+// Files that cannot be read or parsed count as a single failed test.
+func (r *Runner) Run(files []string) Summary {
+	var total Summary
+	start := time.Now()
+
+	for _, file := range files {
+		fileStart := time.Now()
+
+		results, err := r.RunFile(file)
+		if err != nil {
+			results = []Result{{File: file, Message: err.Error()}}
+		}
+
+		var s Summary
+		for _, result := range results {
+			r.report(result)
+			if result.Passed {
+				s.Passed++
+			} else {
+				s.Failed++
+			}
+		}
+		s.Duration = time.Since(fileStart)
+
+		status := "ok  "
+		if s.Failed > 0 {
+			status = "FAIL"
+		}
+		fmt.Fprintf(r.out, "%s %s\t%d passed, %d failed\t%s\n", status, file, s.Passed, s.Failed, s.Duration.Round(time.Microsecond))
+
+		total.Passed += s.Passed
+		total.Failed += s.Failed
+	}
+
+	total.Duration = time.Since(start)
+
+	status := "PASS"
+	if total.Failed > 0 {
+		status = "FAIL"
+	}
+	fmt.Fprintf(r.out, "%s: %d passed, %d failed, %d total in %s\n",
+		status, total.Passed, total.Failed, total.Passed+total.Failed, total.Duration.Round(time.Microsecond))
+
+	return total
+}
+
+func (r *Runner) report(result Result) {
+	name := result.Name
+	if name == "" {
+		name = "(file)"
+	}
+
+	if result.Passed {
+		if r.verbose {
+			fmt.Fprintf(r.out, "--- PASS: %s (%s)\n", name, result.Duration.Round(time.Microsecond))
+		}
+		return
+	}
+
+	fmt.Fprintf(r.out, "--- FAIL: %s (%s)\n", name, result.Duration.Round(time.Microsecond))
+
+	// errors of whole files name the file themselves
+	location := ""
+	switch {
+	case result.Line > 0:
+		location = fmt.Sprintf("%s:%d: ", result.File, result.Line)
+	case result.Name != "":
+		location = result.File + ": "
+	}
+	lines := strings.Split(result.Message, "\n")
+	fmt.Fprintf(r.out, "    %s%s\n", location, lines[0])
+	for _, line := range lines[1:] {
+		fmt.Fprintf(r.out, "        %s\n", line)
+	}
+}
+
+// RunFile runs the tests of a single file. It fails if the file cannot be
+// read or parsed.
+func (r *Runner) RunFile(path string) ([]Result, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	program, err := interpreter.Compile(string(source))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	names := r.tests(program.AST())
+	results := make([]Result, len(names))
+	for i, name := range names {
+		results[i] = r.runTest(path, program, name)
+	}
+
+	return results, nil
+}
+
+// tests returns the names of the tests defined in program, in order.
+func (r *Runner) tests(program *ast.Program) []string {
+	var names []string
+	for _, s := range program.Statements {
+		let, ok := s.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name.Value, "test") {
+			continue
+		}
+		if _, ok := let.Value.(*ast.FunctionLiteral); !ok {
+			continue
+		}
+		if r.filter != nil && !r.filter.MatchString(let.Name.Value) {
+			continue
+		}
+		names = append(names, let.Name.Value)
+	}
+
+	return names
+}
+
+func (r *Runner) runTest(path string, program *interpreter.Program, name string) Result {
+	result := Result{File: path, Name: name}
+	lines := &lineTracker{}
+
+	// evaluating the file, calling the test and the callbacks of its
+	// assertions are all charged to one meter, so the timeout bounds them
+	// together
+	meter := evaluator.NewMeter(context.Background(), evaluator.Limits{MaxDuration: r.timeout})
+	i := interpreter.New(
+		interpreter.WithHook(lines),
+		interpreter.WithContext(meter.Context()),
+	)
+	for _, builtin := range assertions(i) {
+		i.Environment().Set(builtin.Name, builtin)
+	}
+
+	start := time.Now()
+	err := r.call(i, program, name)
+	result.Duration = time.Since(start)
+
+	if err == nil {
+		result.Passed = true
+		return result
+	}
+
+	if lines.failed {
+		result.Line = lines.line
+	}
+	result.Message = err.Error()
+	if runtimeErr, ok := err.(*interpreter.RuntimeError); ok {
+		result.Message = strings.TrimPrefix(runtimeErr.Message, assertionPrefix)
+	}
+
+	return result
+}
+
+func (r *Runner) call(i *interpreter.Interpreter, program *interpreter.Program, name string) error {
+	if _, err := i.Exec(program); err != nil {
+		return err
+	}
+
+	fn, ok := i.Environment().Get(name)
+	if !ok {
+		return fmt.Errorf("%s is not defined", name)
+	}
+
+	_, err := i.CallObject(fn)
+	return err
+}
+
+// lineTracker follows the line of the statement being evaluated in each
+// function called and remembers where the first error of a test appeared,
+// which for a failed assertion is the statement calling it. Errors that are
+// handled, as by assertError, are forgotten once the next statement starts.
+type lineTracker struct {
+	lines  []int // of the statement being evaluated, per call
+	line   int   // where the error appeared
+	failed bool
+}
+
+func (l *lineTracker) OnNodeEnter(node ast.Node, scope evaluator.Scope) {
+	var line int
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		line = node.Token.Line
+	case *ast.LetStatement:
+		line = node.Token.Line
+	case *ast.ReturnStatement:
+		line = node.Token.Line
+	default:
+		return
+	}
+
+	if len(l.lines) == 0 {
+		l.lines = append(l.lines, 0)
+	}
+	l.lines[len(l.lines)-1] = line
+	l.failed = false
+}
+
+func (l *lineTracker) OnNodeExit(node ast.Node, result object.Object) {
+	if _, ok := result.(*object.Error); ok && !l.failed && len(l.lines) > 0 {
+		l.line = l.lines[len(l.lines)-1]
+		l.failed = true
+	}
+}
+
+func (l *lineTracker) OnCall(fn object.Object, args []object.Object) {
+	l.lines = append(l.lines, 0)
+}
+
+func (l *lineTracker) OnReturn(fn object.Object, result object.Object) {
+	if len(l.lines) > 0 {
+		l.lines = l.lines[:len(l.lines)-1]
+	}
+}
@@ -0,0 +1,271 @@
+package testrunner
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/interpreter"
+)
+
+func writeTestFile(t *testing.T, dir, name, source string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "b_test.mk", "")
+	writeTestFile(t, dir, "a_test.mk", "")
+	writeTestFile(t, dir, "a.mk", "")
+	writeTestFile(t, dir, "nested/c_test.mk", "")
+
+	files, err := Find(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		filepath.Join(dir, "a_test.mk"),
+		filepath.Join(dir, "b_test.mk"),
+		filepath.Join(dir, "nested/c_test.mk"),
+	}
+	if strings.Join(files, ",") != strings.Join(expected, ",") {
+		t.Errorf("wrong files. expected=%v, got=%v", expected, files)
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "math_test.mk", `let add = fn(a, b) { a + b };
+
+let testAdd = fn() {
+  assertEqual(3, add(1, 2));
+  assert(add(1, 1) == 2, "one and one");
+};
+
+let testFails = fn() {
+  let x = add(2, 2);
+  assertEqual(5, x);
+};
+
+let testErrors = fn() {
+  assertError(fn() { 1 + true }, "type mismatch");
+};
+
+let testRuntimeError = fn() {
+  let y = add(1, "a");
+  y;
+};
+
+let helper = fn() { assert(false) };
+let testing = 1;
+`)
+
+	results, err := New(&bytes.Buffer{}).RunFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		passed  bool
+		line    int
+		message string
+	}{
+		{"testAdd", true, 0, ""},
+		{"testFails", false, 10, "values differ\nexpected: 5 (INTEGER)\nactual:   4 (INTEGER)"},
+		{"testErrors", true, 0, ""},
+		{"testRuntimeError", false, 1, "type mismatch: INTEGER + STRING"},
+	}
+
+	if len(results) != len(tests) {
+		t.Fatalf("wrong number of results. expected=%d, got=%d", len(tests), len(results))
+	}
+
+	for i, tt := range tests {
+		r := results[i]
+		if r.Name != tt.name {
+			t.Errorf("results[%d] has wrong name. expected=%q, got=%q", i, tt.name, r.Name)
+		}
+		if r.Passed != tt.passed {
+			t.Errorf("%s: wrong outcome. expected=%t, got=%t (%s)", tt.name, tt.passed, r.Passed, r.Message)
+		}
+		if r.Line != tt.line {
+			t.Errorf("%s: wrong line. expected=%d, got=%d", tt.name, tt.line, r.Line)
+		}
+		if r.Message != tt.message {
+			t.Errorf("%s: wrong message. expected=%q, got=%q", tt.name, tt.message, r.Message)
+		}
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		body    string
+		message string
+	}{
+		{`assert(true)`, ""},
+		{`assert(0)`, ""},
+		{`assert(false)`, "expected a truthy value, got false (BOOLEAN)"},
+		{`assert(if (false) { 1 })`, "expected a truthy value, got null (NULL)"},
+		{`assert(1 > 2, "one is not bigger")`, "one is not bigger"},
+		{`assert(fn() {}())`, "expected a truthy value, got null (NULL)"},
+		{`assert(false, fn() {}())`, "null"},
+		{`assert()`, "assert takes a condition and an optional message, got 0 arguments"},
+		{`assertEqual("ab", "a" + "b")`, ""},
+		{`assertEqual(true, 1 < 2)`, ""},
+		{`assertEqual(1, "1")`, "values differ\nexpected: 1 (INTEGER)\nactual:   \"1\" (STRING)"},
+		{`assertEqual(fn() {}(), if (false) { 1 })`, ""},
+		{`assertEqual(fn() {}(), 1)`, "values differ\nexpected: null (NULL)\nactual:   1 (INTEGER)"},
+		{`assertEqual(1, fn() {}())`, "values differ\nexpected: 1 (INTEGER)\nactual:   null (NULL)"},
+		{`assertEqual(1, 2, "sum")`, "sum\nexpected: 1 (INTEGER)\nactual:   2 (INTEGER)"},
+		{`assertEqual("monkey", "donkey")`, "values differ\nexpected: \"monkey\" (STRING)\nactual:   \"donkey\" (STRING)\n           ^"},
+		{`assertEqual("ab", "abc")`, "values differ\nexpected: \"ab\" (STRING)\nactual:   \"abc\" (STRING)\n             ^"},
+		{"assertEqual(\"a\nb\nc\", \"a\nx\nc\nd\")", "values differ\n--- expected\n+++ actual\n  a\n- b\n+ x\n  c\n+ d"},
+		{`assertEqual(fn() {}, fn() {})`, "values differ\nexpected: fn() {\n\n} (FUNCTION)\nactual:   fn() {\n\n} (FUNCTION)"},
+		{`assertError(fn() { -true })`, ""},
+		{`assertError(fn() { -true }, "unknown operator")`, ""},
+		{`assertError(fn() { -true }, "type mismatch")`, "expected an error containing \"type mismatch\", got \"unknown operator: -BOOLEAN\""},
+		{`assertError(fn() { 1 })`, "expected an error, got 1 (INTEGER)"},
+		{`assertError(fn() {})`, "expected an error, got null (NULL)"},
+		{`assertError(fn() { assert(false, "inner") })`, "inner"},
+		{`assertError(1)`, "assertError takes a function, got 1 (INTEGER)"},
+	}
+
+	for _, tt := range tests {
+		source := "let testAssertion = fn() {\n  " + tt.body + ";\n};\n"
+		path := writeTestFile(t, t.TempDir(), "assertion_test.mk", source)
+
+		results, err := New(&bytes.Buffer{}).RunFile(path)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.body, err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("%s: wrong number of results. expected=1, got=%d", tt.body, len(results))
+		}
+
+		r := results[0]
+		if r.Passed != (tt.message == "") {
+			t.Errorf("%s: wrong outcome. expected=%t, got=%t", tt.body, tt.message == "", r.Passed)
+		}
+		if r.Message != tt.message {
+			t.Errorf("%s: wrong message. expected=%q, got=%q", tt.body, tt.message, r.Message)
+		}
+	}
+}
+
+func TestAssertErrorChargesTheTest(t *testing.T) {
+	i := interpreter.New()
+	fn, err := i.Run("fn() { let loop = fn(n) { if (n > 0) { loop(n - 1) } }; loop(100) }")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the test calling assertError has used up its steps
+	ctx := evaluator.NewMeter(context.Background(), evaluator.Limits{MaxSteps: 10}).Context()
+
+	result := assertError(ctx, i, fn)
+	if result.Inspect() != "ERROR: "+evaluator.ErrStepLimitExceeded.Error() {
+		t.Errorf("callback not charged to the test. got=%s", result.Inspect())
+	}
+}
+
+func TestFailingTopLevel(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "top_test.mk", `let one = 1;
+let broken = one + true;
+
+let testFirst = fn() { assert(true) };
+let testSecond = fn() { assert(true) };
+`)
+
+	results, err := New(&bytes.Buffer{}).RunFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("wrong number of results. expected=2, got=%d", len(results))
+	}
+	for _, r := range results {
+		if r.Passed || r.Line != 2 || r.Message != "type mismatch: INTEGER + BOOLEAN" {
+			t.Errorf("%s: wrong result. expected failure at line 2, got passed=%t line=%d message=%q",
+				r.Name, r.Passed, r.Line, r.Message)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	passing := writeTestFile(t, dir, "a_test.mk", `let testOne = fn() { assert(true) };
+let testTwo = fn() { assert(true) };
+`)
+	failing := writeTestFile(t, dir, "b_test.mk", `let testOne = fn() {
+  assert(false, "broken");
+};
+`)
+	broken := writeTestFile(t, dir, "c_test.mk", `let testOne = fn( {;`)
+
+	tests := []struct {
+		opts     []Option
+		passed   int
+		failed   int
+		contains []string
+		excludes []string
+	}{
+		{
+			nil, 2, 2,
+			[]string{
+				"--- FAIL: testOne (",
+				"    " + failing + ":2: broken\n",
+				"ok   " + passing + "\t2 passed, 0 failed\t",
+				"FAIL " + failing + "\t0 passed, 1 failed\t",
+				"--- FAIL: (file) (",
+				"    " + broken + ": parse error: ",
+				"FAIL: 2 passed, 2 failed, 4 total in ",
+			},
+			[]string{"--- PASS"},
+		},
+		{
+			[]Option{WithVerbose(), WithFilter(regexp.MustCompile("Two"))}, 1, 1,
+			[]string{
+				"--- PASS: testTwo (",
+				"ok   " + failing + "\t0 passed, 0 failed\t",
+			},
+			[]string{"testOne"},
+		},
+	}
+
+	for i, tt := range tests {
+		var out bytes.Buffer
+		summary := New(&out, tt.opts...).Run([]string{passing, failing, broken})
+
+		if summary.Passed != tt.passed || summary.Failed != tt.failed {
+			t.Errorf("tests[%d]: wrong summary. expected %d passed, %d failed, got %d passed, %d failed",
+				i, tt.passed, tt.failed, summary.Passed, summary.Failed)
+		}
+		for _, s := range tt.contains {
+			if !strings.Contains(out.String(), s) {
+				t.Errorf("tests[%d]: output does not contain %q:\n%s", i, s, out.String())
+			}
+		}
+		for _, s := range tt.excludes {
+			if strings.Contains(out.String(), s) {
+				t.Errorf("tests[%d]: output contains %q:\n%s", i, s, out.String())
+			}
+		}
+	}
+}
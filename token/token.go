@@ -1,20 +1,64 @@
 package token
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 type TokenType string
 
 type Token struct {
-	Type    TokenType
-	Literal string
-	Line    int
-	Column  int
+	Type    TokenType `json:"type"`
+	Literal string    `json:"literal"`
+	Line    int       `json:"line"`   // of the first character, counted from 1
+	Column  int       `json:"column"` // of the first character, counted in bytes from 1
+	Offset  int       `json:"offset"` // byte offset of the first character
+}
+
+// Position is a place in source code.
+type Position struct {
+	Offset int `json:"offset"` // in bytes, counted from 0
+	Line   int `json:"line"`   // counted from 1
+	Column int `json:"column"` // in bytes, counted from 1
+}
+
+// IsValid tells whether the position is known.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Pos returns the position of the first character of the token.
+func (t Token) Pos() Position {
+	return Position{Offset: t.Offset, Line: t.Line, Column: t.Column}
+}
+
+// End returns the position just past the last character of the token.
+func (t Token) End() Position {
+	text := t.Literal
+	if t.Type == STRING {
+		text = `"` + text + `"`
+	}
+
+	end := Position{Offset: t.Offset + len(text), Line: t.Line, Column: t.Column + len(text)}
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		end.Line += strings.Count(text, "\n")
+		end.Column = len(text) - i
+	}
+
+	return end
 }
 
 const (
 	ILEGAL = "ILEGAL"
 	EOF    = "EOF"
 
+	// Comments are not returned by the lexer but kept aside
+	COMMENT = "COMMENT"
+
 	// Identifiers + literals
 	IDENT = "IDENT"
 	INT   = "INT"
@@ -1,35 +1,101 @@
 package utils
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
-)
+	"sync"
 
-var traceLevel int = 0
-var tracingEnabled bool = false
+	"github.com/cupsadarius/monkey_interpreter/token"
+)
 
 const traceIdentPlaceholder string = "\t"
 
-func identLevel() string {
-	return strings.Repeat(traceIdentPlaceholder, traceLevel-1)
+// Tracer writes the nesting of the functions it is wrapped around, along
+// with the token each one starts and ends at. A tracer keeps an indentation
+// level, so it is used by one goroutine at a time; parsers trace with a Fork
+// of the tracer they are handed, which lets parsers running in parallel
+// share one.
+type Tracer struct {
+	out   *traceOutput
+	level int
+}
+
+// traceOutput is the writer shared by a tracer and its forks. Lines are
+// written whole under mu, so the writer need not be safe for concurrent
+// use.
+type traceOutput struct {
+	mu   sync.Mutex
+	w    io.Writer
+	json *json.Encoder
+}
+
+// Event is a line written by a JSON tracer.
+type Event struct {
+	Event   string `json:"event"` // "begin" or "end"
+	Name    string `json:"name"`
+	Depth   int    `json:"depth"`
+	Token   string `json:"token"`
+	Literal string `json:"literal"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+}
+
+// NewTracer returns a tracer writing indented BEGIN and END lines to w.
+func NewTracer(w io.Writer) *Tracer {
+	return &Tracer{out: &traceOutput{w: w}}
 }
 
-func tracePrint(str string) {
-	if tracingEnabled {
-		fmt.Printf("%s%s\n", identLevel(), str)
+// NewJSONTracer returns a tracer writing one JSON encoded Event per line
+// to w.
+func NewJSONTracer(w io.Writer) *Tracer {
+	return &Tracer{out: &traceOutput{w: w, json: json.NewEncoder(w)}}
+}
+
+// Fork returns a tracer writing to the same writer as t, in the same
+// format, with an indentation level of its own.
+func (t *Tracer) Fork() *Tracer {
+	return &Tracer{out: t.out}
+}
+
+func (t *Tracer) identLevel() string {
+	return strings.Repeat(traceIdentPlaceholder, t.level-1)
+}
+
+func (t *Tracer) tracePrint(event, msg string, tok token.Token) {
+	t.out.mu.Lock()
+	defer t.out.mu.Unlock()
+
+	if t.out.json != nil {
+		t.out.json.Encode(Event{
+			Event:   strings.ToLower(event),
+			Name:    msg,
+			Depth:   t.level,
+			Token:   string(tok.Type),
+			Literal: tok.Literal,
+			Line:    tok.Line,
+			Column:  tok.Column,
+		})
+		return
 	}
+
+	fmt.Fprintf(t.out.w, "%s%s %s (%s %q at %d:%d)\n", t.identLevel(), event, msg, tok.Type, tok.Literal, tok.Line, tok.Column)
 }
 
-func incIdent() { traceLevel = traceLevel + 1 }
-func decIdent() { traceLevel = traceLevel - 1 }
+func (t *Tracer) incIdent() { t.level = t.level + 1 }
+func (t *Tracer) decIdent() { t.level = t.level - 1 }
 
-func Trace(msg string) string {
-	incIdent()
-	tracePrint("BEGIN " + msg)
+// Trace records entering msg at tok and returns msg, to be passed to
+// UnTrace when leaving it.
+func (t *Tracer) Trace(msg string, tok token.Token) string {
+	t.incIdent()
+	t.tracePrint("BEGIN", msg, tok)
 	return msg
 }
 
-func UnTrace(msg string) {
-	tracePrint("END " + msg)
-	decIdent()
+// UnTrace records leaving msg at tok.
+func (t *Tracer) UnTrace(msg string, tok token.Token) {
+	t.tracePrint("END", msg, tok)
+	t.decIdent()
 }
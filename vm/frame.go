@@ -0,0 +1,36 @@
+package vm
+
+import (
+	"github.com/cupsadarius/monkey_interpreter/code"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+	locals      []object.Object
+}
+
+// NewFrame creates the frame for a call of cl. basePointer is the stack
+// position of the called closure; everything from there up belongs to the
+// callee and is dropped when it returns. Locals live on the heap rather
+// than on the stack, so closures created in the frame can keep referring to
+// them after it returned.
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	f := &Frame{
+		cl:          cl,
+		ip:          -1,
+		basePointer: basePointer,
+	}
+
+	if cl.Fn.NumLocals > 0 {
+		f.locals = make([]object.Object, cl.Fn.NumLocals)
+	}
+
+	return f
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,482 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cupsadarius/monkey_interpreter/code"
+	"github.com/cupsadarius/monkey_interpreter/compiler"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/object"
+)
+
+const (
+	InitialStackSize = 256
+	GlobalsSize      = 65536
+	MaxFrames        = 65536
+)
+
+var (
+	True  = object.TRUE
+	False = object.FALSE
+	Null  = object.NULL
+)
+
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpGreaterThan:  ">",
+	code.OpGreaterEqual: ">=",
+	code.OpLessThan:     "<",
+	code.OpLessEqual:    "<=",
+}
+
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp    int // Always points to the next free slot. Top of stack is stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	lastPopped object.Object
+	result     object.Object
+	halted     bool
+
+	trace io.Writer
+
+	// set while RunContext runs
+	meter *evaluator.Meter
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobalsStore creates a VM that keeps its globals in s, so that they
+// survive from one VM to the next.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, SourceMap: bytecode.SourceMap}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, 1, 16)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     s,
+		globalNames: bytecode.GlobalNames,
+
+		stack: make([]object.Object, InitialStackSize),
+		sp:    0,
+
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// LastPoppedStackElem returns the value of the last expression statement
+// that ran at the top level of the program.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.lastPopped
+}
+
+// Result returns what evaluating the program returns: the value of a top
+// level return statement, the error that stopped the program or otherwise
+// the value of the last statement.
+func (vm *VM) Result() object.Object {
+	if vm.halted {
+		return vm.result
+	}
+
+	return vm.lastPopped
+}
+
+// Trace makes the VM write every instruction it executes to w, along with
+// the source line and the stack before the instruction runs. Instructions
+// of called functions are indented by their call depth.
+func (vm *VM) Trace(w io.Writer) {
+	vm.trace = w
+}
+
+func (vm *VM) traceInstruction(ip int) {
+	fn := vm.currentFrame().cl.Fn
+
+	text, _, err := compiler.FormatInstruction(fn, ip, vm.constants, vm.globalNames)
+	if err != nil {
+		text = "ERROR: " + err.Error()
+	}
+
+	line := "   -"
+	if pos, ok := fn.SourceMap.Lookup(ip); ok {
+		line = fmt.Sprintf("%4d", pos.Line)
+	}
+
+	stack := make([]string, vm.sp)
+	for i, obj := range vm.stack[:vm.sp] {
+		stack[i] = obj.Inspect()
+	}
+
+	fmt.Fprintf(vm.trace, "%s%04d %s %-40s [%s]\n",
+		strings.Repeat("\t", vm.framesIndex-1), ip, line, text, strings.Join(stack, ", "))
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+
+	if vm.framesIndex < len(vm.frames) {
+		vm.frames[vm.framesIndex] = f
+	} else {
+		vm.frames = append(vm.frames, f)
+	}
+	vm.framesIndex++
+
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// RunContext executes the program like Run, but stops as soon as ctx is
+// done or the program runs more instructions than limits.MaxSteps or for
+// longer than limits.MaxDuration, returning ctx.Err() or the matching
+// evaluator error. The other limits are not enforced by the VM.
+func (vm *VM) RunContext(ctx context.Context, limits evaluator.Limits) error {
+	vm.meter = evaluator.NewMeter(ctx, evaluator.Limits{MaxSteps: limits.MaxSteps, MaxDuration: limits.MaxDuration})
+	defer func() { vm.meter = nil }()
+
+	return vm.Run()
+}
+
+// Run executes the program. Errors raised by the script stop the program
+// and become its result; the returned error is reserved for failures of
+// the VM itself.
+func (vm *VM) Run() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for !vm.halted && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		if vm.trace != nil {
+			vm.traceInstruction(ip)
+		}
+		if vm.meter != nil && !vm.meter.Step() {
+			return vm.meter.Err()
+		}
+
+		var err error
+		var result object.Object
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.lastPopped = vm.pop()
+
+		case code.OpTrue:
+			vm.push(True)
+
+		case code.OpFalse:
+			vm.push(False)
+
+		case code.OpNull:
+			vm.push(Null)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual,
+			code.OpGreaterThan, code.OpGreaterEqual, code.OpLessThan, code.OpLessEqual:
+			result = vm.executeBinaryOperation(op)
+
+		case code.OpBang:
+			result = evaluator.EvalPrefix("!", vm.pop())
+
+		case code.OpMinus:
+			operand := vm.pop()
+			if integer, ok := operand.(*object.Integer); ok {
+				result = object.NewInteger(-integer.Value)
+			} else {
+				result = evaluator.EvalPrefix("-", operand)
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !evaluator.IsTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+			// like in the evaluator, a let statement has no value
+			vm.lastPopped = nil
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			value := vm.globals[globalIndex]
+			if value == nil {
+				result = identifierNotFound(nameAt(vm.globalNames, int(globalIndex)))
+			} else {
+				vm.push(value)
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			vm.currentFrame().locals[localIndex] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			value := frame.locals[localIndex]
+			if value == nil {
+				result = identifierNotFound(nameAt(frame.cl.Fn.LocalNames, int(localIndex)))
+			} else {
+				vm.push(value)
+			}
+
+		case code.OpGetFree:
+			depth := code.ReadUint8(ins[ip+1:])
+			localIndex := code.ReadUint8(ins[ip+2:])
+			nameIndex := code.ReadUint16(ins[ip+3:])
+			vm.currentFrame().ip += 4
+
+			outer := vm.currentFrame().cl.Outer
+			if int(depth) == 0 || int(depth) > len(outer) || int(localIndex) >= len(outer[depth-1]) {
+				return fmt.Errorf("invalid free variable %d at depth %d", localIndex, depth)
+			}
+
+			value := outer[depth-1][localIndex]
+			if value == nil {
+				result = identifierNotFound(vm.constants[nameIndex].Inspect())
+			} else {
+				vm.push(value)
+			}
+
+		case code.OpUndefined:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			result = identifierNotFound(vm.constants[nameIndex].Inspect())
+
+		case code.OpGetMember:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			result = evaluator.EvalMember(vm.pop(), vm.constants[nameIndex].Inspect())
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			result, err = vm.pushClosure(int(constIndex))
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			result, err = vm.executeCall(int(numArgs))
+
+		case code.OpReturnValue:
+			vm.returnFromFrame(vm.pop())
+
+		case code.OpReturn:
+			vm.returnFromFrame(Null)
+
+		default:
+			def, lookupErr := code.Lookup(byte(op))
+			if lookupErr != nil {
+				return lookupErr
+			}
+			return fmt.Errorf("unhandled opcode %s", def.Name)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if result != nil {
+			if result.Type() == object.ERROR_OBJ {
+				vm.halt(result)
+			} else {
+				vm.push(result)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (vm *VM) halt(result object.Object) {
+	vm.result = result
+	vm.halted = true
+}
+
+func (vm *VM) returnFromFrame(returnValue object.Object) {
+	if vm.framesIndex == 1 {
+		// a return statement at the top level ends the program
+		vm.halt(returnValue)
+		return
+	}
+
+	frame := vm.popFrame()
+	vm.sp = frame.basePointer
+
+	vm.push(returnValue)
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) object.Object {
+	left := vm.pop()
+	right := vm.pop()
+
+	leftInt, leftOk := left.(*object.Integer)
+	rightInt, rightOk := right.(*object.Integer)
+
+	if leftOk && rightOk {
+		l, r := leftInt.Value, rightInt.Value
+
+		switch op {
+		case code.OpAdd:
+			return object.NewInteger(l + r)
+		case code.OpSub:
+			return object.NewInteger(l - r)
+		case code.OpMul:
+			return object.NewInteger(l * r)
+		case code.OpEqual:
+			return object.NativeBoolToBoolean(l == r)
+		case code.OpNotEqual:
+			return object.NativeBoolToBoolean(l != r)
+		case code.OpGreaterThan:
+			return object.NativeBoolToBoolean(l > r)
+		case code.OpLessThan:
+			return object.NativeBoolToBoolean(l < r)
+		}
+	}
+
+	return evaluator.EvalInfix(infixOperators[op], left, right)
+}
+
+func (vm *VM) pushClosure(constIndex int) (object.Object, error) {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return nil, fmt.Errorf("not a function: %+v", constant)
+	}
+
+	frame := vm.currentFrame()
+
+	var outer [][]object.Object
+	if vm.framesIndex > 1 {
+		outer = make([][]object.Object, 0, len(frame.cl.Outer)+1)
+		outer = append(outer, frame.locals)
+		outer = append(outer, frame.cl.Outer...)
+	}
+
+	return &object.Closure{Fn: function, Outer: outer}, nil
+}
+
+func (vm *VM) executeCall(numArgs int) (object.Object, error) {
+	basePointer := vm.sp - 1 - numArgs
+	callee := vm.stack[basePointer]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, basePointer, numArgs)
+	case *object.Builtin:
+		args := make([]object.Object, numArgs)
+		copy(args, vm.stack[basePointer+1:vm.sp])
+		vm.sp = basePointer
+
+		result := callee.Fn(args...)
+		if result == nil {
+			result = Null
+		}
+		return result, nil
+	default:
+		return newError("not a function: %s", callee.Type()), nil
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, basePointer int, numArgs int) (object.Object, error) {
+	if numArgs != cl.Fn.NumParameters {
+		return newError("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs), nil
+	}
+
+	frame := NewFrame(cl, basePointer)
+	copy(frame.locals, vm.stack[basePointer+1:vm.sp])
+	vm.sp = basePointer
+
+	return nil, vm.pushFrame(frame)
+}
+
+func (vm *VM) push(o object.Object) {
+	if vm.sp >= len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func identifierNotFound(name string) *object.Error {
+	return newError("identifier not found: %s", name)
+}
+
+func nameAt(names []string, index int) string {
+	if index < len(names) {
+		return names[index]
+	}
+
+	return fmt.Sprintf("#%d", index)
+}
@@ -0,0 +1,198 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cupsadarius/monkey_interpreter/ast"
+	"github.com/cupsadarius/monkey_interpreter/compiler"
+	"github.com/cupsadarius/monkey_interpreter/evaluator"
+	"github.com/cupsadarius/monkey_interpreter/internal/enginetest"
+	"github.com/cupsadarius/monkey_interpreter/lexer"
+	"github.com/cupsadarius/monkey_interpreter/object"
+	"github.com/cupsadarius/monkey_interpreter/parser"
+)
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func runVM(program *ast.Program) (object.Object, error) {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		return nil, err
+	}
+
+	return machine.Result(), nil
+}
+
+func TestMatchesEvaluator(t *testing.T) {
+	enginetest.Run(t, runVM)
+}
+
+func TestGlobalsSurviveBetweenRuns(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	constants := []object.Object{}
+	globals := make([]object.Object, GlobalsSize)
+
+	inputs := []struct {
+		input    string
+		expected string
+	}{
+		{"let add = fn(a, b) { a + b };", ""},
+		{"let one = 1;", ""},
+		{"add(one, 2)", "3"},
+	}
+
+	for _, tt := range inputs {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		constants = comp.Constants()
+
+		machine := NewWithGlobalsStore(comp.Bytecode(), globals)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		if tt.expected == "" {
+			continue
+		}
+		if result := machine.Result(); result == nil || result.Inspect() != tt.expected {
+			t.Errorf("wrong result. want=%s, got=%v", tt.expected, result)
+		}
+	}
+}
+
+func TestBuiltinsAndMembers(t *testing.T) {
+	comp := compiler.New()
+	double := comp.SymbolTable().Define("double")
+
+	if err := comp.Compile(parse(`double(21)`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	globals := make([]object.Object, GlobalsSize)
+	globals[double.Index] = &object.Builtin{Name: "double", Fn: func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	}}
+
+	machine := NewWithGlobalsStore(comp.Bytecode(), globals)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if result := machine.Result(); result.Inspect() != "42" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	_, err := runVM(parse("let f = fn(x) { f(x) + 1 }; f(1);"))
+	if err == nil || err.Error() != "stack overflow" {
+		t.Fatalf("expected a stack overflow. got=%v", err)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	c := compiler.New()
+	if err := c.Compile(parse("let loop = fn(i) { if (i > 0) { loop(i - 1) } else { i } }; loop(100);")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	tests := []struct {
+		ctx      context.Context
+		limits   evaluator.Limits
+		expected error
+	}{
+		{context.Background(), evaluator.Limits{}, nil},
+		{context.Background(), evaluator.Limits{MaxSteps: 10000}, nil},
+		{context.Background(), evaluator.Limits{MaxSteps: 100}, evaluator.ErrStepLimitExceeded},
+		{canceled(), evaluator.Limits{}, context.Canceled},
+	}
+
+	for i, tt := range tests {
+		machine := New(c.Bytecode())
+		if err := machine.RunContext(tt.ctx, tt.limits); !errors.Is(err, tt.expected) {
+			t.Errorf("tests[%d]: wrong error. expected=%v, got=%v", i, tt.expected, err)
+		}
+		if tt.expected == nil && machine.Result().Inspect() != "0" {
+			t.Errorf("tests[%d]: wrong result. got=%s", i, machine.Result().Inspect())
+		}
+	}
+}
+
+func canceled() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	return ctx
+}
+
+const fibonacci = "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(20);"
+
+func TestTrace(t *testing.T) {
+	c := compiler.New()
+	if err := c.Compile(parse("let f = fn(x) {\n  x * 2;\n};\nf(21);")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var out bytes.Buffer
+	machine := New(c.Bytecode())
+	machine.Trace(&out)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	expected := []string{
+		"0000    1 OpClosure 1              ; <function 1/1> []",
+		"0003    1 OpSetGlobal 0            ; f",
+		"0006    4 OpGetGlobal 0            ; f             []",
+		"0009    4 OpConstant 2             ; 21            [Closure[0x",
+		"0012    4 OpCall 1",
+		"\t0000    2 OpConstant 0             ; 2             []",
+		"\t0003    2 OpGetLocal 0             ; x             [2]",
+		"\t0005    2 OpMul                                    [2, 21]",
+		"\t0006    2 OpReturnValue                            [42]",
+		"0014    4 OpPop                                    [42]",
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("wrong number of lines. expected=%d, got=%d\n%s", len(expected), len(lines), out.String())
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, expected[i]) {
+			t.Errorf("wrong line %d.\nwant=%q\ngot =%q", i, expected[i], line)
+		}
+	}
+}
+
+func BenchmarkFibonacciEval(b *testing.B) {
+	program := parse(fibonacci)
+
+	for i := 0; i < b.N; i++ {
+		evaluator.Eval(program, object.NewEnvironment())
+	}
+}
+
+func BenchmarkFibonacciVM(b *testing.B) {
+	program := parse(fibonacci)
+
+	for i := 0; i < b.N; i++ {
+		if _, err := runVM(program); err != nil {
+			b.Fatal(err)
+		}
+	}
+}